@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/pixiv/go-libwebp/webp"
+)
+
+var presets = map[string]webp.Preset{
+	"default": webp.PresetDefault,
+	"photo":   webp.PresetPhoto,
+	"picture": webp.PresetPicture,
+	"drawing": webp.PresetDrawing,
+	"icon":    webp.PresetIcon,
+	"text":    webp.PresetText,
+}
+
+var imageHints = map[string]webp.ImageHint{
+	"photo":   webp.HintPhoto,
+	"picture": webp.HintPicture,
+	"graph":   webp.HintGraph,
+}
+
+var alphaFilters = map[string]int{
+	"none": 0,
+	"fast": 1,
+	"best": 2,
+}
+
+// configFlags defines the flags of encoding parameters on fs, and returns the
+// function which creates the configuration from the parsed flags.
+//
+// Like cwebp, the configuration is initialized by -preset, and then only the
+// parameters given on the command line are set, so that the others keep the
+// values of the preset.
+func configFlags(fs *flag.FlagSet) func() (*webp.Config, error) {
+	setters := map[string]func(c *webp.Config) error{}
+	intFlag := func(name string, value int, usage string, set func(c *webp.Config, v int)) {
+		p := fs.Int(name, value, usage)
+		setters[name] = func(c *webp.Config) error {
+			set(c, *p)
+			return nil
+		}
+	}
+	boolFlag := func(name string, usage string, set func(c *webp.Config)) {
+		p := fs.Bool(name, false, usage)
+		setters[name] = func(c *webp.Config) error {
+			if *p {
+				set(c)
+			}
+			return nil
+		}
+	}
+	funcFlag := func(name string, usage string, set func(c *webp.Config, s string) error) {
+		var s string
+		fs.Func(name, usage, func(v string) error {
+			s = v
+			return nil
+		})
+		setters[name] = func(c *webp.Config) error {
+			if err := set(c, s); err != nil {
+				return fmt.Errorf("invalid value %q for flag -%s: %v", s, name, err)
+			}
+			return nil
+		}
+	}
+
+	preset := fs.String("preset", "default", "preset `name` of default, photo, picture, drawing, icon or text")
+	quality := fs.Float64("q", 75, "quality `factor` (0:small..100:big)")
+	losslessPreset := fs.Int("z", 0, "activate lossless preset of the given `level`\n(0:fast..9:slowest), which overrides -q and -m")
+
+	intFlag("alpha_q", 100, "transparency-compression quality (0..100)", (*webp.Config).SetAlphaQuality)
+	intFlag("m", 4, "compression method (0=fast, 6=slowest)", (*webp.Config).SetMethod)
+	intFlag("segments", 4, "number of segments to use (1..4)", (*webp.Config).SetSegments)
+	intFlag("size", 0, "target size (in bytes)", (*webp.Config).SetTargetSize)
+	psnr := fs.Float64("psnr", 0, "target PSNR (in dB. typically: 42)")
+	setters["psnr"] = func(c *webp.Config) error {
+		c.SetTargetPSNR(float32(*psnr))
+		return nil
+	}
+	intFlag("sns", 50, "spatial noise shaping (0:off, 100:max)", (*webp.Config).SetSNSStrength)
+	intFlag("f", 60, "filter strength (0=off..100)", (*webp.Config).SetFilterStrength)
+	intFlag("sharpness", 0, "filter sharpness (0:most .. 7:least sharp)", (*webp.Config).SetFilterSharpness)
+	boolFlag("strong", "use strong filter (default)", func(c *webp.Config) { c.SetFilterType(webp.StrongFilter) })
+	boolFlag("nostrong", "use simple filter instead of strong", func(c *webp.Config) { c.SetFilterType(webp.SimpleFilter) })
+	boolFlag("sharp_yuv", "use sharper (and slower) RGB->YUV conversion", func(c *webp.Config) { c.SetUseSharpYUV(true) })
+	intFlag("partition_limit", 0, "limit quality to fit the 512k limit on\nthe first partition (0=no degradation ... 100=full)", (*webp.Config).SetPartitionLimit)
+	intFlag("partitions", 0, "log2 of the number of token partitions (0..3)", (*webp.Config).SetPartitions)
+	intFlag("pass", 1, "analysis pass number (1..10)", (*webp.Config).SetPass)
+	funcFlag("qrange", "specifies the permissible quality range `min,max`\n(default 0,100)", func(c *webp.Config, s string) error {
+		v, err := parseInts(s, 2)
+		if err != nil {
+			return err
+		}
+		c.SetQMin(v[0])
+		c.SetQMax(v[1])
+		return nil
+	})
+	boolFlag("mt", "use multi-threading if available", func(c *webp.Config) { c.SetThreadLevel(1) })
+	boolFlag("low_memory", "reduce memory usage (slower encoding)", func(c *webp.Config) { c.SetLowMemory(true) })
+	boolFlag("af", "auto-adjust filter strength", func(c *webp.Config) { c.SetAutoFilter(true) })
+	boolFlag("jpeg_like", "roughly match expected JPEG size", func(c *webp.Config) { c.SetEmulateJPEGSize(true) })
+	intFlag("pre", 0, "pre-processing filter (0=none, 1=segment-smooth, 2=pseudo-random dithering)", func(c *webp.Config, v int) {
+		c.SetPreprocessing(webp.Preprocessing(v))
+	})
+	intFlag("alpha_method", 1, "transparency-compression method (0..1)", (*webp.Config).SetAlphaCompression)
+	funcFlag("alpha_filter", "predictive filtering for alpha plane, `name` of none, fast (default) or best", func(c *webp.Config, s string) error {
+		v, ok := alphaFilters[s]
+		if !ok {
+			return fmt.Errorf("unknown filter")
+		}
+		c.SetAlphaFiltering(v)
+		return nil
+	})
+	boolFlag("exact", "preserve RGB values in transparent area", func(c *webp.Config) { c.SetExact(true) })
+	boolFlag("lossless", "encode image losslessly", func(c *webp.Config) { c.SetLossless(true) })
+	intFlag("near_lossless", 100, "use near-lossless image preprocessing\n(0..100=off), which implies -lossless", func(c *webp.Config, v int) {
+		c.SetNearLossless(v)
+		c.SetLossless(true)
+	})
+	funcFlag("hint", "specify image characteristics `hint`,\none of photo, picture or graph", func(c *webp.Config, s string) error {
+		v, ok := imageHints[s]
+		if !ok {
+			return fmt.Errorf("unknown hint")
+		}
+		c.SetImageHint(v)
+		return nil
+	})
+	boolFlag("delta_palette", "use delta-palettization in lossless encoding", func(c *webp.Config) { c.SetUseDeltaPalette(true) })
+	boolFlag("show_compressed", "export the compressed picture back instead of the source", func(c *webp.Config) { c.SetShowCompressed(true) })
+
+	return func() (*webp.Config, error) {
+		p, ok := presets[*preset]
+		if !ok {
+			return nil, fmt.Errorf("unknown preset: %s", *preset)
+		}
+		c, err := webp.ConfigPreset(p, float32(*quality))
+		if err != nil {
+			return nil, err
+		}
+
+		var setErr error
+		fs.Visit(func(f *flag.Flag) {
+			if set := setters[f.Name]; set != nil && setErr == nil {
+				setErr = set(c)
+			}
+		})
+		if setErr != nil {
+			return nil, setErr
+		}
+
+		if isSet(fs, "z") {
+			lc, err := webp.ConfigLosslessPreset(*losslessPreset)
+			if err != nil {
+				return nil, fmt.Errorf("invalid lossless preset: -z %d", *losslessPreset)
+			}
+			c.SetLossless(true)
+			c.SetMethod(lc.Method())
+			c.SetQuality(lc.Quality())
+		}
+
+		if err := webp.ValidateConfig(c); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+}
+
+// isSet reports whether the flag of the name is given on the command line.
+func isSet(fs *flag.FlagSet, name string) (set bool) {
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
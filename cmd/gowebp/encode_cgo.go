@@ -0,0 +1,46 @@
+//go:build cgo
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/pixiv/go-libwebp/mux"
+	"github.com/pixiv/go-libwebp/webp"
+)
+
+// encode encodes the input into w, after cropping, resizing and blending it
+// by libwebp like cwebp. It returns the dimensions of the encoded picture and
+// the statistics of the encoding.
+func encode(w io.Writer, in *input, c *webp.Config, opts *options) (image.Point, *webp.EncodeStats, error) {
+	pic, err := webp.NewPicture(in.image)
+	if err != nil {
+		return image.Point{}, nil, err
+	}
+	defer pic.Close()
+
+	if !opts.crop.Empty() {
+		if err := pic.Crop(opts.crop); err != nil {
+			return image.Point{}, nil, err
+		}
+	}
+	if opts.width != 0 || opts.height != 0 {
+		if err := pic.Rescale(opts.width, opts.height); err != nil {
+			return image.Point{}, nil, err
+		}
+	}
+	if opts.noAlpha {
+		pic.BlendAlpha(color.White)
+	}
+	if m := in.metadata.filter(opts.metadata); !m.empty() {
+		c.SetMetadata(&mux.Metadata{ICCProfile: m.ICCProfile, EXIF: m.EXIF, XMP: m.XMP})
+	}
+
+	stats, err := webp.EncodePictureWithStats(w, pic, c)
+	if err != nil {
+		return image.Point{}, nil, err
+	}
+	return image.Pt(pic.Width(), pic.Height()), stats, nil
+}
@@ -0,0 +1,64 @@
+//go:build !cgo
+
+package main
+
+import (
+	"image"
+	"io"
+
+	"golang.org/x/image/draw"
+
+	"github.com/pixiv/go-libwebp/mux"
+	"github.com/pixiv/go-libwebp/webp"
+)
+
+// encode encodes the input into w, after cropping, resizing and blending it
+// in pure Go. It returns the dimensions of the encoded picture and the
+// statistics of the encoding.
+func encode(w io.Writer, in *input, c *webp.Config, opts *options) (image.Point, *webp.EncodeStats, error) {
+	img := in.image
+	r := img.Bounds()
+	if !opts.crop.Empty() {
+		r = opts.crop.Add(r.Min)
+	}
+	size := r.Size()
+	if opts.width != 0 || opts.height != 0 {
+		size = rescaledSize(size, opts.width, opts.height)
+	}
+
+	if r != img.Bounds() || size != r.Size() || opts.noAlpha {
+		dst := image.NewRGBA(image.Rectangle{Max: size})
+		op := draw.Src
+		if opts.noAlpha {
+			draw.Draw(dst, dst.Rect, image.White, image.Point{}, draw.Src)
+			op = draw.Over
+		}
+		if size == r.Size() {
+			draw.Draw(dst, dst.Rect, img, r.Min, op)
+		} else {
+			draw.CatmullRom.Scale(dst, dst.Rect, img, r, op, nil)
+		}
+		img = dst
+	}
+	if m := in.metadata.filter(opts.metadata); !m.empty() {
+		c.SetMetadata(&mux.Metadata{ICCProfile: m.ICCProfile, EXIF: m.EXIF, XMP: m.XMP})
+	}
+
+	stats, err := webp.EncodeRGBAWithStats(w, img, c)
+	if err != nil {
+		return image.Point{}, nil, err
+	}
+	return size, stats, nil
+}
+
+// rescaledSize returns the size to rescale to, calculating 0 of width or
+// height to preserve the aspect ratio in the same way as libwebp.
+func rescaledSize(size image.Point, width, height int) image.Point {
+	if width == 0 {
+		width = (size.X*height + size.Y - 1) / size.Y
+	}
+	if height == 0 {
+		height = (size.Y*width + size.X - 1) / size.X
+	}
+	return image.Pt(width, height)
+}
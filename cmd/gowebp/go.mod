@@ -0,0 +1,8 @@
+module github.com/pixiv/go-libwebp/cmd/gowebp
+
+go 1.23
+
+require (
+	github.com/pixiv/go-libwebp v0.0.0-20261018073021-36e8883aea99
+	golang.org/x/image v0.18.0
+)
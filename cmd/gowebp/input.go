@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"os"
+
+	// Decoders of the input formats
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/tiff"
+)
+
+// input represents the decoded input file.
+type input struct {
+	image    image.Image
+	format   string // Format name registered by image.RegisterFormat
+	metadata metadata
+}
+
+// readInput reads and decodes the input file, or stdin if name is "-".
+func readInput(name string, stdin io.Reader) (*input, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("could not decode %s: %w", name, err)
+	}
+	m, err := readMetadata(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("could not read metadata of %s: %w", name, err)
+	}
+	return &input{image: img, format: format, metadata: m}, nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/pixiv/go-libwebp/webp"
+)
+
+func TestDecodePNM(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want image.Image
+	}{
+		{
+			"P5",
+			"P5\n# comment\n2 1\n255\n\x10\x20",
+			&image.Gray{Pix: []uint8{0x10, 0x20}, Stride: 2, Rect: image.Rect(0, 0, 2, 1)},
+		},
+		{
+			"P6 of 16 bits",
+			"P6 1 1 65535\n\xff\xff\x80\x00\x00\x00",
+			&image.NRGBA{Pix: []uint8{0xff, 0x80, 0x00, 0xff}, Stride: 4, Rect: image.Rect(0, 0, 1, 1)},
+		},
+		{
+			"P7 of gray and alpha",
+			"P7\nWIDTH 1\nHEIGHT 2\nDEPTH 2\nMAXVAL 15\nTUPLTYPE GRAYSCALE_ALPHA\nENDHDR\n\x0f\x00\x05\x0a",
+			&image.NRGBA{Pix: []uint8{0xff, 0xff, 0xff, 0x00, 0x55, 0x55, 0x55, 0xaa}, Stride: 4, Rect: image.Rect(0, 0, 1, 2)},
+		},
+		{
+			"P7 of RGBA",
+			"P7\nWIDTH 1\nHEIGHT 1\nDEPTH 4\nMAXVAL 255\nTUPLTYPE RGB_ALPHA\nENDHDR\n\x01\x02\x03\x04",
+			&image.NRGBA{Pix: []uint8{0x01, 0x02, 0x03, 0x04}, Stride: 4, Rect: image.Rect(0, 0, 1, 1)},
+		},
+	}
+
+	for _, tt := range tests {
+		img, format, err := image.Decode(bytes.NewReader([]byte(tt.data)))
+		if err != nil {
+			t.Errorf("%s: Got Error: %v", tt.name, err)
+			continue
+		}
+		if format != "pnm" && format != "pam" {
+			t.Errorf("%s: Unexpected format: %s", tt.name, format)
+		}
+		if !equalImages(img, tt.want) {
+			t.Errorf("%s: Unexpected image: %+v", tt.name, img)
+		}
+	}
+
+	for _, data := range []string{
+		"P5\n2 1\n0\n\x00\x00",
+		"P6\n0 1\n255\n",
+		"P6\n1 1\n255\n\x00",
+		"P7\nWIDTH 1\nHEIGHT 1\nDEPTH 5\nMAXVAL 255\nENDHDR\n\x00\x00\x00\x00\x00",
+		"P7\nWIDTH 1\nHEIGHT 1\n",
+	} {
+		if _, _, err := image.Decode(bytes.NewReader([]byte(data))); err == nil {
+			t.Errorf("Expected error for %q", data)
+		}
+	}
+}
+
+func TestDecodeY4M(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		planes string
+		cb, cr []uint8
+		alpha  bool
+	}{
+		{"420", "YUV4MPEG2 W2 H2 F25:1 Ip A1:1 C420jpeg", "\x10\x20\x30\x40\x50\x60", []uint8{0x50}, []uint8{0x60}, false},
+		{"444", "YUV4MPEG2 W2 H2 C444", "\x10\x20\x30\x40\x00\x01\x02\x03\x10\x10\x10\x11", []uint8{0x02}, []uint8{0x10}, false},
+		{"444alpha", "YUV4MPEG2 W2 H2 C444alpha", "\x10\x20\x30\x40\x50\x50\x50\x50\x60\x60\x60\x60\xff\x00\xff\x00", []uint8{0x50}, []uint8{0x60}, true},
+		{"mono", "YUV4MPEG2 W2 H2 Cmono", "\x10\x20\x30\x40", []uint8{0x80}, []uint8{0x80}, false},
+	}
+
+	for _, tt := range tests {
+		img, format, err := image.Decode(bytes.NewReader([]byte(tt.header + "\nFRAME\n" + tt.planes)))
+		if err != nil {
+			t.Errorf("%s: Got Error: %v", tt.name, err)
+			continue
+		}
+		yuva, ok := img.(*webp.YUVAImage)
+		if format != "y4m" || !ok {
+			t.Errorf("%s: Unexpected image %T of %s", tt.name, img, format)
+			continue
+		}
+		if yuva.Rect != image.Rect(0, 0, 2, 2) || !bytes.Equal(yuva.Y, []uint8{0x10, 0x20, 0x30, 0x40}) {
+			t.Errorf("%s: Unexpected luma: %v of %v", tt.name, yuva.Y, yuva.Rect)
+		}
+		if !bytes.Equal(yuva.Cb, tt.cb) || !bytes.Equal(yuva.Cr, tt.cr) {
+			t.Errorf("%s: Expected chroma %v %v, but got %v %v", tt.name, tt.cb, tt.cr, yuva.Cb, yuva.Cr)
+		}
+		if (yuva.ColorSpace == webp.YUV420A) != tt.alpha {
+			t.Errorf("%s: Unexpected color space: %v", tt.name, yuva.ColorSpace)
+		}
+	}
+
+	for _, data := range []string{
+		"YUV4MPEG2 W2 H2 C420p10\nFRAME\n",
+		"YUV4MPEG2 W2 C420\nFRAME\n",
+		"YUV4MPEG2 W2 H2\nFRAME\n\x00\x00",
+		"YUV4MPEG2 W2 H2\n\x00\x00\x00\x00\x00\x00",
+	} {
+		if _, _, err := image.Decode(bytes.NewReader([]byte(data))); err == nil {
+			t.Errorf("Expected error for %q", data)
+		}
+	}
+}
+
+func TestReadMetadata(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 4, 4))
+	want := metadata{
+		ICCProfile: bytes.Repeat([]byte("icc"), 10),
+		EXIF:       []byte("MM\x00\x2a exif"),
+		XMP:        []byte("<x:xmpmeta/>"),
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	segment := func(marker byte, payload ...[]byte) []byte {
+		data := bytes.Join(payload, nil)
+		return append([]byte{0xff, marker, byte((len(data) + 2) >> 8), byte(len(data) + 2)}, data...)
+	}
+	jpg := bytes.Join([][]byte{
+		buf.Bytes()[:2],
+		segment(0xe1, []byte(jpegEXIFSignature), want.EXIF),
+		// ICC profile split into segments in reverse order
+		segment(0xe2, []byte(jpegICCSignature), []byte{2, 2}, want.ICCProfile[12:]),
+		segment(0xe2, []byte(jpegICCSignature), []byte{1, 2}, want.ICCProfile[:12]),
+		segment(0xe1, []byte(jpegXMPSignature), want.XMP),
+		buf.Bytes()[2:],
+	}, nil)
+
+	buf.Reset()
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	chunk := func(kind string, payload ...[]byte) []byte {
+		data := append([]byte(kind), bytes.Join(payload, nil)...)
+		b := binary.BigEndian.AppendUint32(nil, uint32(len(data)-4))
+		b = append(b, data...)
+		return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(data))
+	}
+	var icc bytes.Buffer
+	zw := zlib.NewWriter(&icc)
+	zw.Write(want.ICCProfile)
+	zw.Close()
+	const ihdrEnd = 8 + 12 + 13
+	pngData := bytes.Join([][]byte{
+		buf.Bytes()[:ihdrEnd],
+		chunk("iCCP", []byte("profile\x00\x00"), icc.Bytes()),
+		chunk("iTXt", []byte(pngXMPKeyword+"\x00\x00\x00\x00\x00"), want.XMP),
+		buf.Bytes()[ihdrEnd : buf.Len()-12],
+		chunk("eXIf", want.EXIF),
+		buf.Bytes()[buf.Len()-12:],
+	}, nil)
+
+	for _, tt := range []struct {
+		format string
+		data   []byte
+	}{
+		{"jpeg", jpg},
+		{"png", pngData},
+	} {
+		if _, format, err := image.Decode(bytes.NewReader(tt.data)); err != nil || format != tt.format {
+			t.Errorf("%s: Could not decode: %v", tt.format, err)
+			continue
+		}
+		m, err := readMetadata(tt.data, tt.format)
+		if err != nil {
+			t.Errorf("%s: Got Error: %v", tt.format, err)
+			continue
+		}
+		if !bytes.Equal(m.ICCProfile, want.ICCProfile) || !bytes.Equal(m.EXIF, want.EXIF) || !bytes.Equal(m.XMP, want.XMP) {
+			t.Errorf("%s: Unexpected metadata: %q", tt.format, m)
+		}
+
+		m = m.filter(metadataEXIF | metadataXMP)
+		if m.ICCProfile != nil || m.EXIF == nil || m.XMP == nil {
+			t.Errorf("%s: Unexpected filtered metadata: %q", tt.format, m)
+		}
+	}
+}
+
+func TestMetadataKinds(t *testing.T) {
+	var k metadataKinds
+	for _, tt := range []struct {
+		value string
+		want  metadataKinds
+	}{
+		{"all", metadataAll},
+		{"none", 0},
+		{"exif,xmp", metadataEXIF | metadataXMP},
+		{"icc", metadataICC},
+	} {
+		if err := k.Set(tt.value); err != nil {
+			t.Errorf("Got Error: %v", err)
+			continue
+		}
+		if k != tt.want {
+			t.Errorf("Expected %v for %q, but got %v", tt.want.String(), tt.value, k.String())
+		}
+	}
+	if err := k.Set("exif,gps"); err == nil {
+		t.Errorf("Expected error for unknown metadata")
+	}
+}
+
+// equalImages reports whether the images have the same bounds and colors.
+func equalImages(a, b image.Image) bool {
+	if a.Bounds() != b.Bounds() {
+		return false
+	}
+	r := a.Bounds()
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if color.NRGBAModel.Convert(a.At(x, y)) != color.NRGBAModel.Convert(b.At(x, y)) {
+				return false
+			}
+		}
+	}
+	return true
+}
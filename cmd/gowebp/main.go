@@ -0,0 +1,179 @@
+// Command gowebp encodes PNG, JPEG, GIF, TIFF, PAM, PNM or Y4M images into
+// WebP, in the same way as cwebp of libwebp.
+//
+// Usage:
+//
+//	gowebp [options] input_file -o output_file.webp
+//
+// The input and the output are read from stdin and written to stdout if they
+// are "-". Flags of encoding parameters correspond to the setters of
+// webp.Config, and are named after the ones of cwebp. Since the flag package
+// accepts a single value for each flag, -crop, -resize and -qrange take
+// comma-separated values such as "-crop 10,10,320,240".
+//
+// When built without cgo, only lossless encoding is available.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var errNoInput = errors.New("no input file specified")
+var errTooManyInputs = errors.New("too many input files specified")
+
+// options represents the flags which are not encoding parameters.
+type options struct {
+	output   string
+	crop     image.Rectangle
+	width    int // Width to resize to, 0 to keep the aspect ratio
+	height   int // Height to resize to, 0 to keep the aspect ratio
+	metadata metadataKinds
+	noAlpha  bool
+	stats    bool
+	short    bool
+	quiet    bool
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(os.Stderr, "gowebp: %v\n", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run runs the command with the arguments excluding the command name.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("gowebp", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage:\n  gowebp [options] input_file -o output_file.webp\n\nOptions:\n")
+		fs.PrintDefaults()
+	}
+
+	var opts options
+	fs.StringVar(&opts.output, "o", "", "output `file` name, or \"-\" for stdout")
+	fs.Func("crop", "crop picture with the given rectangle `x,y,w,h`", func(s string) error {
+		v, err := parseInts(s, 4)
+		if err != nil {
+			return err
+		}
+		if v[2] <= 0 || v[3] <= 0 {
+			return fmt.Errorf("invalid size %dx%d", v[2], v[3])
+		}
+		opts.crop = image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3])
+		return nil
+	})
+	fs.Func("resize", "resize picture to `w,h` after any cropping, 0 to keep the aspect ratio", func(s string) error {
+		v, err := parseInts(s, 2)
+		if err != nil {
+			return err
+		}
+		if v[0] < 0 || v[1] < 0 || v[0] == 0 && v[1] == 0 {
+			return fmt.Errorf("invalid size %dx%d", v[0], v[1])
+		}
+		opts.width, opts.height = v[0], v[1]
+		return nil
+	})
+	fs.Var(&opts.metadata, "metadata", "comma-separated `list` of metadata to copy from the input:\nall, none, exif, icc or xmp")
+	fs.BoolVar(&opts.noAlpha, "noalpha", false, "discard any transparency information by blending with white")
+	fs.BoolVar(&opts.stats, "stats", false, "print encoding statistics")
+	fs.BoolVar(&opts.short, "short", false, "print only the output size and PSNR")
+	fs.BoolVar(&opts.quiet, "quiet", false, "do not print anything but errors")
+	newConfig := configFlags(fs)
+
+	// Flags may follow the input file like cwebp.
+	var inputs []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		inputs = append(inputs, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	switch {
+	case len(inputs) == 0:
+		fs.Usage()
+		return errNoInput
+	case len(inputs) > 1:
+		return errTooManyInputs
+	}
+
+	config, err := newConfig()
+	if err != nil {
+		return err
+	}
+	input, err := readInput(inputs[0], stdin)
+	if err != nil {
+		return err
+	}
+	inputSize := input.image.Bounds().Size()
+	if !opts.crop.Empty() && !opts.crop.In(image.Rect(0, 0, inputSize.X, inputSize.Y)) {
+		return fmt.Errorf("cropping rectangle %v is out of the picture of %v", opts.crop, inputSize)
+	}
+
+	var w io.Writer = io.Discard
+	var file *os.File
+	switch opts.output {
+	case "":
+		if !opts.quiet {
+			fmt.Fprintln(stderr, "gowebp: no output file specified (no -o flag). Encoding will be performed, but its results discarded.")
+		}
+	case "-":
+		w = stdout
+	default:
+		if file, err = os.Create(opts.output); err != nil {
+			return err
+		}
+		w = bufio.NewWriter(file)
+	}
+
+	size, stats, err := encode(w, input, config, &opts)
+	if err == nil && file != nil {
+		err = errors.Join(w.(*bufio.Writer).Flush(), file.Close())
+	}
+	if err != nil {
+		if file != nil {
+			file.Close()
+			os.Remove(opts.output)
+		}
+		return err
+	}
+
+	switch {
+	case opts.quiet:
+	case opts.short:
+		printShortStats(stderr, config, stats)
+	case opts.stats:
+		printStats(stderr, inputs[0], size, config, stats)
+	}
+	return nil
+}
+
+// parseInts parses n comma-separated integers.
+func parseInts(s string, n int) ([]int, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != n {
+		return nil, fmt.Errorf("expected %d comma-separated values", n)
+	}
+	v := make([]int, n)
+	for i, f := range fields {
+		var err error
+		if v[i], err = strconv.Atoi(strings.TrimSpace(f)); err != nil {
+			return nil, fmt.Errorf("invalid value %q", f)
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pixiv/go-libwebp/test/util"
+	"github.com/pixiv/go-libwebp/webp"
+)
+
+func TestRun(t *testing.T) {
+	input := util.GetExFilePath("yellow-rose-3.png")
+	output := filepath.Join(t.TempDir(), "out.webp")
+
+	tests := []struct {
+		args []string
+		size image.Point
+	}{
+		{[]string{"-lossless", input, "-o", output}, image.Pt(400, 301)},
+		{[]string{"-z", "3", "-crop", "10,20,200,100", input, "-o", output}, image.Pt(200, 100)},
+		{[]string{"-lossless", "-exact", "-resize", "100,0", "-noalpha", input, "-o", output}, image.Pt(100, 76)},
+		{[]string{"-lossless", "-crop", "0,0,200,100", "-resize", "0,50", input, "-o", output}, image.Pt(100, 50)},
+	}
+
+	for _, tt := range tests {
+		var stderr bytes.Buffer
+		if err := run(append(tt.args, "-stats"), nil, nil, &stderr); err != nil {
+			t.Errorf("%v: Got Error: %v", tt.args, err)
+			continue
+		}
+		if !strings.Contains(stderr.String(), "Lossless-ARGB compressed size") {
+			t.Errorf("%v: Unexpected statistics: %s", tt.args, stderr.String())
+		}
+
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+		img, err := webp.DecodeNRGBA(data, &webp.DecoderOptions{})
+		if err != nil {
+			t.Errorf("%v: Got Error: %v", tt.args, err)
+			continue
+		}
+		if img.Rect.Size() != tt.size {
+			t.Errorf("%v: Expected size %v, but got %v", tt.args, tt.size, img.Rect.Size())
+		}
+	}
+}
+
+func TestRunWithStdio(t *testing.T) {
+	pam := "P7\nWIDTH 2\nHEIGHT 1\nDEPTH 3\nMAXVAL 255\nENDHDR\n\x01\x02\x03\x04\x05\x06"
+	var stdout, stderr bytes.Buffer
+	if err := run([]string{"-lossless", "-short", "-", "-o", "-"}, strings.NewReader(pam), &stdout, &stderr); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	img, err := webp.DecodeNRGBA(stdout.Bytes(), &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if !bytes.Equal(img.Pix, []uint8{1, 2, 3, 0xff, 4, 5, 6, 0xff}) {
+		t.Errorf("Unexpected pixels: %v", img.Pix)
+	}
+	if got := strings.TrimSpace(stderr.String()); got != strconv.Itoa(stdout.Len()) {
+		t.Errorf("Expected the output size %d, but got %q", stdout.Len(), got)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	input := util.GetExFilePath("checkerboard.png")
+	for _, args := range [][]string{
+		{},
+		{input, input},
+		{"-lossless", "-crop", "0,0,0,10", input},
+		{"-lossless", "-crop", "1,2,3", input},
+		{"-lossless", "-crop", "100000,0,10,10", input},
+		{"-lossless", "-resize", "0,0", input},
+		{"-preset", "unknown", input},
+		{"-z", "10", input},
+		{"-lossless", "-hint", "unknown", input},
+		{"-lossless", "-m", "7", input},
+		{"-lossless", "-metadata", "gps", input},
+		{"-lossless", filepath.Join(t.TempDir(), "missing.png")},
+		{"-lossless", util.GetExFilePath("README.md")},
+	} {
+		if err := run(args, nil, nil, &bytes.Buffer{}); err == nil {
+			t.Errorf("%v: Expected error", args)
+		}
+	}
+}
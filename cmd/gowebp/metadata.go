@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var errMetadataFormat = errors.New("malformed metadata")
+
+// metadata represents metadata of the input, which is copied into the output
+// if requested by -metadata.
+type metadata struct {
+	ICCProfile []byte
+	EXIF       []byte
+	XMP        []byte
+}
+
+// metadataKinds represents the kinds of metadata to be copied. It implements
+// flag.Value.
+type metadataKinds uint
+
+const (
+	metadataEXIF metadataKinds = 1 << iota
+	metadataICC
+	metadataXMP
+
+	metadataAll = metadataEXIF | metadataICC | metadataXMP
+)
+
+var metadataNames = map[string]metadataKinds{
+	"all":  metadataAll,
+	"none": 0,
+	"exif": metadataEXIF,
+	"icc":  metadataICC,
+	"xmp":  metadataXMP,
+}
+
+func (k *metadataKinds) String() string {
+	if *k == 0 {
+		return "none"
+	}
+	var names []string
+	for _, name := range []string{"exif", "icc", "xmp"} {
+		if *k&metadataNames[name] != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+func (k *metadataKinds) Set(s string) error {
+	*k = 0
+	for _, name := range strings.Split(s, ",") {
+		v, ok := metadataNames[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("unknown metadata %q", name)
+		}
+		*k |= v
+	}
+	return nil
+}
+
+// filter returns the metadata of the kinds.
+func (m metadata) filter(k metadataKinds) metadata {
+	if k&metadataEXIF == 0 {
+		m.EXIF = nil
+	}
+	if k&metadataICC == 0 {
+		m.ICCProfile = nil
+	}
+	if k&metadataXMP == 0 {
+		m.XMP = nil
+	}
+	return m
+}
+
+// empty reports whether the metadata has nothing to be copied.
+func (m metadata) empty() bool {
+	return m.ICCProfile == nil && m.EXIF == nil && m.XMP == nil
+}
+
+// readMetadata reads metadata from data of the format. Metadata is read from
+// JPEG and PNG like cwebp, and nothing is read from the other formats.
+func readMetadata(data []byte, format string) (metadata, error) {
+	switch format {
+	case "jpeg":
+		return readJPEGMetadata(data)
+	case "png":
+		return readPNGMetadata(data)
+	}
+	return metadata{}, nil
+}
+
+// Signatures of the application segments of JPEG
+const (
+	jpegEXIFSignature = "Exif\x00\x00"
+	jpegXMPSignature  = "http://ns.adobe.com/xap/1.0/\x00"
+	jpegICCSignature  = "ICC_PROFILE\x00"
+)
+
+// readJPEGMetadata reads EXIF and XMP from APP1 segments, and ICC profile
+// which may be split into several APP2 segments.
+func readJPEGMetadata(data []byte) (metadata, error) {
+	var m metadata
+	type iccChunk struct {
+		seq  int
+		data []byte
+	}
+	var iccChunks []iccChunk
+
+	data = data[2:] // SOI
+	for len(data) >= 4 && data[0] == 0xff {
+		marker := data[1]
+		switch {
+		case marker == 0xff:
+			// Fill byte
+			data = data[1:]
+			continue
+		case marker == 0x01 || 0xd0 <= marker && marker <= 0xd7:
+			// Markers without payload
+			data = data[2:]
+			continue
+		case marker == 0xda || marker == 0xd9:
+			// Metadata must appear before SOS.
+			data = nil
+			continue
+		}
+
+		length := int(binary.BigEndian.Uint16(data[2:]))
+		if length < 2 || len(data) < 2+length {
+			return metadata{}, errMetadataFormat
+		}
+		payload := data[4 : 2+length]
+		data = data[2+length:]
+
+		switch {
+		case marker == 0xe1 && bytes.HasPrefix(payload, []byte(jpegEXIFSignature)) && m.EXIF == nil:
+			m.EXIF = payload[len(jpegEXIFSignature):]
+		case marker == 0xe1 && bytes.HasPrefix(payload, []byte(jpegXMPSignature)) && m.XMP == nil:
+			m.XMP = payload[len(jpegXMPSignature):]
+		case marker == 0xe2 && bytes.HasPrefix(payload, []byte(jpegICCSignature)):
+			payload = payload[len(jpegICCSignature):]
+			if len(payload) < 2 {
+				return metadata{}, errMetadataFormat
+			}
+			iccChunks = append(iccChunks, iccChunk{seq: int(payload[0]), data: payload[2:]})
+		}
+	}
+
+	sort.SliceStable(iccChunks, func(i, j int) bool { return iccChunks[i].seq < iccChunks[j].seq })
+	for i, c := range iccChunks {
+		if c.seq != i+1 {
+			return metadata{}, errMetadataFormat
+		}
+		m.ICCProfile = append(m.ICCProfile, c.data...)
+	}
+	return m, nil
+}
+
+// pngXMPKeyword is the keyword of iTXt chunk which contains XMP.
+const pngXMPKeyword = "XML:com.adobe.xmp"
+
+// readPNGMetadata reads EXIF from eXIf chunk, ICC profile from iCCP chunk and
+// XMP from iTXt chunk.
+func readPNGMetadata(data []byte) (metadata, error) {
+	var m metadata
+	data = data[8:] // Signature
+	for len(data) >= 12 {
+		length := binary.BigEndian.Uint32(data)
+		if uint64(len(data)) < 12+uint64(length) {
+			return metadata{}, errMetadataFormat
+		}
+		kind, payload := string(data[4:8]), data[8:8+length]
+		data = data[12+length:]
+
+		switch kind {
+		case "eXIf":
+			m.EXIF = payload
+		case "iCCP":
+			// Profile name, compression method and compressed profile
+			i := bytes.IndexByte(payload, 0)
+			if i < 0 || len(payload) < i+2 {
+				return metadata{}, errMetadataFormat
+			}
+			profile, err := inflate(payload[i+2:])
+			if err != nil {
+				return metadata{}, err
+			}
+			m.ICCProfile = profile
+		case "iTXt":
+			// Keyword, compression flag and method, language tag, translated
+			// keyword and text
+			keyword, rest, ok := bytes.Cut(payload, []byte{0})
+			if !ok || string(keyword) != pngXMPKeyword || len(rest) < 2 {
+				continue
+			}
+			compressed := rest[0] != 0
+			fields := bytes.SplitN(rest[2:], []byte{0}, 3)
+			if len(fields) != 3 {
+				return metadata{}, errMetadataFormat
+			}
+			text := fields[2]
+			if compressed {
+				var err error
+				if text, err = inflate(text); err != nil {
+					return metadata{}, err
+				}
+			}
+			m.XMP = text
+		}
+	}
+	return m, nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
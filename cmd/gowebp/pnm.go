@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var errPNMFormat = errors.New("invalid PNM header")
+
+// maxInputDimension is the maximum width and height of the input, which is the
+// same as the one of WebP.
+const maxInputDimension = 16383
+
+func init() {
+	image.RegisterFormat("pnm", "P5", decodePNM, decodePNMConfig)
+	image.RegisterFormat("pnm", "P6", decodePNM, decodePNMConfig)
+	image.RegisterFormat("pam", "P7", decodePNM, decodePNMConfig)
+}
+
+// pnmHeader represents the header of PGM (P5), PPM (P6) or PAM (P7) image.
+type pnmHeader struct {
+	width, height int
+	depth         int // Number of channels, which is 1 to 4
+	maxval        int
+}
+
+// decodePNMConfig returns the color model and dimensions of PNM image.
+func decodePNMConfig(r io.Reader) (image.Config, error) {
+	h, err := readPNMHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	model := color.NRGBAModel
+	if h.depth == 1 {
+		model = color.GrayModel
+	}
+	return image.Config{ColorModel: model, Width: h.width, Height: h.height}, nil
+}
+
+// decodePNM decodes PNM image into image.Gray or image.NRGBA. Samples of
+// maxval other than 255 are scaled into 8 bits.
+func decodePNM(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readPNMHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	bytesPerSample := 1
+	if h.maxval > 0xff {
+		bytesPerSample = 2
+	}
+	rowSize := h.width * h.depth * bytesPerSample
+	row := make([]byte, rowSize)
+	sample := func(i int) uint8 {
+		v := int(row[i])
+		if bytesPerSample == 2 {
+			v = v<<8 | int(row[i+1])
+		}
+		if h.maxval == 0xff {
+			return uint8(v)
+		}
+		return uint8((min(v, h.maxval)*0xff + h.maxval/2) / h.maxval)
+	}
+
+	rect := image.Rect(0, 0, h.width, h.height)
+	if h.depth == 1 {
+		img := image.NewGray(rect)
+		for y := 0; y < h.height; y++ {
+			if _, err := io.ReadFull(br, row); err != nil {
+				return nil, err
+			}
+			for x := 0; x < h.width; x++ {
+				img.Pix[y*img.Stride+x] = sample(x * bytesPerSample)
+			}
+		}
+		return img, nil
+	}
+
+	img := image.NewNRGBA(rect)
+	for y := 0; y < h.height; y++ {
+		if _, err := io.ReadFull(br, row); err != nil {
+			return nil, err
+		}
+		for x := 0; x < h.width; x++ {
+			p := img.Pix[y*img.Stride+x*4 : y*img.Stride+x*4+4]
+			i := x * h.depth * bytesPerSample
+			switch h.depth {
+			case 2:
+				// Gray and alpha
+				p[0] = sample(i)
+				p[1], p[2], p[3] = p[0], p[0], sample(i+bytesPerSample)
+			case 3:
+				p[0], p[1], p[2], p[3] = sample(i), sample(i+bytesPerSample), sample(i+2*bytesPerSample), 0xff
+			case 4:
+				p[0], p[1], p[2], p[3] = sample(i), sample(i+bytesPerSample), sample(i+2*bytesPerSample), sample(i+3*bytesPerSample)
+			}
+		}
+	}
+	return img, nil
+}
+
+// readPNMHeader reads the header of PNM image, and leaves r at the beginning
+// of the samples.
+func readPNMHeader(r *bufio.Reader) (pnmHeader, error) {
+	magic, err := readPNMToken(r)
+	if err != nil {
+		return pnmHeader{}, err
+	}
+
+	var h pnmHeader
+	switch magic {
+	case "P5", "P6":
+		h.depth = 1
+		if magic == "P6" {
+			h.depth = 3
+		}
+		// The single whitespace after maxval is consumed by readPNMToken.
+		for _, v := range []*int{&h.width, &h.height, &h.maxval} {
+			token, err := readPNMToken(r)
+			if err != nil {
+				return pnmHeader{}, err
+			}
+			if *v, err = strconv.Atoi(token); err != nil {
+				return pnmHeader{}, errPNMFormat
+			}
+		}
+	case "P7":
+		if err := readPAMHeader(r, &h); err != nil {
+			return pnmHeader{}, err
+		}
+	default:
+		return pnmHeader{}, errPNMFormat
+	}
+
+	switch {
+	case h.width <= 0 || h.height <= 0 || h.depth < 1 || h.depth > 4 || h.maxval <= 0 || h.maxval > 0xffff:
+		return pnmHeader{}, errPNMFormat
+	case h.width > maxInputDimension || h.height > maxInputDimension:
+		return pnmHeader{}, fmt.Errorf("image of %dx%d is too large", h.width, h.height)
+	}
+	return h, nil
+}
+
+// readPAMHeader reads the lines of the header of PAM image after the magic
+// number until ENDHDR. TUPLTYPE is ignored, since it is implied by DEPTH.
+func readPAMHeader(r *bufio.Reader, h *pnmHeader) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		var v *int
+		switch fields[0] {
+		case "ENDHDR":
+			return nil
+		case "WIDTH":
+			v = &h.width
+		case "HEIGHT":
+			v = &h.height
+		case "DEPTH":
+			v = &h.depth
+		case "MAXVAL":
+			v = &h.maxval
+		case "TUPLTYPE":
+			continue
+		default:
+			return errPNMFormat
+		}
+		if len(fields) != 2 {
+			return errPNMFormat
+		}
+		if *v, err = strconv.Atoi(fields[1]); err != nil {
+			return errPNMFormat
+		}
+	}
+}
+
+// readPNMToken reads a token separated by whitespaces, skipping comments
+// before the token. The whitespace after the token is consumed.
+func readPNMToken(r *bufio.Reader) (string, error) {
+	var token []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		switch {
+		case c == '#' && len(token) == 0:
+			if _, err := r.ReadString('\n'); err != nil {
+				return "", io.ErrUnexpectedEOF
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f':
+			if len(token) > 0 {
+				return string(token), nil
+			}
+		default:
+			token = append(token, c)
+		}
+	}
+}
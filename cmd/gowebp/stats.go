@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"strings"
+
+	"github.com/pixiv/go-libwebp/webp"
+)
+
+// Names of lossless features printed by cwebp
+var losslessFeatureNames = []struct {
+	feature webp.LosslessFeatures
+	name    string
+}{
+	{webp.LosslessPredictor, "PREDICTION"},
+	{webp.LosslessCrossColor, "CROSS-COLOR-TRANSFORM"},
+	{webp.LosslessSubtractGreen, "SUBTRACT-GREEN"},
+	{webp.LosslessColorIndexing, "PALETTE"},
+}
+
+// printShortStats prints the output size, and PSNR of lossy encoding.
+func printShortStats(w io.Writer, c *webp.Config, s *webp.EncodeStats) {
+	if c.Lossless() {
+		fmt.Fprintf(w, "%7d\n", s.CodedSize)
+		return
+	}
+	fmt.Fprintf(w, "%7d %.2f\n", s.CodedSize, s.PSNR[3])
+}
+
+// printStats prints the statistics of encoding in the same format as cwebp.
+func printStats(w io.Writer, input string, size image.Point, c *webp.Config, s *webp.EncodeStats) {
+	bpp := 8 * float64(s.CodedSize) / float64(size.X*size.Y)
+	fmt.Fprintf(w, "File:      %s\n", input)
+	fmt.Fprintf(w, "Dimension: %d x %d\n", size.X, size.Y)
+
+	if c.Lossless() {
+		fmt.Fprintf(w, "Output:    %d bytes (%.2f bpp)\n", s.CodedSize, bpp)
+		fmt.Fprintf(w, "Lossless-ARGB compressed size: %d bytes\n", s.LosslessSize)
+		fmt.Fprintf(w, "  * Header size: %d bytes, image data size: %d\n", s.LosslessHeaderSize, s.LosslessDataSize)
+		var features []string
+		for _, f := range losslessFeatureNames {
+			if s.LosslessFeatures&f.feature != 0 {
+				features = append(features, f.name)
+			}
+		}
+		if len(features) > 0 {
+			fmt.Fprintf(w, "  * Lossless features used: %s\n", strings.Join(features, " "))
+		}
+		fmt.Fprintf(w, "  * Precision Bits: histogram=%d transform=%d cache=%d\n", s.HistogramBits, s.TransformBits, s.CacheBits)
+		if s.PaletteSize > 0 {
+			fmt.Fprintf(w, "  * Palette size:   %d\n", s.PaletteSize)
+		}
+		return
+	}
+
+	fmt.Fprintf(w, "Output:    %d bytes Y-U-V-All-PSNR %2.2f %2.2f %2.2f   %2.2f dB\n", s.CodedSize, s.PSNR[0], s.PSNR[1], s.PSNR[2], s.PSNR[3])
+	fmt.Fprintf(w, "           (%.2f bpp)\n", bpp)
+
+	blocks := s.BlockCount[0] + s.BlockCount[1]
+	percent := func(n, total int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(total)
+	}
+	fmt.Fprintf(w, "block count:  intra4:     %6d  (%.2f%%)\n", s.BlockCount[0], percent(s.BlockCount[0], blocks))
+	fmt.Fprintf(w, "              intra16:    %6d  (%.2f%%)\n", s.BlockCount[1], percent(s.BlockCount[1], blocks))
+	fmt.Fprintf(w, "              skipped:    %6d  (%.2f%%)\n", s.BlockCount[2], percent(s.BlockCount[2], blocks))
+	fmt.Fprintf(w, "bytes used:  header:         %6d  (%.1f%%)\n", s.HeaderBytes[0], percent(s.HeaderBytes[0], s.CodedSize))
+	fmt.Fprintf(w, "             mode-partition: %6d  (%.1f%%)\n", s.HeaderBytes[1], percent(s.HeaderBytes[1], s.CodedSize))
+	if s.AlphaDataSize > 0 {
+		fmt.Fprintf(w, "             transparency:   %6d (%.1f dB)\n", s.AlphaDataSize, s.PSNR[4])
+	}
+
+	fmt.Fprintf(w, " Residuals bytes  |segment 1|segment 2|segment 3|segment 4|  total\n")
+	for i, name := range []string{"  intra4-coeffs: ", " intra16-coeffs: ", "  chroma coeffs: "} {
+		total := 0
+		fmt.Fprintf(w, "%s|", name)
+		for _, n := range s.ResidualBytes[i] {
+			fmt.Fprintf(w, "%7d  |", n)
+			total += n
+		}
+		fmt.Fprintf(w, "%7d\n", total)
+	}
+	fmt.Fprintf(w, "    macroblocks:  |")
+	for _, n := range s.SegmentSize {
+		fmt.Fprintf(w, "%7d%% |", int(percent(n, blocks)))
+	}
+	fmt.Fprintf(w, "%7d\n", blocks)
+	for _, row := range []struct {
+		name   string
+		values [4]int
+	}{
+		{"      quantizer:", s.SegmentQuant},
+		{"   filter level:", s.SegmentLevel},
+	} {
+		fmt.Fprintf(w, "%s  |", row.name)
+		for _, v := range row.values {
+			fmt.Fprintf(w, "%7d  |", v)
+		}
+		fmt.Fprintln(w)
+	}
+}
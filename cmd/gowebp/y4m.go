@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pixiv/go-libwebp/webp"
+)
+
+var errY4MFormat = errors.New("invalid Y4M header")
+
+// y4mSignature is the signature at the beginning of Y4M stream.
+const y4mSignature = "YUV4MPEG2"
+
+func init() {
+	image.RegisterFormat("y4m", y4mSignature, decodeY4M, decodeY4MConfig)
+}
+
+// y4mHeader represents the stream header of Y4M.
+type y4mHeader struct {
+	width, height int
+	colorSpace    string // Parameter C, which is 420jpeg if omitted
+}
+
+// y4mChromaShifts holds the log2 of horizontal and vertical subsampling of
+// chroma planes for each color space. Chroma planes of mono are omitted.
+var y4mChromaShifts = map[string][2]int{
+	"420jpeg":  {1, 1},
+	"420paldv": {1, 1},
+	"420mpeg2": {1, 1},
+	"420":      {1, 1},
+	"422":      {1, 0},
+	"444":      {0, 0},
+	"444alpha": {0, 0},
+	"mono":     {0, 0},
+}
+
+// decodeY4MConfig returns the color model and dimensions of Y4M stream.
+func decodeY4MConfig(r io.Reader) (image.Config, error) {
+	h, err := readY4MHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: h.width, Height: h.height}, nil
+}
+
+// decodeY4M decodes the first frame of Y4M stream into webp.YUVAImage, whose
+// samples are of ITU-R BT.601 like Y4M. Chroma planes which are not 4:2:0 are
+// downsampled by averaging.
+func decodeY4M(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readY4MHeader(br)
+	if err != nil {
+		return nil, err
+	}
+
+	// Frame header
+	line, err := br.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "FRAME") {
+		return nil, errY4MFormat
+	}
+
+	rect := image.Rect(0, 0, h.width, h.height)
+	cs := webp.YUV420
+	if h.colorSpace == "444alpha" {
+		cs = webp.YUV420A
+	}
+	img := webp.NewYUVAImage(rect, cs)
+	if _, err := io.ReadFull(br, img.Y); err != nil {
+		return nil, err
+	}
+
+	if h.colorSpace == "mono" {
+		for i := range img.Cb {
+			img.Cb[i], img.Cr[i] = 0x80, 0x80
+		}
+		return img, nil
+	}
+	shifts := y4mChromaShifts[h.colorSpace]
+	cw, ch := (h.width+1<<shifts[0]-1)>>shifts[0], (h.height+1<<shifts[1]-1)>>shifts[1]
+	plane := make([]byte, cw*ch)
+	for _, dst := range [][]byte{img.Cb, img.Cr} {
+		if _, err := io.ReadFull(br, plane); err != nil {
+			return nil, err
+		}
+		downsample(dst, img.CStride, plane, cw, ch, shifts)
+	}
+	if cs == webp.YUV420A {
+		if _, err := io.ReadFull(br, img.A); err != nil {
+			return nil, err
+		}
+	}
+	return img, nil
+}
+
+// downsample downsamples the chroma plane of w x h, which is subsampled with
+// shifts, into the 4:2:0 plane of dst.
+func downsample(dst []byte, stride int, src []byte, w, h int, shifts [2]int) {
+	sx, sy := 1-shifts[0], 1-shifts[1]
+	dw, dh := (w+1<<sx-1)>>sx, (h+1<<sy-1)>>sy
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			sum, n := 0, 0
+			for yy := y << sy; yy < min((y+1)<<sy, h); yy++ {
+				for xx := x << sx; xx < min((x+1)<<sx, w); xx++ {
+					sum += int(src[yy*w+xx])
+					n++
+				}
+			}
+			dst[y*stride+x] = uint8((sum + n/2) / n)
+		}
+	}
+}
+
+// readY4MHeader reads the stream header of Y4M. Only 8-bit color spaces are
+// supported.
+func readY4MHeader(r *bufio.Reader) (y4mHeader, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return y4mHeader{}, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != y4mSignature {
+		return y4mHeader{}, errY4MFormat
+	}
+
+	h := y4mHeader{colorSpace: "420jpeg"}
+	for _, f := range fields[1:] {
+		switch f[0] {
+		case 'W':
+			h.width, err = strconv.Atoi(f[1:])
+		case 'H':
+			h.height, err = strconv.Atoi(f[1:])
+		case 'C':
+			h.colorSpace = f[1:]
+		}
+		if err != nil {
+			return y4mHeader{}, errY4MFormat
+		}
+	}
+
+	switch _, ok := y4mChromaShifts[h.colorSpace]; {
+	case !ok:
+		return y4mHeader{}, fmt.Errorf("unsupported Y4M color space: %s", h.colorSpace)
+	case h.width <= 0 || h.height <= 0:
+		return y4mHeader{}, errY4MFormat
+	case h.width > maxInputDimension || h.height > maxInputDimension:
+		return y4mHeader{}, fmt.Errorf("image of %dx%d is too large", h.width, h.height)
+	}
+	return h, nil
+}
@@ -0,0 +1,434 @@
+// Package container provides a parser and a writer of WebP container (RIFF)
+// format, which are implemented in pure Go without libwebp.
+//
+// See https://developers.google.com/speed/webp/docs/riff_container for the
+// specification of the format.
+package container
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// FourCC represents the chunk identifier.
+type FourCC string
+
+const (
+	FourCCVP8  FourCC = "VP8 " // Lossy bitstream
+	FourCCVP8L FourCC = "VP8L" // Lossless bitstream
+	FourCCVP8X FourCC = "VP8X" // Extended format header
+	FourCCALPH FourCC = "ALPH" // Alpha channel of lossy bitstream
+	FourCCANIM FourCC = "ANIM" // Global parameters of animation
+	FourCCANMF FourCC = "ANMF" // Animation frame
+	FourCCICCP FourCC = "ICCP" // ICC profile
+	FourCCEXIF FourCC = "EXIF" // EXIF metadata
+	FourCCXMP  FourCC = "XMP " // XMP metadata
+)
+
+// Format represents the compression format of image, which corresponds to
+// the format of WebPBitstreamFeatures in libwebp.
+type Format int
+
+const (
+	// FormatMixed specifies animation which contains both lossy and lossless
+	// frames.
+	FormatMixed Format = 0
+	// FormatLossy specifies VP8 bitstream.
+	FormatLossy Format = 1
+	// FormatLossless specifies VP8L bitstream.
+	FormatLossless Format = 2
+)
+
+// Flags represents feature flags in VP8X chunk.
+type Flags uint32
+
+const (
+	FlagAnimation Flags = 0x02 // Animation (ANIM and ANMF chunks)
+	FlagXMP       Flags = 0x04 // XMP metadata
+	FlagEXIF      Flags = 0x08 // EXIF metadata
+	FlagAlpha     Flags = 0x10 // Any of frames contains alpha channel
+	FlagICC       Flags = 0x20 // ICC profile
+
+	validFlags = FlagAnimation | FlagXMP | FlagEXIF | FlagAlpha | FlagICC
+)
+
+// maxCanvasPixels is the upper limit of canvas width * height.
+const maxCanvasPixels = 1<<32 - 1
+
+// Chunk represents a chunk in WebP container.
+type Chunk struct {
+	ChunkHeader
+	Offset int64  // Offset of the chunk header from the beginning of data
+	Data   []byte // Payload of the chunk, not including the padding byte
+}
+
+// VP8X represents the contents of VP8X chunk.
+type VP8X struct {
+	Flags        Flags // Feature flags
+	CanvasWidth  int   // Canvas width in pixels
+	CanvasHeight int   // Canvas height in pixels
+}
+
+// Animation represents the contents of ANIM chunk.
+type Animation struct {
+	BackgroundColor uint32 // Background color in [Blue, Green, Red, Alpha] byte order
+	LoopCount       int    // Number of times to loop the animation [0 = infinite]
+}
+
+// Frame represents the contents of ANMF chunk.
+type Frame struct {
+	X, Y              int           // Offset of the frame in pixels
+	Width, Height     int           // Size of the frame in pixels
+	Duration          time.Duration // Display duration of the frame
+	DisposeBackground bool          // If true, dispose the frame area to the background color
+	NoBlend           bool          // If true, do not blend the frame with the canvas
+	Format            Format        // Compression format of the frame
+	Chunks            []Chunk       // Frame data chunks (ALPH, VP8, VP8L and unknown chunks)
+}
+
+// Container represents parsed WebP container.
+type Container struct {
+	Size      uint32     // Size of the RIFF payload
+	Chunks    []Chunk    // Top-level chunks in order
+	VP8X      *VP8X      // VP8X chunk, or nil for the simple format
+	Animation *Animation // ANIM chunk, or nil if it is not animated
+	Frames    []Frame    // ANMF chunks
+
+	Width        int    // Image (canvas) width in pixels
+	Height       int    // Image (canvas) height in pixels
+	HasAlpha     bool   // True if the image contains an alpha channel
+	HasAnimation bool   // True if the image is an animation
+	Format       Format // Image compression format
+}
+
+// Chunk returns the first top-level chunk with the id, or nil if it does not
+// exist.
+func (c *Container) Chunk(id FourCC) *Chunk {
+	for i := range c.Chunks {
+		if c.Chunks[i].ID == id {
+			return &c.Chunks[i]
+		}
+	}
+	return nil
+}
+
+// Parse parses and validates WebP container. Data after the size specified
+// in the RIFF header is ignored. The payloads of returned chunks refer to data.
+func Parse(data []byte) (*Container, error) {
+	if len(data) < riffHeaderSize {
+		return nil, ErrTruncated
+	}
+	if string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrFormat
+	}
+	size := binary.LittleEndian.Uint32(data[4:8])
+	if size < 4+chunkHeaderSize || size%2 != 0 {
+		return nil, fmt.Errorf("%w: invalid RIFF size %d", ErrFormat, size)
+	}
+	if int64(size)+8 > int64(len(data)) {
+		return nil, ErrTruncated
+	}
+
+	chunks, err := splitChunks(data[riffHeaderSize:size+8], riffHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Container{Size: size, Chunks: chunks}
+	switch chunks[0].ID {
+	case FourCCVP8, FourCCVP8L:
+		err = c.parseSimple()
+	case FourCCVP8X:
+		err = c.parseExtended()
+	default:
+		err = fmt.Errorf("%w: unexpected first chunk %q", ErrFormat, chunks[0].ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// parseSimple parses the simple format which consists of a single VP8 or VP8L
+// chunk.
+func (c *Container) parseSimple() error {
+	if len(c.Chunks) != 1 {
+		return fmt.Errorf("%w: unexpected %q chunk in simple format", ErrFormat, c.Chunks[1].ID)
+	}
+
+	b, err := parseBitstream(&c.Chunks[0])
+	if err != nil {
+		return err
+	}
+	c.Width, c.Height, c.HasAlpha, c.Format = b.width, b.height, b.hasAlpha, b.format
+	return nil
+}
+
+// chunkOrder is the order of known chunks in the extended format.
+var chunkOrder = map[FourCC]int{
+	FourCCVP8X: 0,
+	FourCCICCP: 1,
+	FourCCANIM: 2,
+	FourCCALPH: 3,
+	FourCCVP8:  3,
+	FourCCVP8L: 3,
+	FourCCANMF: 3,
+	FourCCEXIF: 4,
+	FourCCXMP:  5,
+}
+
+// parseExtended parses the extended format which starts with VP8X chunk.
+func (c *Container) parseExtended() error {
+	vp8x := c.Chunks[0].Data
+	if len(vp8x) < 10 {
+		return fmt.Errorf("%w: invalid size of VP8X chunk %d", ErrFormat, len(vp8x))
+	}
+	c.VP8X = &VP8X{
+		Flags:        Flags(binary.LittleEndian.Uint32(vp8x[0:4])),
+		CanvasWidth:  int(uint24(vp8x[4:7])) + 1,
+		CanvasHeight: int(uint24(vp8x[7:10])) + 1,
+	}
+	if c.VP8X.Flags&^validFlags != 0 {
+		return fmt.Errorf("%w: invalid VP8X flags %#x", ErrFormat, uint32(c.VP8X.Flags))
+	}
+	if uint64(c.VP8X.CanvasWidth)*uint64(c.VP8X.CanvasHeight) > maxCanvasPixels {
+		return fmt.Errorf("%w: too large canvas %dx%d", ErrFormat, c.VP8X.CanvasWidth, c.VP8X.CanvasHeight)
+	}
+	c.Width, c.Height = c.VP8X.CanvasWidth, c.VP8X.CanvasHeight
+	c.HasAlpha = c.VP8X.Flags&FlagAlpha != 0
+	c.HasAnimation = c.VP8X.Flags&FlagAnimation != 0
+
+	// Validate the order of known chunks, and collect image chunks
+	var images []*Chunk
+	order := 0
+	seen := make(map[FourCC]bool)
+	for i := 1; i < len(c.Chunks); i++ {
+		chunk := &c.Chunks[i]
+		o, known := chunkOrder[chunk.ID]
+		if !known {
+			continue
+		}
+		if o < order || chunk.ID == FourCCVP8X {
+			return fmt.Errorf("%w: unexpected position of %q chunk", ErrFormat, chunk.ID)
+		}
+		if seen[chunk.ID] && chunk.ID != FourCCANMF {
+			return fmt.Errorf("%w: duplicated %q chunk", ErrFormat, chunk.ID)
+		}
+		order, seen[chunk.ID] = o, true
+		if o == chunkOrder[FourCCVP8] {
+			images = append(images, chunk)
+		}
+	}
+
+	if c.HasAnimation {
+		return c.parseAnimation(images)
+	}
+	return c.parseStill(images)
+}
+
+// parseStill parses image chunks of still image in the extended format.
+func (c *Container) parseStill(images []*Chunk) error {
+	if c.Chunk(FourCCANIM) != nil {
+		return fmt.Errorf("%w: ANIM chunk without animation flag", ErrFormat)
+	}
+
+	b, err := parseFrameData(images)
+	if err != nil {
+		return err
+	}
+	if b.width != c.Width || b.height != c.Height {
+		return fmt.Errorf("%w: image size %dx%d differs from canvas size %dx%d", ErrFormat, b.width, b.height, c.Width, c.Height)
+	}
+	c.Format = b.format
+	return nil
+}
+
+// parseAnimation parses ANIM and ANMF chunks in the extended format.
+func (c *Container) parseAnimation(images []*Chunk) error {
+	anim := c.Chunk(FourCCANIM)
+	if anim == nil {
+		return fmt.Errorf("%w: missing ANIM chunk", ErrFormat)
+	}
+	if len(anim.Data) < 6 {
+		return fmt.Errorf("%w: invalid size of ANIM chunk %d", ErrFormat, len(anim.Data))
+	}
+	c.Animation = &Animation{
+		BackgroundColor: binary.LittleEndian.Uint32(anim.Data[0:4]),
+		LoopCount:       int(binary.LittleEndian.Uint16(anim.Data[4:6])),
+	}
+
+	for _, chunk := range images {
+		if chunk.ID != FourCCANMF {
+			return fmt.Errorf("%w: unexpected %q chunk in animation", ErrFormat, chunk.ID)
+		}
+		f, err := parseFrame(chunk)
+		if err != nil {
+			return err
+		}
+		if f.X+f.Width > c.Width || f.Y+f.Height > c.Height {
+			return fmt.Errorf("%w: frame exceeds canvas", ErrFormat)
+		}
+		c.Frames = append(c.Frames, *f)
+	}
+	if len(c.Frames) == 0 {
+		return fmt.Errorf("%w: no frames in animation", ErrFormat)
+	}
+
+	c.Format = c.Frames[0].Format
+	for _, f := range c.Frames {
+		if f.Format != c.Format {
+			c.Format = FormatMixed
+		}
+	}
+	return nil
+}
+
+// parseFrame parses ANMF chunk.
+func parseFrame(chunk *Chunk) (*Frame, error) {
+	const headerSize = 16
+	if len(chunk.Data) < headerSize {
+		return nil, fmt.Errorf("%w: invalid size of ANMF chunk %d", ErrFormat, len(chunk.Data))
+	}
+	d := chunk.Data
+	f := &Frame{
+		X:                 int(uint24(d[0:3])) * 2,
+		Y:                 int(uint24(d[3:6])) * 2,
+		Width:             int(uint24(d[6:9])) + 1,
+		Height:            int(uint24(d[9:12])) + 1,
+		Duration:          time.Duration(uint24(d[12:15])) * time.Millisecond,
+		DisposeBackground: d[15]&0x01 != 0,
+		NoBlend:           d[15]&0x02 != 0,
+	}
+
+	var err error
+	if f.Chunks, err = splitChunks(d[headerSize:], chunk.Offset+chunkHeaderSize+headerSize); err != nil {
+		return nil, err
+	}
+
+	var images []*Chunk
+	for i := range f.Chunks {
+		switch f.Chunks[i].ID {
+		case FourCCALPH, FourCCVP8, FourCCVP8L:
+			images = append(images, &f.Chunks[i])
+		}
+	}
+	b, err := parseFrameData(images)
+	if err != nil {
+		return nil, err
+	}
+	if b.width != f.Width || b.height != f.Height {
+		return nil, fmt.Errorf("%w: image size %dx%d differs from frame size %dx%d", ErrFormat, b.width, b.height, f.Width, f.Height)
+	}
+	f.Format = b.format
+	return f, nil
+}
+
+// parseFrameData parses frame data, which consists of an optional ALPH chunk
+// followed by VP8 chunk, or a single VP8L chunk.
+func parseFrameData(images []*Chunk) (*bitstream, error) {
+	switch {
+	case len(images) == 1 && images[0].ID != FourCCALPH:
+		return parseBitstream(images[0])
+	case len(images) == 2 && images[0].ID == FourCCALPH && images[1].ID == FourCCVP8:
+		b, err := parseBitstream(images[1])
+		if err != nil {
+			return nil, err
+		}
+		b.hasAlpha = true
+		return b, nil
+	case len(images) == 0:
+		return nil, fmt.Errorf("%w: missing image data", ErrFormat)
+	}
+	return nil, fmt.Errorf("%w: invalid sequence of image chunks", ErrFormat)
+}
+
+// bitstream represents the properties retrieved from VP8 or VP8L bitstream.
+type bitstream struct {
+	width, height int
+	hasAlpha      bool
+	format        Format
+}
+
+// parseBitstream parses the header of VP8 or VP8L bitstream.
+func parseBitstream(chunk *Chunk) (*bitstream, error) {
+	d := chunk.Data
+	switch chunk.ID {
+	case FourCCVP8:
+		// Frame tag (3 bytes), start code (3 bytes) and dimensions (4 bytes)
+		if len(d) < 10 {
+			return nil, fmt.Errorf("%w: too short VP8 bitstream", ErrFormat)
+		}
+		tag := uint24(d[0:3])
+		keyFrame := tag&0x01 == 0
+		profile := (tag >> 1) & 0x07
+		showFrame := (tag>>4)&0x01 != 0
+		partitionLength := tag >> 5
+		if !keyFrame || profile > 3 || !showFrame || int(partitionLength) >= len(d) {
+			return nil, fmt.Errorf("%w: invalid VP8 frame header", ErrFormat)
+		}
+		if d[3] != 0x9d || d[4] != 0x01 || d[5] != 0x2a {
+			return nil, fmt.Errorf("%w: invalid VP8 start code", ErrFormat)
+		}
+		b := &bitstream{
+			width:  int(binary.LittleEndian.Uint16(d[6:8]) & 0x3fff),
+			height: int(binary.LittleEndian.Uint16(d[8:10]) & 0x3fff),
+			format: FormatLossy,
+		}
+		if b.width == 0 || b.height == 0 {
+			return nil, fmt.Errorf("%w: invalid VP8 dimensions", ErrFormat)
+		}
+		return b, nil
+
+	case FourCCVP8L:
+		// Signature (1 byte) and 14-bit width, 14-bit height, alpha and version
+		if len(d) < 5 || d[0] != 0x2f {
+			return nil, fmt.Errorf("%w: invalid VP8L signature", ErrFormat)
+		}
+		bits := binary.LittleEndian.Uint32(d[1:5])
+		if bits>>29 != 0 {
+			return nil, fmt.Errorf("%w: invalid VP8L version", ErrFormat)
+		}
+		return &bitstream{
+			width:    int(bits&0x3fff) + 1,
+			height:   int((bits>>14)&0x3fff) + 1,
+			hasAlpha: (bits>>28)&0x01 != 0,
+			format:   FormatLossless,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: unexpected %q chunk as bitstream", ErrFormat, chunk.ID)
+}
+
+// splitChunks splits data into chunks. offset is the offset of data from the
+// beginning of the whole data.
+func splitChunks(data []byte, offset int64) ([]Chunk, error) {
+	var chunks []Chunk
+	for pos := 0; pos < len(data); {
+		if len(data)-pos < chunkHeaderSize {
+			return nil, fmt.Errorf("%w: %d trailing bytes", ErrFormat, len(data)-pos)
+		}
+		h := ChunkHeader{
+			ID:   FourCC(data[pos : pos+4]),
+			Size: binary.LittleEndian.Uint32(data[pos+4 : pos+8]),
+		}
+		start := pos + chunkHeaderSize
+		padded := int64(h.Size) + int64(h.Size&1)
+		if padded > int64(len(data)-start) {
+			return nil, fmt.Errorf("%w: size of %q chunk %d exceeds its container", ErrFormat, h.ID, h.Size)
+		}
+		chunks = append(chunks, Chunk{
+			ChunkHeader: h,
+			Offset:      offset + int64(pos),
+			Data:        data[start : start+int(h.Size)],
+		})
+		pos = start + int(padded)
+	}
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("%w: no chunks", ErrFormat)
+	}
+	return chunks, nil
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
@@ -0,0 +1,302 @@
+package container_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pixiv/go-libwebp/container"
+	"github.com/pixiv/go-libwebp/test/util"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		file     string
+		width    int
+		height   int
+		hasAlpha bool
+		extended bool
+	}{
+		{"butterfly.webp", 1024, 768, false, false},
+		{"cosmos.webp", 1024, 768, false, false},
+		{"fizyplankton.webp", 386, 395, true, true},
+		{"kinkaku.webp", 1024, 768, false, false},
+		{"yellow-rose-3.webp", 400, 301, true, true},
+	}
+
+	for _, tt := range tests {
+		c, err := container.Parse(util.ReadFile(tt.file))
+		if err != nil {
+			t.Errorf("Got Error: %v", err)
+			continue
+		}
+		if c.Width != tt.width || c.Height != tt.height {
+			t.Errorf("Expected size of %v: %dx%d, but got %dx%d", tt.file, tt.width, tt.height, c.Width, c.Height)
+		}
+		if c.HasAlpha != tt.hasAlpha {
+			t.Errorf("Expected HasAlpha of %v: %v, but got %v", tt.file, tt.hasAlpha, c.HasAlpha)
+		}
+		if got := c.VP8X != nil; got != tt.extended {
+			t.Errorf("Expected extended format of %v: %v, but got %v", tt.file, tt.extended, got)
+		}
+		if c.Format != container.FormatLossy {
+			t.Errorf("Expected Format of %v: %v, but got %v", tt.file, container.FormatLossy, c.Format)
+		}
+		if c.Chunk(container.FourCCVP8) == nil {
+			t.Errorf("Expected VP8 chunk in %v", tt.file)
+		}
+	}
+}
+
+func TestParseAnimation(t *testing.T) {
+	data := riff(
+		vp8x(container.FlagAnimation|container.FlagAlpha, 64, 48),
+		chunk("ANIM", []byte{0x33, 0x22, 0x11, 0xff, 0x02, 0x00}),
+		anmf(0, 0, 64, 48, 100, 0, chunk("VP8L", vp8l(64, 48, true))),
+		anmf(10, 20, 32, 16, 200, 0x03, chunk("VP8L", vp8l(32, 16, false))),
+	)
+
+	c, err := container.Parse(data)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if !c.HasAnimation || c.Format != container.FormatLossless {
+		t.Errorf("Expected lossless animation, but got HasAnimation: %v, Format: %v", c.HasAnimation, c.Format)
+	}
+	if c.Animation.LoopCount != 2 || c.Animation.BackgroundColor != 0xff112233 {
+		t.Errorf("Unexpected animation parameters: %+v", c.Animation)
+	}
+	if len(c.Frames) != 2 {
+		t.Fatalf("Expected 2 frames, but got %d", len(c.Frames))
+	}
+	f := c.Frames[1]
+	if f.X != 10 || f.Y != 20 || f.Width != 32 || f.Height != 16 || f.Duration != 200*time.Millisecond || !f.DisposeBackground || !f.NoBlend {
+		t.Errorf("Unexpected frame: %+v", f)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	valid := util.ReadFile("cosmos.webp")
+	oddChunk := riff(chunk("VP8L", vp8l(1, 1, false)))
+	oddChunk = oddChunk[:len(oddChunk)-1]
+	binary.LittleEndian.PutUint32(oddChunk[4:8], uint32(len(oddChunk)-8))
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, container.ErrTruncated},
+		{"bad magic", append([]byte("RIFX"), valid[4:]...), container.ErrFormat},
+		{"truncated", valid[:len(valid)/2], container.ErrTruncated},
+		{"missing padding", oddChunk, container.ErrFormat},
+		{"chunk exceeds RIFF", riff(append(chunk("VP8L", vp8l(1, 1, false))[:4], 0xff, 0xff, 0xff, 0x00, 0x2f, 0, 0, 0, 0, 0)), container.ErrFormat},
+		{"unknown first chunk", riff(chunk("ABCD", []byte{0, 0})), container.ErrFormat},
+		{"extra chunk in simple format", riff(chunk("VP8L", vp8l(1, 1, false)), chunk("EXIF", []byte{0, 0})), container.ErrFormat},
+		{"invalid flags", riff(vp8x(0x01, 1, 1), chunk("VP8L", vp8l(1, 1, false))), container.ErrFormat},
+		{"size mismatch", riff(vp8x(0, 2, 2), chunk("VP8L", vp8l(1, 1, false))), container.ErrFormat},
+		{"wrong order", riff(vp8x(container.FlagICC, 1, 1), chunk("VP8L", vp8l(1, 1, false)), chunk("ICCP", []byte{0, 0})), container.ErrFormat},
+		{"missing ANIM", riff(vp8x(container.FlagAnimation, 1, 1), anmf(0, 0, 1, 1, 100, 0, chunk("VP8L", vp8l(1, 1, false)))), container.ErrFormat},
+		{"frame exceeds canvas", riff(vp8x(container.FlagAnimation, 1, 1), chunk("ANIM", make([]byte, 6)), anmf(2, 0, 1, 1, 100, 0, chunk("VP8L", vp8l(1, 1, false)))), container.ErrFormat},
+	}
+
+	for _, tt := range tests {
+		if _, err := container.Parse(tt.data); !errors.Is(err, tt.err) {
+			t.Errorf("%v: Expected %v, but got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestReader(t *testing.T) {
+	data := riff(
+		vp8x(container.FlagEXIF, 1, 1),
+		chunk("VP8L", vp8l(1, 1, false)),
+		chunk("EXIF", []byte("odd")),
+	)
+
+	r, err := container.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if int(r.Size())+8 != len(data) {
+		t.Errorf("Expected size: %d, but got %d", len(data)-8, r.Size())
+	}
+
+	var ids []container.FourCC
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+		ids = append(ids, h.ID)
+
+		if h.ID == container.FourCCEXIF {
+			payload, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("Got Error: %v", err)
+			}
+			if string(payload) != "odd" {
+				t.Errorf("Expected payload: %q, but got %q", "odd", payload)
+			}
+		}
+	}
+
+	expect := []container.FourCC{container.FourCCVP8X, container.FourCCVP8L, container.FourCCEXIF}
+	if len(ids) != len(expect) {
+		t.Fatalf("Expected chunks: %q, but got %q", expect, ids)
+	}
+	for i := range ids {
+		if ids[i] != expect[i] {
+			t.Errorf("Expected chunks: %q, but got %q", expect, ids)
+		}
+	}
+}
+
+func TestReaderWithTruncatedData(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	r, err := container.NewReader(bytes.NewReader(data[:len(data)/2]))
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if _, err := r.Next(); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if _, err := io.ReadAll(r); err != container.ErrTruncated {
+		t.Errorf("Expected %v, but got %v", container.ErrTruncated, err)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	x := &container.VP8X{Flags: container.FlagICC | container.FlagAlpha | container.FlagXMP, CanvasWidth: 64, CanvasHeight: 48}
+	vp8xChunk, err := x.Chunk()
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	bitstream := append(vp8l(64, 48, true), 0xaa, 0xbb)
+	data, err := container.Append([]byte("prefix"), vp8xChunk,
+		container.Chunk{ChunkHeader: container.ChunkHeader{ID: container.FourCCICCP}, Data: []byte("icc")},
+		container.Chunk{ChunkHeader: container.ChunkHeader{ID: container.FourCCVP8L}, Data: bitstream},
+		container.Chunk{ChunkHeader: container.ChunkHeader{ID: container.FourCCXMP}, Data: []byte("<xmp/>")},
+	)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	expect := riff(
+		vp8x(container.FlagICC|container.FlagAlpha|container.FlagXMP, 64, 48),
+		chunk("ICCP", []byte("icc")),
+		chunk("VP8L", bitstream),
+		chunk("XMP ", []byte("<xmp/>")),
+	)
+	if !bytes.Equal(data, append([]byte("prefix"), expect...)) {
+		t.Errorf("Expected %x, but got %x", expect, data)
+	}
+
+	c, err := container.Parse(data[len("prefix"):])
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if *c.VP8X != *x || !c.HasAlpha || c.Format != container.FormatLossless {
+		t.Errorf("Unexpected container: %+v", c)
+	}
+}
+
+func TestAppendInvalid(t *testing.T) {
+	for _, x := range []container.VP8X{
+		{Flags: 0x01, CanvasWidth: 1, CanvasHeight: 1},
+		{CanvasWidth: 0, CanvasHeight: 1},
+		{CanvasWidth: 1 << 24, CanvasHeight: 1 << 24},
+		{CanvasWidth: 1<<24 + 1, CanvasHeight: 1},
+	} {
+		if _, err := x.Chunk(); !errors.Is(err, container.ErrFormat) {
+			t.Errorf("%+v: Expected %v, but got %v", x, container.ErrFormat, err)
+		}
+	}
+	if _, err := container.Append(nil, container.Chunk{ChunkHeader: container.ChunkHeader{ID: "VP8"}}); !errors.Is(err, container.ErrFormat) {
+		t.Errorf("Expected %v, but got %v", container.ErrFormat, err)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add(util.ReadFile("fizyplankton.webp"))
+	f.Add(riff(chunk("VP8L", vp8l(1, 1, false))))
+	f.Add(riff(
+		vp8x(container.FlagAnimation, 64, 48),
+		chunk("ANIM", make([]byte, 6)),
+		anmf(0, 0, 64, 48, 100, 0, chunk("VP8L", vp8l(64, 48, false))),
+	))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		container.Parse(data)
+
+		r, err := container.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		for {
+			if _, err := r.Next(); err != nil {
+				return
+			}
+			if _, err := io.Copy(io.Discard, r); err != nil {
+				return
+			}
+		}
+	})
+}
+
+func riff(chunks ...[]byte) []byte {
+	payload := bytes.Join(chunks, nil)
+	b := make([]byte, 12, 12+len(payload))
+	copy(b[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(b[4:8], uint32(4+len(payload)))
+	copy(b[8:12], "WEBP")
+	return append(b, payload...)
+}
+
+func chunk(id string, payload []byte) []byte {
+	b := make([]byte, 8, 8+len(payload)+1)
+	copy(b[0:4], id)
+	binary.LittleEndian.PutUint32(b[4:8], uint32(len(payload)))
+	b = append(b, payload...)
+	if len(payload)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func putUint24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+func vp8x(flags container.Flags, width, height int) []byte {
+	payload := make([]byte, 10)
+	binary.LittleEndian.PutUint32(payload[0:4], uint32(flags))
+	putUint24(payload[4:7], width-1)
+	putUint24(payload[7:10], height-1)
+	return chunk("VP8X", payload)
+}
+
+func vp8l(width, height int, alpha bool) []byte {
+	bits := uint32(width-1) | uint32(height-1)<<14
+	if alpha {
+		bits |= 1 << 28
+	}
+	payload := []byte{0x2f, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(payload[1:5], bits)
+	return payload
+}
+
+func anmf(x, y, width, height, duration int, flags byte, data ...[]byte) []byte {
+	header := make([]byte, 16)
+	putUint24(header[0:3], x/2)
+	putUint24(header[3:6], y/2)
+	putUint24(header[6:9], width-1)
+	putUint24(header[9:12], height-1)
+	putUint24(header[12:15], duration)
+	header[15] = flags
+	return chunk("ANMF", append(header, bytes.Join(data, nil)...))
+}
@@ -0,0 +1,136 @@
+package container
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	riffHeaderSize  = 12
+	chunkHeaderSize = 8
+)
+
+// ErrFormat is returned when the data stream is not a valid WebP container.
+var ErrFormat = errors.New("container: invalid WebP format")
+
+// ErrTruncated is returned when the data stream ends before the size
+// specified in the RIFF header or chunk header.
+var ErrTruncated = errors.New("container: truncated WebP data")
+
+// ChunkHeader represents the header of a chunk.
+type ChunkHeader struct {
+	ID   FourCC // Chunk identifier
+	Size uint32 // Size of chunk payload in bytes, not including the padding byte
+}
+
+// Reader provides sequential access to the chunks of a WebP container.
+// The Next method advances to the next chunk, and Reader can be treated as an
+// io.Reader to access the payload of the chunk.
+type Reader struct {
+	r         io.Reader
+	size      uint32 // Size of the RIFF payload, including "WEBP"
+	remaining int64  // Bytes of the RIFF payload which are not read yet
+	chunk     int64  // Bytes of the current chunk payload which are not read yet
+	pad       int64  // Size of the padding byte of the current chunk
+}
+
+// NewReader creates a Reader reading from r. It reads and validates the RIFF
+// header.
+func NewReader(r io.Reader) (*Reader, error) {
+	var header [riffHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrTruncated
+		}
+		return nil, err
+	}
+
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WEBP" {
+		return nil, ErrFormat
+	}
+	size := binary.LittleEndian.Uint32(header[4:8])
+	if size < 4+chunkHeaderSize || size%2 != 0 {
+		return nil, fmt.Errorf("%w: invalid RIFF size %d", ErrFormat, size)
+	}
+
+	return &Reader{r: r, size: size, remaining: int64(size) - 4}, nil
+}
+
+// Size returns the size of the RIFF payload specified in the RIFF header. The
+// whole file size is Size() + 8.
+func (r *Reader) Size() uint32 {
+	return r.size
+}
+
+// Next advances to the next chunk and returns its header. The unread payload
+// of the current chunk is skipped. It returns io.EOF at the end of the RIFF
+// payload.
+func (r *Reader) Next() (*ChunkHeader, error) {
+	if err := r.skip(r.chunk + r.pad); err != nil {
+		return nil, err
+	}
+	r.chunk, r.pad = 0, 0
+
+	if r.remaining == 0 {
+		return nil, io.EOF
+	}
+	if r.remaining < chunkHeaderSize {
+		return nil, fmt.Errorf("%w: %d trailing bytes in RIFF payload", ErrFormat, r.remaining)
+	}
+
+	var header [chunkHeaderSize]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		return nil, truncated(err)
+	}
+	r.remaining -= chunkHeaderSize
+
+	h := &ChunkHeader{
+		ID:   FourCC(header[0:4]),
+		Size: binary.LittleEndian.Uint32(header[4:8]),
+	}
+	r.chunk, r.pad = int64(h.Size), int64(h.Size&1)
+	if r.chunk+r.pad > r.remaining {
+		return nil, fmt.Errorf("%w: size of %q chunk %d exceeds RIFF payload", ErrFormat, h.ID, h.Size)
+	}
+	r.remaining -= r.chunk + r.pad
+
+	return h, nil
+}
+
+// Read reads the payload of the current chunk.
+func (r *Reader) Read(p []byte) (n int, err error) {
+	if r.chunk == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.chunk {
+		p = p[:r.chunk]
+	}
+	n, err = r.r.Read(p)
+	r.chunk -= int64(n)
+	if err == io.EOF {
+		if r.chunk > 0 {
+			return n, ErrTruncated
+		}
+		err = nil
+	}
+	return
+}
+
+func (r *Reader) skip(n int64) error {
+	if n == 0 {
+		return nil
+	}
+	if _, err := io.CopyN(io.Discard, r.r, n); err != nil {
+		return truncated(err)
+	}
+	return nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrTruncated
+	}
+	return err
+}
@@ -0,0 +1,61 @@
+package container
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// maxCanvasSize is the upper limit of canvas width and height.
+const maxCanvasSize = 1 << 24
+
+// Append appends WebP container of the chunks to dst, and returns the
+// extended slice. Only ID and Data of the chunks are used, and the sizes and
+// the padding bytes are added. It returns ErrFormat if the container is too
+// large.
+func Append(dst []byte, chunks ...Chunk) ([]byte, error) {
+	size := uint64(4)
+	for _, chunk := range chunks {
+		if len(chunk.ID) != 4 {
+			return nil, fmt.Errorf("%w: invalid chunk identifier %q", ErrFormat, chunk.ID)
+		}
+		size += chunkHeaderSize + uint64(len(chunk.Data)+len(chunk.Data)&1)
+	}
+	if size > math.MaxUint32-1 {
+		return nil, fmt.Errorf("%w: too large container of %d bytes", ErrFormat, size)
+	}
+
+	dst = append(dst, "RIFF"...)
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(size))
+	dst = append(dst, "WEBP"...)
+	for _, chunk := range chunks {
+		dst = append(dst, chunk.ID...)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(len(chunk.Data)))
+		dst = append(dst, chunk.Data...)
+		if len(chunk.Data)&1 != 0 {
+			dst = append(dst, 0)
+		}
+	}
+	return dst, nil
+}
+
+// Chunk returns VP8X chunk of the contents. It returns ErrFormat if the flags
+// or the canvas size are invalid.
+func (x *VP8X) Chunk() (Chunk, error) {
+	if x.Flags&^validFlags != 0 {
+		return Chunk{}, fmt.Errorf("%w: invalid VP8X flags %#x", ErrFormat, uint32(x.Flags))
+	}
+	if x.CanvasWidth <= 0 || x.CanvasHeight <= 0 || x.CanvasWidth > maxCanvasSize || x.CanvasHeight > maxCanvasSize ||
+		uint64(x.CanvasWidth)*uint64(x.CanvasHeight) > maxCanvasPixels {
+		return Chunk{}, fmt.Errorf("%w: invalid canvas %dx%d", ErrFormat, x.CanvasWidth, x.CanvasHeight)
+	}
+
+	data := binary.LittleEndian.AppendUint32(make([]byte, 0, 10), uint32(x.Flags))
+	data = appendUint24(data, uint32(x.CanvasWidth-1))
+	data = appendUint24(data, uint32(x.CanvasHeight-1))
+	return Chunk{ChunkHeader: ChunkHeader{ID: FourCCVP8X, Size: uint32(len(data))}, Data: data}, nil
+}
+
+func appendUint24(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16))
+}
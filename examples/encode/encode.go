@@ -1,3 +1,5 @@
+//go:build cgo
+
 // Package main is an example implementation of WebP encoder.
 package main
 
@@ -0,0 +1,243 @@
+package vp8l
+
+import (
+	"math"
+)
+
+// Kinds of tokens
+const (
+	tokenLiteral = iota
+	tokenCache
+	tokenCopy
+)
+
+// token represents a literal pixel, an index of the color cache, or a backward
+// reference of the entropy-coded image.
+type token struct {
+	kind   uint8
+	value  uint32 // ARGB of literal, index of color cache, or distance code of copy
+	length int    // Number of pixels to copy
+}
+
+const (
+	// minCopyLength is the minimum length of backward references to use.
+	minCopyLength = 3
+	// maxCopyLength is the maximum length of backward references.
+	maxCopyLength = 4096
+	// maxWindowSize is the maximum distance of backward references.
+	maxWindowSize = 1<<20 - 120
+	// hashBits is the number of bits of the hash of pixel pairs.
+	hashBits = 18
+)
+
+// searchParams returns the maximum number of candidates and the maximum
+// distance to search backward references for, which are the same as libwebp.
+func searchParams(quality float32, xsize int) (iterations, window int) {
+	q := int(quality)
+	iterations = 8 + q*q/128
+	switch {
+	case q > 75:
+		window = maxWindowSize
+	case q > 50:
+		window = xsize << 8
+	case q > 25:
+		window = xsize << 6
+	default:
+		window = xsize << 4
+	}
+	return iterations, min(window, maxWindowSize)
+}
+
+// backwardReferences finds backward references in the image of xsize, and
+// returns the tokens to code it. The candidates are searched in a hash chain
+// of pixel pairs, after the pixel on the left and the one above.
+func backwardReferences(pix []uint32, xsize int, quality float32) []token {
+	iterations, window := searchParams(quality, xsize)
+	distanceCodes := newDistanceCodes(xsize)
+
+	head := make([]int32, 1<<hashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, len(pix))
+	insert := func(i int) {
+		if i+1 < len(pix) {
+			h := hashPair(pix[i], pix[i+1])
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+
+	tokens := make([]token, 0, len(pix)/2)
+	for i := 0; i < len(pix); {
+		maxLength := min(maxCopyLength, len(pix)-i)
+		bestLength, bestDistance := 0, 0
+		if maxLength >= minCopyLength {
+			for _, d := range [...]int{1, xsize} {
+				if d <= i {
+					if n := matchLength(pix, i-d, i, maxLength); n > bestLength {
+						bestLength, bestDistance = n, d
+					}
+				}
+			}
+			j := head[hashPair(pix[i], pix[i+1])]
+			for it := 0; j >= 0 && it < iterations && i-int(j) <= window && bestLength < maxLength; it++ {
+				if n := matchLength(pix, int(j), i, maxLength); n > bestLength {
+					bestLength, bestDistance = n, i-int(j)
+				}
+				j = prev[j]
+			}
+		}
+
+		if bestLength < minCopyLength {
+			tokens = append(tokens, token{kind: tokenLiteral, value: pix[i]})
+			insert(i)
+			i++
+			continue
+		}
+		tokens = append(tokens, token{kind: tokenCopy, value: uint32(distanceCodes.code(bestDistance)), length: bestLength})
+		for k := 0; k < bestLength; k++ {
+			insert(i + k)
+		}
+		i += bestLength
+	}
+	return tokens
+}
+
+func hashPair(a, b uint32) uint32 {
+	return (a*0x1e35a7bd ^ b*0x9e3779b1) >> (32 - hashBits)
+}
+
+// matchLength returns the number of pixels up to maxLength, which are the same
+// from src and dst.
+func matchLength(pix []uint32, src, dst, maxLength int) int {
+	n := 0
+	for n < maxLength && pix[src+n] == pix[dst+n] {
+		n++
+	}
+	return n
+}
+
+// distanceCodes maps the distances in the image to the shortest distance
+// codes.
+type distanceCodes map[int]int
+
+func newDistanceCodes(xsize int) distanceCodes {
+	codes := distanceCodes{}
+	for code := len(distanceMap); code > 0; code-- {
+		codes[planeCodeToDistance(xsize, code)] = code
+	}
+	return codes
+}
+
+// code returns the distance code of dist, which is the inverse of
+// planeCodeToDistance.
+func (c distanceCodes) code(dist int) int {
+	if code, ok := c[dist]; ok {
+		return code
+	}
+	return dist + len(distanceMap)
+}
+
+// colorCacheKey returns the index of the color cache of bits for argb.
+func colorCacheKey(argb uint32, bits int) uint32 {
+	return (0x1e35a7bd * argb) >> (32 - bits)
+}
+
+// applyColorCache replaces the literals which hit the color cache of bits with
+// its indices. The tokens are left unchanged if update is false. It returns
+// the histograms of the tokens.
+func applyColorCache(pix []uint32, tokens []token, bits int, update bool) *histograms {
+	h := newHistograms(bits)
+	var cache []uint32
+	if bits > 0 {
+		cache = make([]uint32, 1<<bits)
+	}
+	pos := 0
+	for i := range tokens {
+		t := tokens[i]
+		if t.kind == tokenCopy {
+			if cache != nil {
+				for _, p := range pix[pos : pos+t.length] {
+					cache[colorCacheKey(p, bits)] = p
+				}
+			}
+			pos += t.length
+			h.add(t)
+			continue
+		}
+
+		// The cache starts with zeros, which decoders also look up.
+		p := pix[pos]
+		if cache != nil {
+			key := colorCacheKey(p, bits)
+			if cache[key] == p {
+				t = token{kind: tokenCache, value: key}
+			} else {
+				t = token{kind: tokenLiteral, value: p}
+				cache[key] = p
+			}
+		}
+		if update {
+			tokens[i] = t
+		}
+		pos++
+		h.add(t)
+	}
+	return h
+}
+
+// histograms holds the histograms of the symbols of the prefix codes.
+type histograms [numCodes][]uint32
+
+func newHistograms(cacheBits int) *histograms {
+	h := &histograms{}
+	h[codeGreen] = make([]uint32, numLiteralCodes+numLengthCodes+colorCacheSize(cacheBits))
+	h[codeRed] = make([]uint32, numLiteralCodes)
+	h[codeBlue] = make([]uint32, numLiteralCodes)
+	h[codeAlpha] = make([]uint32, numLiteralCodes)
+	h[codeDistance] = make([]uint32, numDistanceCodes)
+	return h
+}
+
+func colorCacheSize(bits int) int {
+	if bits == 0 {
+		return 0
+	}
+	return 1 << bits
+}
+
+// add counts the symbols of the token.
+func (h *histograms) add(t token) {
+	switch t.kind {
+	case tokenLiteral:
+		h[codeGreen][(t.value>>8)&0xff]++
+		h[codeRed][(t.value>>16)&0xff]++
+		h[codeBlue][t.value&0xff]++
+		h[codeAlpha][t.value>>24]++
+	case tokenCache:
+		h[codeGreen][numLiteralCodes+numLengthCodes+int(t.value)]++
+	case tokenCopy:
+		symbol, _, _ := prefixEncode(t.length)
+		h[codeGreen][numLiteralCodes+symbol]++
+		symbol, _, _ = prefixEncode(int(t.value))
+		h[codeDistance][symbol]++
+	}
+}
+
+// cost estimates the number of bits to code the symbols by their entropy.
+func (h *histograms) cost() float64 {
+	bits := 0.0
+	for _, histogram := range h {
+		total := 0.0
+		for _, c := range histogram {
+			total += float64(c)
+		}
+		for _, c := range histogram {
+			if c > 0 {
+				bits += float64(c) * math.Log2(total/float64(c))
+			}
+		}
+	}
+	return bits
+}
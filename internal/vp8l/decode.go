@@ -0,0 +1,416 @@
+// Package vp8l implements a decoder and an encoder of WebP lossless (VP8L)
+// bitstream in pure Go. It decodes the same pixels as libwebp, including
+// invalid bitstreams which libwebp accepts, and DecodeTo crops and scales them
+// in the same way as libwebp.
+//
+// See https://developers.google.com/speed/webp/docs/webp_lossless_bitstream_specification
+// for the specification of the format.
+package vp8l
+
+import (
+	"errors"
+)
+
+var (
+	// ErrTruncated is returned when the bitstream ends unexpectedly.
+	ErrTruncated = errors.New("vp8l: truncated bitstream")
+	// ErrFormat is returned when the bitstream is invalid.
+	ErrFormat = errors.New("vp8l: invalid bitstream")
+)
+
+const (
+	// headerSize is the size of the signature and the image size.
+	headerSize = 5
+	// signature is the first byte of VP8L bitstream.
+	signature = 0x2f
+
+	// Number of symbols of each alphabet without the color cache.
+	numLiteralCodes  = 256
+	numLengthCodes   = 24
+	numDistanceCodes = 40
+	// maxCacheBits is the maximum number of bits of the color cache.
+	maxCacheBits = 11
+)
+
+// Indices of prefix codes in a group.
+const (
+	codeGreen = iota
+	codeRed
+	codeBlue
+	codeAlpha
+	codeDistance
+	numCodes
+)
+
+// codeLengthOrder is the order of code lengths of the code length code.
+var codeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// distanceMap maps the first 120 distance codes to (dy << 4 | (8 - dx)).
+var distanceMap = [120]uint8{
+	0x18, 0x07, 0x17, 0x19, 0x28, 0x06, 0x27, 0x29, 0x16, 0x1a,
+	0x26, 0x2a, 0x38, 0x05, 0x37, 0x39, 0x15, 0x1b, 0x36, 0x3a,
+	0x25, 0x2b, 0x48, 0x04, 0x47, 0x49, 0x14, 0x1c, 0x35, 0x3b,
+	0x46, 0x4a, 0x24, 0x2c, 0x58, 0x45, 0x4b, 0x34, 0x3c, 0x03,
+	0x57, 0x59, 0x13, 0x1d, 0x56, 0x5a, 0x23, 0x2d, 0x44, 0x4c,
+	0x55, 0x5b, 0x33, 0x3d, 0x68, 0x02, 0x67, 0x69, 0x12, 0x1e,
+	0x66, 0x6a, 0x22, 0x2e, 0x54, 0x5c, 0x43, 0x4d, 0x65, 0x6b,
+	0x32, 0x3e, 0x78, 0x01, 0x77, 0x79, 0x53, 0x5d, 0x11, 0x1f,
+	0x64, 0x6c, 0x42, 0x4e, 0x76, 0x7a, 0x21, 0x2f, 0x75, 0x7b,
+	0x31, 0x3f, 0x63, 0x6d, 0x52, 0x5e, 0x00, 0x74, 0x7c, 0x41,
+	0x4f, 0x10, 0x20, 0x62, 0x6e, 0x30, 0x73, 0x7d, 0x51, 0x5f,
+	0x40, 0x72, 0x7e, 0x61, 0x6f, 0x50, 0x71, 0x7f, 0x60, 0x70,
+}
+
+// Header represents the header of VP8L bitstream.
+type Header struct {
+	Width    int  // Image width in pixels
+	Height   int  // Image height in pixels
+	HasAlpha bool // True if the encoder reports that alpha channel is used
+}
+
+// DecodeHeader decodes the header of VP8L bitstream.
+func DecodeHeader(data []byte) (Header, error) {
+	if len(data) < headerSize {
+		return Header{}, ErrTruncated
+	}
+	if data[0] != signature {
+		return Header{}, ErrFormat
+	}
+	bits := uint32(data[1]) | uint32(data[2])<<8 | uint32(data[3])<<16 | uint32(data[4])<<24
+	if bits>>29 != 0 {
+		// Unknown version
+		return Header{}, ErrFormat
+	}
+	return Header{
+		Width:    int(bits&0x3fff) + 1,
+		Height:   int((bits>>14)&0x3fff) + 1,
+		HasAlpha: (bits>>28)&0x01 != 0,
+	}, nil
+}
+
+// Decode decodes VP8L bitstream, and returns its header and the pixels in ARGB
+// order, whose stride is the width of the image.
+func Decode(data []byte) (Header, []uint32, error) {
+	h, err := DecodeHeader(data)
+	if err != nil {
+		return Header{}, nil, err
+	}
+
+	d := &decoder{br: bitReader{data: data[headerSize:]}}
+	xsize := h.Width
+	for d.br.read(1) == 1 {
+		if err := d.readTransform(&xsize, h.Height); err != nil {
+			return Header{}, nil, err
+		}
+	}
+	pix, err := d.decodeImageStream(xsize, h.Height, true)
+	if err != nil {
+		return Header{}, nil, err
+	}
+
+	for i := len(d.transforms) - 1; i >= 0; i-- {
+		pix = d.transforms[i].inverse(pix, h.Height)
+	}
+	return h, pix, nil
+}
+
+// decoder holds the state of decoding.
+type decoder struct {
+	br         bitReader
+	transforms []transform // Transforms in the order of the bitstream
+	seen       uint        // Set of transform types already read
+	lengths    []int       // Buffer for code lengths
+}
+
+// errorAtEOS returns ErrTruncated if bits beyond the end of data have been
+// read, otherwise ErrFormat.
+func (d *decoder) errorAtEOS() error {
+	if d.br.eos() {
+		return ErrTruncated
+	}
+	return ErrFormat
+}
+
+// decodeImageStream decodes the entropy-coded image of xsize x ysize. Only the
+// main image (level0) may have the meta prefix codes.
+func (d *decoder) decodeImageStream(xsize, ysize int, level0 bool) ([]uint32, error) {
+	cacheBits := 0
+	if d.br.read(1) == 1 {
+		cacheBits = int(d.br.read(4))
+		if cacheBits < 1 || cacheBits > maxCacheBits {
+			return nil, d.errorAtEOS()
+		}
+	}
+
+	groups, meta, err := d.readHuffmanCodes(xsize, ysize, cacheBits, level0)
+	if err != nil {
+		return nil, err
+	}
+
+	pix := make([]uint32, xsize*ysize)
+	if err := d.decodeImageData(pix, xsize, groups, meta, cacheBits); err != nil {
+		return nil, err
+	}
+	return pix, nil
+}
+
+// metaCodes maps blocks of the image to the groups of prefix codes.
+type metaCodes struct {
+	bits   int      // Block size in bits
+	xsize  int      // Number of blocks in a row
+	groups []uint32 // Index of group for each block
+}
+
+// group returns the index of the group for the pixel at (x, y).
+func (m *metaCodes) group(x, y int) uint32 {
+	if m == nil {
+		return 0
+	}
+	return m.groups[(y>>m.bits)*m.xsize+x>>m.bits]
+}
+
+// readHuffmanCodes reads the meta prefix codes and the groups of prefix codes.
+// The groups which are not used by any block are validated, but are not
+// returned, so that the number of groups is bounded by the number of blocks.
+func (d *decoder) readHuffmanCodes(xsize, ysize, cacheBits int, level0 bool) ([][numCodes]huffmanCode, *metaCodes, error) {
+	numGroups := 1
+	var meta *metaCodes
+	if level0 && d.br.read(1) == 1 {
+		bits := int(d.br.read(3)) + 2
+		m := &metaCodes{bits: bits, xsize: subSampleSize(xsize, bits)}
+		var err error
+		m.groups, err = d.decodeImageStream(m.xsize, subSampleSize(ysize, bits), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, p := range m.groups {
+			m.groups[i] = (p >> 8) & 0xffff
+			numGroups = max(numGroups, int(m.groups[i])+1)
+		}
+		meta = m
+	}
+
+	// Map the used groups to consecutive indices.
+	mapping := make([]int, numGroups)
+	used := 1
+	if meta != nil {
+		for i := range mapping {
+			mapping[i] = -1
+		}
+		used = 0
+		for i, g := range meta.groups {
+			if mapping[g] < 0 {
+				mapping[g] = used
+				used++
+			}
+			meta.groups[i] = uint32(mapping[g])
+		}
+	}
+
+	groups := make([][numCodes]huffmanCode, used)
+	var unused huffmanCode
+	for i := 0; i < numGroups; i++ {
+		for j := 0; j < numCodes; j++ {
+			size := numLiteralCodes
+			switch j {
+			case codeGreen:
+				size += numLengthCodes
+				if cacheBits > 0 {
+					size += 1 << cacheBits
+				}
+			case codeDistance:
+				size = numDistanceCodes
+			}
+
+			h := &unused
+			if mapping[i] >= 0 {
+				h = &groups[mapping[i]][j]
+			}
+			if err := d.readHuffmanCode(h, size); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return groups, meta, nil
+}
+
+// readHuffmanCode reads a prefix code of the alphabet size.
+func (d *decoder) readHuffmanCode(h *huffmanCode, size int) error {
+	if cap(d.lengths) < size {
+		d.lengths = make([]int, size)
+	}
+	lengths := d.lengths[:size]
+	clear(lengths)
+
+	if d.br.read(1) == 1 {
+		// Simple code of one or two symbols
+		numSymbols := d.br.read(1) + 1
+		firstBits := uint(1)
+		if d.br.read(1) == 1 {
+			firstBits = 8
+		}
+		if s := int(d.br.read(firstBits)); s < size {
+			lengths[s] = 1
+		}
+		if numSymbols == 2 {
+			if s := int(d.br.read(8)); s < size {
+				lengths[s] = 1
+			}
+		}
+	} else {
+		var codeLengthLengths [len(codeLengthOrder)]int
+		numCodes := int(d.br.read(4)) + 4
+		for i := 0; i < numCodes; i++ {
+			codeLengthLengths[codeLengthOrder[i]] = int(d.br.read(3))
+		}
+		if err := d.readCodeLengths(codeLengthLengths[:], lengths); err != nil {
+			return err
+		}
+	}
+
+	if d.br.eos() {
+		return ErrTruncated
+	}
+	if !h.build(lengths) {
+		return ErrFormat
+	}
+	return nil
+}
+
+// readCodeLengths reads the code lengths of symbols, which are coded by the
+// code length code.
+func (d *decoder) readCodeLengths(codeLengthLengths []int, lengths []int) error {
+	var h huffmanCode
+	if !h.build(codeLengthLengths) {
+		return d.errorAtEOS()
+	}
+
+	maxSymbol := len(lengths)
+	if d.br.read(1) == 1 {
+		n := 2 + 2*uint(d.br.read(3))
+		maxSymbol = 2 + int(d.br.read(n))
+		if maxSymbol > len(lengths) {
+			return d.errorAtEOS()
+		}
+	}
+
+	prev := 8
+	for s := 0; s < len(lengths) && maxSymbol > 0; maxSymbol-- {
+		l := h.decode(&d.br)
+		if l < 16 {
+			lengths[s] = l
+			s++
+			if l != 0 {
+				prev = l
+			}
+			continue
+		}
+
+		// Repeat the previous non-zero length (16) or zero (17, 18).
+		var repeat, length int
+		switch l {
+		case 16:
+			repeat, length = 3+int(d.br.read(2)), prev
+		case 17:
+			repeat = 3 + int(d.br.read(3))
+		default:
+			repeat = 11 + int(d.br.read(7))
+		}
+		if s+repeat > len(lengths) {
+			return d.errorAtEOS()
+		}
+		for ; repeat > 0; repeat-- {
+			lengths[s] = length
+			s++
+		}
+	}
+	return nil
+}
+
+// decodeImageData decodes the entropy-coded pixels into pix, whose stride is
+// xsize.
+func (d *decoder) decodeImageData(pix []uint32, xsize int, groups [][numCodes]huffmanCode, meta *metaCodes, cacheBits int) error {
+	var cache []uint32
+	if cacheBits > 0 {
+		cache = make([]uint32, 1<<cacheBits)
+	}
+	cached := 0 // Number of pixels inserted into the cache
+
+	x, y := 0, 0
+	for pos := 0; pos < len(pix); {
+		codes := &groups[meta.group(x, y)]
+		n := 1
+		switch code := codes[codeGreen].decode(&d.br); {
+		case code < numLiteralCodes:
+			r := codes[codeRed].decode(&d.br)
+			b := codes[codeBlue].decode(&d.br)
+			a := codes[codeAlpha].decode(&d.br)
+			pix[pos] = uint32(a)<<24 | uint32(r)<<16 | uint32(code)<<8 | uint32(b)
+
+		case code < numLiteralCodes+numLengthCodes:
+			n = d.readPrefixValue(code - numLiteralCodes)
+			dist := planeCodeToDistance(xsize, d.readPrefixValue(codes[codeDistance].decode(&d.br)))
+			if d.br.eos() {
+				return ErrTruncated
+			}
+			if pos < dist || len(pix)-pos < n {
+				return ErrFormat
+			}
+			// The source may overlap the destination.
+			for i := pos; i < pos+n; i++ {
+				pix[i] = pix[i-dist]
+			}
+
+		default:
+			for ; cached < pos; cached++ {
+				cache[(0x1e35a7bd*pix[cached])>>(32-cacheBits)] = pix[cached]
+			}
+			pix[pos] = cache[code-numLiteralCodes-numLengthCodes]
+		}
+
+		pos += n
+		x += n
+		if x >= xsize {
+			for x >= xsize {
+				x -= xsize
+				y++
+			}
+			// Stop at the end of row once the data is exhausted.
+			if d.br.eos() {
+				return ErrTruncated
+			}
+		}
+	}
+
+	if d.br.eos() {
+		return ErrTruncated
+	}
+	return nil
+}
+
+// readPrefixValue reads the extra bits of the prefix coded length or distance,
+// and returns the value.
+func (d *decoder) readPrefixValue(symbol int) int {
+	if symbol < 4 {
+		return symbol + 1
+	}
+	extraBits := uint(symbol-2) >> 1
+	offset := (2 + symbol&1) << extraBits
+	return offset + int(d.br.read(extraBits)) + 1
+}
+
+// planeCodeToDistance converts the distance code to the distance in pixels of
+// the image whose width is xsize.
+func planeCodeToDistance(xsize, code int) int {
+	if code > len(distanceMap) {
+		return code - len(distanceMap)
+	}
+	c := int(distanceMap[code-1])
+	dist := (c>>4)*xsize + 8 - c&0x0f
+	return max(dist, 1)
+}
+
+// subSampleSize returns the size of the image of size subsampled by 1<<bits.
+func subSampleSize(size, bits int) int {
+	return (size + 1<<bits - 1) >> bits
+}
@@ -0,0 +1,166 @@
+package vp8l
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// writeHeader writes the signature, the image size and the version.
+func (w *bitWriter) writeHeader(width, height int, alpha bool) {
+	w.write(signature, 8)
+	w.write(uint32(width-1), 14)
+	w.write(uint32(height-1), 14)
+	if alpha {
+		w.write(1, 1)
+	} else {
+		w.write(0, 1)
+	}
+	w.write(0, 3)
+}
+
+// writeSimpleCode writes a simple prefix code of a single 8-bit symbol.
+func (w *bitWriter) writeSimpleCode(symbol uint32) {
+	w.write(1, 1) // Simple code
+	w.write(0, 1) // One symbol
+	w.write(1, 1) // 8-bit symbol
+	w.write(symbol, 8)
+}
+
+// uniformImage returns the bitstream of the image filled with argb.
+func uniformImage(width, height int, argb uint32) []byte {
+	var w bitWriter
+	w.writeHeader(width, height, argb>>24 != 0xff)
+	w.write(0, 1) // No transforms
+	w.write(0, 1) // No color cache
+	w.write(0, 1) // No meta prefix codes
+	w.writeSimpleCode((argb >> 8) & 0xff)
+	w.writeSimpleCode((argb >> 16) & 0xff)
+	w.writeSimpleCode(argb & 0xff)
+	w.writeSimpleCode(argb >> 24)
+	w.writeSimpleCode(0)
+	return w.bytes()
+}
+
+func TestDecodeHeader(t *testing.T) {
+	h, err := DecodeHeader(uniformImage(300, 17, 0x80123456))
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if h != (Header{Width: 300, Height: 17, HasAlpha: true}) {
+		t.Errorf("Unexpected header: %+v", h)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	const argb = 0x80123456
+	h, pix, err := Decode(uniformImage(30, 7, argb))
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if len(pix) != h.Width*h.Height {
+		t.Fatalf("Expected %d pixels, but got %d", h.Width*h.Height, len(pix))
+	}
+	for i, p := range pix {
+		if p != argb {
+			t.Fatalf("Expected %#08x at %d, but got %#08x", argb, i, p)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	valid := uniformImage(4, 4, 0xff000000)
+
+	var duplicated bitWriter
+	duplicated.writeHeader(4, 4, false)
+	for i := 0; i < 2; i++ {
+		duplicated.write(1, 1)
+		duplicated.write(subtractGreenTransform, 2)
+	}
+
+	var invalidCache bitWriter
+	invalidCache.writeHeader(4, 4, false)
+	invalidCache.write(0, 1)
+	invalidCache.write(1, 1)
+	invalidCache.write(12, 4)
+
+	var emptyCode bitWriter
+	emptyCode.writeHeader(4, 4, false)
+	emptyCode.write(0, 3)
+	emptyCode.writeSimpleCode(0)
+	emptyCode.writeSimpleCode(0)
+	emptyCode.writeSimpleCode(0)
+	emptyCode.writeSimpleCode(0)
+	emptyCode.writeSimpleCode(40) // Out of the alphabet of distance
+	emptyCode.write(0, 8)
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, ErrTruncated},
+		{"short header", valid[:4], ErrTruncated},
+		{"invalid signature", append([]byte{0x2e}, valid[1:]...), ErrFormat},
+		{"invalid version", append(valid[:4:4], valid[4]|0x20), ErrFormat},
+		{"truncated", valid[:6], ErrTruncated},
+		{"duplicated transform", duplicated.bytes(), ErrFormat},
+		{"invalid color cache", append(invalidCache.bytes(), 0, 0), ErrFormat},
+		{"empty prefix code", emptyCode.bytes(), ErrFormat},
+	}
+
+	for _, tt := range tests {
+		if _, _, err := Decode(tt.data); !errors.Is(err, tt.err) {
+			t.Errorf("%v: Expected %v, but got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+// fuzzMaxPixels keeps the fuzzer from allocating huge images, since Decode
+// does not limit the size of images. Smaller images than fuzzMaxRoundTrip
+// pixels are encoded again.
+const (
+	fuzzMaxPixels    = 1 << 16
+	fuzzMaxRoundTrip = 1 << 12
+)
+
+func FuzzDecode(f *testing.F) {
+	f.Add(uniformImage(4, 4, 0xff000000))
+	f.Add(uniformImage(30, 7, 0x80123456))
+	for _, numColors := range []int{0, 3, 256} {
+		data, _, err := Encode(testImage(37, 19, numColors, true), 37, 19, Options{Method: 4, Quality: 75})
+		if err != nil {
+			f.Fatalf("Got Error: %v", err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		h, err := DecodeHeader(data)
+		if err != nil || h.Width*h.Height > fuzzMaxPixels {
+			return
+		}
+		h, pix, err := Decode(data)
+		if err != nil {
+			if !errors.Is(err, ErrFormat) && !errors.Is(err, ErrTruncated) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			return
+		}
+		if len(pix) != h.Width*h.Height {
+			t.Fatalf("Expected %d pixels, but got %d", h.Width*h.Height, len(pix))
+		}
+
+		if len(pix) > fuzzMaxRoundTrip {
+			return
+		}
+		// The decoded pixels survive the round trip.
+		encoded, _, err := Encode(pix, h.Width, h.Height, Options{Method: 0})
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+		if _, got, err := Decode(encoded); err != nil || !slices.Equal(got, pix) {
+			t.Errorf("Decoded pixels differ after the round trip: %v", err)
+		}
+	})
+}
@@ -0,0 +1,343 @@
+package vp8l
+
+import (
+	"errors"
+	"math"
+	"slices"
+)
+
+var (
+	// ErrImageSize is returned when the image is empty or too large to encode.
+	ErrImageSize = errors.New("vp8l: invalid image size")
+	// ErrAborted is returned when encoding is aborted by the progress hook.
+	ErrAborted = errors.New("vp8l: aborted")
+)
+
+// maxImageSize is the maximum width and height of the image.
+const maxImageSize = 1 << 14
+
+// Options specifies the parameters of encoding.
+type Options struct {
+	// Method is the trade-off between speed and size from 0 (fast) to 6
+	// (slower, smaller), which selects the transforms to try.
+	Method int
+	// Quality is the effort from 0 to 100 to search backward references.
+	Quality float32
+	// Progress is called with the progress in percent, and aborts encoding
+	// if it returns false. It may be nil.
+	Progress func(percent int) bool
+}
+
+// Stats represents the statistics of encoding.
+type Stats struct {
+	Transforms    uint // Set of 1 << type of the transforms used, which is the same as libwebp
+	TransformBits int  // Block size in bits of the predictor transform
+	CacheBits     int  // Number of bits of the color cache of the main image
+	PaletteSize   int  // Number of colors in the palette, if used
+	HeaderSize    int  // Size in bytes of the header, the transforms and the prefix codes
+	DataSize      int  // Size in bytes of the entropy-coded main image
+}
+
+// encoder holds the state of encoding.
+type encoder struct {
+	bw      bitWriter
+	options Options
+	stats   Stats
+}
+
+// Encode encodes the pixels in ARGB order of the image of width x height,
+// whose stride is width, into VP8L bitstream. The color indexing transform is
+// used for the image of up to 256 colors, and the subtract-green and the
+// predictor transforms are used for the others.
+func Encode(pix []uint32, width, height int, options Options) ([]byte, Stats, error) {
+	if width <= 0 || height <= 0 || width > maxImageSize || height > maxImageSize || len(pix) < width*height {
+		return nil, Stats{}, ErrImageSize
+	}
+	e := &encoder{options: options}
+	if err := e.report(0); err != nil {
+		return nil, Stats{}, err
+	}
+
+	argb := slices.Clone(pix[:width*height])
+	hasAlpha := false
+	for _, p := range argb {
+		if p>>24 != 0xff {
+			hasAlpha = true
+			break
+		}
+	}
+	e.bw.write(signature, 8)
+	e.bw.write(uint32(width-1), 14)
+	e.bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		e.bw.write(1, 1)
+	} else {
+		e.bw.write(0, 1)
+	}
+	e.bw.write(0, 3) // Version
+
+	xsize := width
+	if palette := findPalette(argb); palette != nil {
+		argb, xsize = e.applyColorIndexing(argb, width, height, palette)
+	} else {
+		e.applySubtractGreen(argb)
+		if err := e.report(10); err != nil {
+			return nil, Stats{}, err
+		}
+		argb = e.applyPredictor(argb, width, height)
+	}
+	e.bw.write(0, 1) // No more transforms
+	if err := e.report(40); err != nil {
+		return nil, Stats{}, err
+	}
+
+	e.encodeImageStream(argb, xsize, true)
+	data := e.bw.bytes()
+	e.stats.DataSize = len(data) - e.stats.HeaderSize
+	if err := e.report(100); err != nil {
+		return nil, Stats{}, err
+	}
+	return data, e.stats, nil
+}
+
+// report calls the progress hook, and returns ErrAborted if it asks to abort.
+func (e *encoder) report(percent int) error {
+	if e.options.Progress != nil && !e.options.Progress(percent) {
+		return ErrAborted
+	}
+	return nil
+}
+
+// writeTransform writes the type of the transform which follows.
+func (e *encoder) writeTransform(kind int) {
+	e.bw.write(1, 1)
+	e.bw.write(uint32(kind), 2)
+	e.stats.Transforms |= 1 << kind
+}
+
+// findPalette returns the sorted colors of the image, or nil if the image has
+// more than 256 colors.
+func findPalette(pix []uint32) []uint32 {
+	colors := map[uint32]struct{}{}
+	for i, p := range pix {
+		if i > 0 && p == pix[i-1] {
+			continue
+		}
+		if _, ok := colors[p]; !ok {
+			if len(colors) == 256 {
+				return nil
+			}
+			colors[p] = struct{}{}
+		}
+	}
+
+	palette := make([]uint32, 0, len(colors))
+	for c := range colors {
+		palette = append(palette, c)
+	}
+	slices.Sort(palette)
+	return palette
+}
+
+// applyColorIndexing writes the color indexing transform of the palette, and
+// returns the indices packed into the green channel, with their width.
+func (e *encoder) applyColorIndexing(pix []uint32, width, height int, palette []uint32) ([]uint32, int) {
+	e.writeTransform(colorIndexingTransform)
+	e.bw.write(uint32(len(palette)-1), 8)
+	e.stats.PaletteSize = len(palette)
+
+	// The palette is delta-coded.
+	deltas := make([]uint32, len(palette))
+	deltas[0] = palette[0]
+	for i := 1; i < len(palette); i++ {
+		deltas[i] = subPixels(palette[i], palette[i-1])
+	}
+	e.encodeImageStream(deltas, len(palette), false)
+
+	var bits int
+	switch n := len(palette); {
+	case n > 16:
+		bits = 0
+	case n > 4:
+		bits = 1
+	case n > 2:
+		bits = 2
+	default:
+		bits = 3
+	}
+	indices := make(map[uint32]uint32, len(palette))
+	for i, c := range palette {
+		indices[c] = uint32(i)
+	}
+
+	xsize := subSampleSize(width, bits)
+	bitsPerPixel := 8 >> bits
+	packed := make([]uint32, xsize*height)
+	for y := 0; y < height; y++ {
+		row := packed[y*xsize : (y+1)*xsize]
+		for x, p := range pix[y*width : (y+1)*width] {
+			row[x>>bits] |= indices[p] << (8 + (x&(1<<bits-1))*bitsPerPixel)
+		}
+		for x := range row {
+			row[x] |= 0xff000000
+		}
+	}
+	return packed, xsize
+}
+
+// applySubtractGreen writes the subtract-green transform, and subtracts green
+// from red and blue in place.
+func (e *encoder) applySubtractGreen(pix []uint32) {
+	e.writeTransform(subtractGreenTransform)
+	for i, p := range pix {
+		g := (p >> 8) & 0xff
+		pix[i] = subPixels(p, g<<16|g)
+	}
+}
+
+// predictorBits returns the block size in bits of the predictor transform for
+// the method, which is the same as libwebp.
+func predictorBits(method int) int {
+	maxBits := 5
+	switch {
+	case method < 4:
+		maxBits = 6
+	case method > 4:
+		maxBits = 4
+	}
+	return min(maxBits, max(7-method, 2))
+}
+
+// residualCost is the estimated cost of each residual of a channel, which is
+// smaller for the values close to zero.
+var residualCost = func() (cost [256]float32) {
+	for i := range cost {
+		cost[i] = float32(math.Log2(float64(1 + min(i, 256-i))))
+	}
+	return
+}()
+
+// applyPredictor writes the predictor transform, and returns the residuals of
+// the prediction. The mode of each block is selected to minimize the
+// residuals.
+func (e *encoder) applyPredictor(pix []uint32, width, height int) []uint32 {
+	bits := predictorBits(e.options.Method)
+	e.writeTransform(predictorTransform)
+	e.bw.write(uint32(bits-2), 3)
+	e.stats.TransformBits = bits
+
+	modes := []uint32{1, 2, 11}
+	if e.options.Method > 0 {
+		modes = []uint32{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13}
+	}
+
+	// The first row and the first column are predicted regardless of the
+	// modes.
+	residuals := make([]uint32, len(pix))
+	residuals[0] = subPixels(pix[0], 0xff000000)
+	for x := 1; x < width; x++ {
+		residuals[x] = subPixels(pix[x], pix[x-1])
+	}
+	for y := 1; y < height; y++ {
+		residuals[y*width] = subPixels(pix[y*width], pix[(y-1)*width])
+	}
+
+	blocksX, blocksY := subSampleSize(width, bits), subSampleSize(height, bits)
+	image := make([]uint32, blocksX*blocksY)
+	for by := 0; by < blocksY; by++ {
+		for bx := 0; bx < blocksX; bx++ {
+			x0, x1 := max(bx<<bits, 1), min((bx+1)<<bits, width)
+			y0, y1 := max(by<<bits, 1), min((by+1)<<bits, height)
+
+			best, bestCost := modes[0], float32(math.Inf(1))
+			for _, mode := range modes {
+				var cost float32
+				for y := y0; y < y1; y++ {
+					for x := x0; x < x1; x++ {
+						i := y*width + x
+						r := subPixels(pix[i], predict(mode, pix[i-1], pix[i-width], pix[i-width+1], pix[i-width-1]))
+						cost += residualCost[r>>24] + residualCost[(r>>16)&0xff] + residualCost[(r>>8)&0xff] + residualCost[r&0xff]
+					}
+				}
+				if cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+
+			image[by*blocksX+bx] = 0xff000000 | best<<8
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					i := y*width + x
+					residuals[i] = subPixels(pix[i], predict(best, pix[i-1], pix[i-width], pix[i-width+1], pix[i-width-1]))
+				}
+			}
+		}
+	}
+
+	e.encodeImageStream(image, blocksX, false)
+	return residuals
+}
+
+// encodeImageStream writes the entropy-coded image of xsize. Only the main
+// image (level0) uses the color cache, but neither of them uses the meta prefix
+// codes.
+func (e *encoder) encodeImageStream(pix []uint32, xsize int, level0 bool) {
+	tokens := backwardReferences(pix, xsize, e.options.Quality)
+
+	cacheBits := 0
+	if level0 {
+		// The number of bits is selected to minimize the entropy.
+		bestCost := applyColorCache(pix, tokens, 0, false).cost()
+		for bits := 1; bits < maxCacheBits; bits++ {
+			if cost := applyColorCache(pix, tokens, bits, false).cost(); cost < bestCost {
+				cacheBits, bestCost = bits, cost
+			}
+		}
+		e.stats.CacheBits = cacheBits
+	}
+	h := applyColorCache(pix, tokens, cacheBits, true)
+
+	if cacheBits > 0 {
+		e.bw.write(1, 1)
+		e.bw.write(uint32(cacheBits), 4)
+	} else {
+		e.bw.write(0, 1)
+	}
+	if level0 {
+		e.bw.write(0, 1) // No meta prefix codes
+	}
+
+	var codes [numCodes]prefixCode
+	for i := range codes {
+		codes[i] = e.bw.writeHuffmanCode(codeLengths(h[i], maxCodeLength))
+	}
+	if level0 {
+		e.stats.HeaderSize = e.bw.len() / 8
+	}
+
+	for _, t := range tokens {
+		switch t.kind {
+		case tokenLiteral:
+			e.bw.writeSymbol(&codes[codeGreen], int(t.value>>8)&0xff)
+			e.bw.writeSymbol(&codes[codeRed], int(t.value>>16)&0xff)
+			e.bw.writeSymbol(&codes[codeBlue], int(t.value)&0xff)
+			e.bw.writeSymbol(&codes[codeAlpha], int(t.value>>24))
+		case tokenCache:
+			e.bw.writeSymbol(&codes[codeGreen], numLiteralCodes+numLengthCodes+int(t.value))
+		case tokenCopy:
+			symbol, n, extra := prefixEncode(t.length)
+			e.bw.writeSymbol(&codes[codeGreen], numLiteralCodes+symbol)
+			e.bw.write(extra, n)
+			symbol, n, extra = prefixEncode(int(t.value))
+			e.bw.writeSymbol(&codes[codeDistance], symbol)
+			e.bw.write(extra, n)
+		}
+	}
+}
+
+// subPixels subtracts each channel of the pixels modulo 256.
+func subPixels(a, b uint32) uint32 {
+	ag := (a | 0x00ff00ff) - (b & 0xff00ff00)
+	rb := (a | 0xff00ff00) - (b & 0x00ff00ff)
+	return ag&0xff00ff00 | rb&0x00ff00ff
+}
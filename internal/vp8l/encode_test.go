@@ -0,0 +1,101 @@
+package vp8l
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// testImage returns the pixels of the image of width x height, which has
+// gradients and noise, and uses at most numColors colors if numColors > 0.
+func testImage(width, height, numColors int, alpha bool) []uint32 {
+	rnd := rand.New(rand.NewSource(int64(width*height + numColors)))
+	palette := make([]uint32, numColors)
+	for i := range palette {
+		palette[i] = rnd.Uint32()
+	}
+
+	pix := make([]uint32, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var p uint32
+			switch {
+			case numColors > 0:
+				p = palette[(x/3+y/2+rnd.Intn(2))%numColors]
+			case x < width/2:
+				// Smooth area for the predictors
+				p = uint32(x*3)<<16 | uint32(y*5)<<8 | uint32(x+y)
+			default:
+				p = rnd.Uint32() & 0x00f0f0f0
+			}
+			if !alpha {
+				p |= 0xff000000
+			}
+			pix[y*width+x] = p
+		}
+	}
+	return pix
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	sizes := [][2]int{{1, 1}, {1, 37}, {53, 1}, {64, 64}, {131, 67}}
+	for _, numColors := range []int{0, 1, 2, 3, 5, 17, 256} {
+		for _, alpha := range []bool{false, true} {
+			for _, size := range sizes {
+				pix := testImage(size[0], size[1], numColors, alpha)
+				for _, method := range []int{0, 4, 6} {
+					name := fmt.Sprintf("%dx%d of %d colors (alpha: %v) with method %d", size[0], size[1], numColors, alpha, method)
+					data, _, err := Encode(pix, size[0], size[1], Options{Method: method, Quality: float32(method * 15)})
+					if err != nil {
+						t.Fatalf("%v: Got Error: %v", name, err)
+					}
+					h, got, err := Decode(data)
+					if err != nil {
+						t.Errorf("%v: Got Error: %v", name, err)
+						continue
+					}
+					if h != (Header{Width: size[0], Height: size[1], HasAlpha: alpha}) {
+						t.Errorf("%v: Unexpected header: %+v", name, h)
+					}
+					if !slices.Equal(got, pix) {
+						t.Errorf("%v: Decoded pixels differ", name)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeStats(t *testing.T) {
+	_, stats, err := Encode(testImage(40, 30, 0, false), 40, 30, Options{Method: 4})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if stats.Transforms != 1<<predictorTransform|1<<subtractGreenTransform || stats.TransformBits != 3 || stats.PaletteSize != 0 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	_, stats, err = Encode(testImage(40, 30, 5, false), 40, 30, Options{Method: 4})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if stats.Transforms != 1<<colorIndexingTransform || stats.PaletteSize != 5 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+	if _, _, err := Encode(nil, 0, 1, Options{}); err != ErrImageSize {
+		t.Errorf("Expected %v, but got %v", ErrImageSize, err)
+	}
+	if _, _, err := Encode(make([]uint32, maxImageSize+1), maxImageSize+1, 1, Options{}); err != ErrImageSize {
+		t.Errorf("Expected %v, but got %v", ErrImageSize, err)
+	}
+
+	abort := func(percent int) bool { return percent < 40 }
+	if _, _, err := Encode(testImage(8, 8, 0, false), 8, 8, Options{Progress: abort}); !errors.Is(err, ErrAborted) {
+		t.Errorf("Expected %v, but got %v", ErrAborted, err)
+	}
+}
@@ -0,0 +1,123 @@
+package vp8l
+
+const (
+	// maxCodeLength is the maximum length of prefix codes.
+	maxCodeLength = 15
+	// tableBits is the number of bits looked up at once by huffmanCode.
+	tableBits = 8
+)
+
+// huffmanCode represents a canonical prefix code. Codes up to tableBits are
+// decoded by a lookup table, and longer ones are decoded bit by bit.
+type huffmanCode struct {
+	single  int                       // The only symbol of the code, or -1
+	table   [1 << tableBits]uint32    // Symbol<<4 | length for each reversed prefix of tableBits, or 0
+	counts  [maxCodeLength + 1]uint16 // Number of codes for each length
+	symbols []uint16                  // Symbols sorted by their codes
+}
+
+// build builds the code from the code lengths of symbols. Like libwebp, it
+// rejects the code which is incomplete or oversubscribed, unless it has only
+// one symbol, which is decoded without reading any bits.
+func (h *huffmanCode) build(lengths []int) bool {
+	*h = huffmanCode{single: -1, symbols: h.symbols[:0]}
+
+	num := 0
+	for _, l := range lengths {
+		if l > maxCodeLength {
+			return false
+		}
+		if l > 0 {
+			h.counts[l]++
+			num++
+		}
+	}
+	if num == 0 {
+		return false
+	}
+	if num == 1 {
+		for s, l := range lengths {
+			if l > 0 {
+				h.single = s
+			}
+		}
+		return true
+	}
+
+	left := 1
+	for l := 1; l <= maxCodeLength; l++ {
+		left = left<<1 - int(h.counts[l])
+		if left < 0 {
+			return false
+		}
+	}
+	if left != 0 {
+		return false
+	}
+
+	var offsets [maxCodeLength + 2]int
+	for l := 1; l <= maxCodeLength; l++ {
+		offsets[l+1] = offsets[l] + int(h.counts[l])
+	}
+	if cap(h.symbols) < num {
+		h.symbols = make([]uint16, num)
+	}
+	h.symbols = h.symbols[:num]
+	for s, l := range lengths {
+		if l > 0 {
+			h.symbols[offsets[l]] = uint16(s)
+			offsets[l]++
+		}
+	}
+
+	// Fill the lookup table with the codes assigned in the order of symbols.
+	code, i := 0, 0
+	for l := 1; l <= tableBits; l++ {
+		for n := 0; n < int(h.counts[l]); n++ {
+			entry := uint32(h.symbols[i])<<4 | uint32(l)
+			for rev := reverseBits(code, l); rev < len(h.table); rev += 1 << l {
+				h.table[rev] = entry
+			}
+			code++
+			i++
+		}
+		code <<= 1
+	}
+	return true
+}
+
+// decode reads a symbol.
+func (h *huffmanCode) decode(r *bitReader) int {
+	if h.single >= 0 {
+		return h.single
+	}
+	if e := h.table[r.peek(tableBits)]; e != 0 {
+		r.skip(uint(e & 0x0f))
+		return int(e >> 4)
+	}
+
+	// Decode the code longer than tableBits bit by bit.
+	code, first, index := 0, 0, 0
+	for l := 1; l <= maxCodeLength; l++ {
+		code |= int(r.read(1))
+		count := int(h.counts[l])
+		if code-first < count {
+			return int(h.symbols[index+code-first])
+		}
+		index += count
+		first = (first + count) << 1
+		code <<= 1
+	}
+	// Not reached, since the code is complete.
+	return 0
+}
+
+// reverseBits reverses the order of the lowest n bits of v.
+func reverseBits(v, n int) int {
+	r := 0
+	for i := 0; i < n; i++ {
+		r = r<<1 | v&1
+		v >>= 1
+	}
+	return r
+}
@@ -0,0 +1,155 @@
+package vp8l
+
+import (
+	"image"
+	"iter"
+)
+
+// Output specifies how DecodeTo writes the decoded image, which corresponds to
+// the output of WebPDecode of libwebp.
+type Output struct {
+	Pix           []uint8         // Samples in R, G, B, A order, whose stride is 4 * Width
+	Width, Height int             // Size of the output image
+	Crop          image.Rectangle // Area of the decoded image to write
+	Scale         bool            // If true, scale the cropped area to Width x Height
+	Flip          bool            // If true, write the rows bottom-up
+	Premultiplied bool            // If true, premultiply the colors by alpha
+}
+
+// DecodeTo decodes VP8L bitstream, and writes the cropped area of the image
+// into out in the same way as libwebp. Pix must have 4 * Width * Height
+// samples, and the size of the cropped area must be Width x Height unless it
+// is scaled. It returns ErrFormat if the cropped area exceeds the image.
+func DecodeTo(data []byte, out *Output) error {
+	h, argb, err := Decode(data)
+	if err != nil {
+		return err
+	}
+	crop := out.Crop
+	if crop.Empty() || !crop.In(image.Rect(0, 0, h.Width, h.Height)) {
+		return ErrFormat
+	}
+
+	w := &outputWriter{out: out}
+	rows := func(yield func([]uint32) bool) {
+		for y := crop.Min.Y; y < crop.Max.Y; y++ {
+			if !yield(argb[y*h.Width+crop.Min.X : y*h.Width+crop.Max.X]) {
+				return
+			}
+		}
+	}
+	if out.Scale {
+		w.emitRescaled(rows, crop.Dx(), crop.Dy())
+	} else {
+		for row := range rows {
+			w.emit(row)
+		}
+	}
+	return nil
+}
+
+// outputWriter writes rows of ARGB pixels into the output image.
+type outputWriter struct {
+	out *Output
+	y   int // Number of rows already written
+}
+
+// emit converts the row of ARGB pixels, and writes it into the next row of
+// the output image.
+func (w *outputWriter) emit(row []uint32) {
+	y := w.y
+	if w.out.Flip {
+		y = w.out.Height - 1 - y
+	}
+	w.y++
+
+	stride := 4 * w.out.Width
+	dst := w.out.Pix[y*stride : y*stride+4*len(row)]
+	for i, p := range row {
+		r, g, b, a := uint8(p>>16), uint8(p>>8), uint8(p), uint8(p>>24)
+		if w.out.Premultiplied && a != 0xff {
+			// Same as WebPApplyAlphaMultiply of libwebp
+			m := uint32(a) * 32897
+			r = uint8(uint32(r) * m >> 23)
+			g = uint8(uint32(g) * m >> 23)
+			b = uint8(uint32(b) * m >> 23)
+		}
+		dst[4*i+0], dst[4*i+1], dst[4*i+2], dst[4*i+3] = r, g, b, a
+	}
+}
+
+// emitRescaled scales the rows of srcWidth x srcHeight to the size of the
+// output image, and writes them. Like libwebp, the colors are premultiplied
+// by alpha while scaling.
+func (w *outputWriter) emitRescaled(rows iter.Seq[[]uint32], srcWidth, srcHeight int) {
+	width := w.out.Width
+	r := newRescaler(srcWidth, srcHeight, width, w.out.Height, 4)
+	src := make([]uint32, srcWidth)
+	srcSamples := make([]uint8, 4*srcWidth)
+	dst := make([]uint32, width)
+	dstSamples := make([]uint8, 4*width)
+
+	export := func() {
+		for r.hasPendingOutput() {
+			r.exportRow(dstSamples)
+			samplesToARGB(dst, dstSamples)
+			multARGBRow(dst, true)
+			w.emit(dst)
+		}
+	}
+	for row := range rows {
+		export()
+		copy(src, row)
+		multARGBRow(src, false)
+		argbToSamples(srcSamples, src)
+		r.importRow(srcSamples)
+	}
+	export()
+}
+
+// argbToSamples stores ARGB pixels into samples in the byte order of libwebp,
+// which is B, G, R, A.
+func argbToSamples(dst []uint8, src []uint32) {
+	for i, p := range src {
+		dst[4*i+0], dst[4*i+1], dst[4*i+2], dst[4*i+3] = uint8(p), uint8(p>>8), uint8(p>>16), uint8(p>>24)
+	}
+}
+
+// samplesToARGB loads ARGB pixels from samples in the byte order of libwebp.
+func samplesToARGB(dst []uint32, src []uint8) {
+	for i := range dst {
+		dst[i] = uint32(src[4*i]) | uint32(src[4*i+1])<<8 | uint32(src[4*i+2])<<16 | uint32(src[4*i+3])<<24
+	}
+}
+
+// multARGBRow premultiplies the colors of ARGB pixels by alpha, or
+// unpremultiplies them if inverse is true, in the same way as WebPMultARGBRow
+// of libwebp.
+func multARGBRow(row []uint32, inverse bool) {
+	const (
+		fix  = 24
+		half = 1 << fix >> 1
+	)
+	for i, p := range row {
+		if p >= 0xff000000 {
+			continue
+		}
+		if p <= 0x00ffffff {
+			row[i] = 0
+			continue
+		}
+
+		a := p >> 24
+		scale := a * ((1 << fix) / 255)
+		if inverse {
+			scale = (255 << fix) / a
+		}
+		// The results may exceed 255 when unpremultiplying, and overflow into
+		// the next channels as libwebp does.
+		v := p & 0xff000000
+		v |= (uint32(uint8(p>>0))*scale + half) >> fix << 0
+		v |= (uint32(uint8(p>>8))*scale + half) >> fix << 8
+		v |= (uint32(uint8(p>>16))*scale + half) >> fix << 16
+		row[i] = v
+	}
+}
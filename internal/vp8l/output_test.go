@@ -0,0 +1,49 @@
+package vp8l
+
+import (
+	"image"
+	"testing"
+)
+
+func TestDecodeTo(t *testing.T) {
+	const width, height = 31, 17
+	pix := testImage(width, height, 0, true)
+	data, _, err := Encode(pix, width, height, Options{Method: 4})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	crop := image.Rect(3, 2, 20, 15)
+	out := &Output{Pix: make([]uint8, 4*crop.Dx()*crop.Dy()), Width: crop.Dx(), Height: crop.Dy(), Crop: crop, Flip: true}
+	if err := DecodeTo(data, out); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	for y := 0; y < out.Height; y++ {
+		for x := 0; x < out.Width; x++ {
+			p := pix[(crop.Max.Y-1-y)*width+crop.Min.X+x]
+			s := out.Pix[4*(y*out.Width+x):]
+			if s[0] != uint8(p>>16) || s[1] != uint8(p>>8) || s[2] != uint8(p) || s[3] != uint8(p>>24) {
+				t.Fatalf("Unexpected pixel at (%d, %d): %v, expected %#08x", x, y, s[:4], p)
+			}
+		}
+	}
+
+	// Scaling a uniform image keeps its color.
+	uniform := uniformImage(width, height, 0x80402010)
+	out = &Output{Pix: make([]uint8, 4*7*40), Width: 7, Height: 40, Crop: image.Rect(0, 0, width, height), Scale: true}
+	if err := DecodeTo(uniform, out); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	for i := 0; i < len(out.Pix); i += 4 {
+		if s := out.Pix[i : i+4]; s[0] != 0x40 || s[1] != 0x20 || s[2] != 0x10 || s[3] != 0x80 {
+			t.Fatalf("Unexpected scaled pixel %v at %d", s, i/4)
+		}
+	}
+
+	for _, crop := range []image.Rectangle{{}, image.Rect(0, 0, width+1, 1), image.Rect(-1, 0, 1, 1)} {
+		out := &Output{Pix: make([]uint8, 4*width*height), Width: width, Height: height, Crop: crop}
+		if err := DecodeTo(data, out); err != ErrFormat {
+			t.Errorf("Crop %v: Expected %v, but got %v", crop, ErrFormat, err)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package vp8l
+
+// bitReader reads bits of VP8L bitstream from the least significant bit of
+// each byte. Bits beyond the end of data are read as zeros, and eos reports
+// whether they have been read, in the same way as VP8LBitReader of libwebp.
+type bitReader struct {
+	data []byte
+	pos  int    // Position of the next byte to buffer, which may exceed len(data)
+	val  uint64 // Buffered bits
+	n    uint   // Number of buffered bits
+}
+
+// fill buffers bytes as many as possible.
+func (r *bitReader) fill() {
+	for r.n <= 56 {
+		if r.pos < len(r.data) {
+			r.val |= uint64(r.data[r.pos]) << r.n
+		}
+		r.pos++
+		r.n += 8
+	}
+}
+
+// read reads n bits, which must be at most 32.
+func (r *bitReader) read(n uint) uint32 {
+	v := r.peek(n)
+	r.skip(n)
+	return v
+}
+
+// peek returns the next n bits without consuming them.
+func (r *bitReader) peek(n uint) uint32 {
+	if r.n < n {
+		r.fill()
+	}
+	return uint32(r.val & (1<<n - 1))
+}
+
+// skip consumes n bits, which must be buffered by peek.
+func (r *bitReader) skip(n uint) {
+	r.val >>= n
+	r.n -= n
+}
+
+// eos reports whether bits beyond the end of data have been read.
+func (r *bitReader) eos() bool {
+	return 8*r.pos-int(r.n) > 8*len(r.data)
+}
@@ -0,0 +1,219 @@
+package vp8l
+
+// Fixed-point arithmetic of rescaler, which is the same as libwebp.
+const (
+	rescalerFix     = 32
+	rescalerOne     = 1 << rescalerFix
+	rescalerRounder = rescalerOne >> 1
+)
+
+// rescaler scales rows of interleaved 8-bit samples in the same way as
+// WebPRescaler of libwebp, so that scaling by DecodeTo produces the same pixels
+// as libwebp. The source rows are imported one by one, and the scaled rows are
+// exported whenever they are available.
+type rescaler struct {
+	xExpand, yExpand bool // True if expanding in the direction
+	numChannels      int  // Number of samples of a pixel
+	fxScale          uint32
+	fyScale          uint32
+	fxyScale         uint32
+	yAccum           int
+	yAdd, ySub       int
+	xAdd, xSub       int
+	srcWidth         int
+	dstWidth         int
+	dstHeight        int
+	dstY             int
+	irow, frow       []uint32
+}
+
+// newRescaler creates a rescaler from srcWidth x srcHeight to dstWidth x
+// dstHeight, which corresponds to WebPRescalerInit.
+func newRescaler(srcWidth, srcHeight, dstWidth, dstHeight, numChannels int) *rescaler {
+	r := &rescaler{
+		xExpand:     srcWidth < dstWidth,
+		yExpand:     srcHeight < dstHeight,
+		numChannels: numChannels,
+		srcWidth:    srcWidth,
+		dstWidth:    dstWidth,
+		dstHeight:   dstHeight,
+	}
+
+	// Bilinear interpolation is used for expanding.
+	r.xAdd, r.xSub = srcWidth, dstWidth
+	if r.xExpand {
+		r.xAdd, r.xSub = dstWidth-1, srcWidth-1
+	} else {
+		r.fxScale = rescalerFrac(1, uint64(r.xSub))
+	}
+
+	r.yAdd, r.ySub = srcHeight, dstHeight
+	if r.yExpand {
+		r.yAdd, r.ySub = srcHeight-1, dstHeight-1
+		r.yAccum = r.ySub
+		r.fyScale = rescalerFrac(1, uint64(r.xAdd))
+	} else {
+		r.yAccum = r.yAdd
+		// fxyScale is zero if the ratio cannot be represented, which is
+		// handled in exportRow.
+		ratio := uint64(dstHeight) * rescalerOne / (uint64(r.xAdd) * uint64(r.yAdd))
+		if ratio == uint64(uint32(ratio)) {
+			r.fxyScale = uint32(ratio)
+		}
+		r.fyScale = rescalerFrac(1, uint64(r.ySub))
+	}
+
+	r.irow = make([]uint32, numChannels*dstWidth)
+	r.frow = make([]uint32, numChannels*dstWidth)
+	return r
+}
+
+func rescalerFrac(x, y uint64) uint32 {
+	return uint32((x << rescalerFix) / y)
+}
+
+func multFix(x, y uint32) uint32 {
+	return uint32((uint64(x)*uint64(y) + rescalerRounder) >> rescalerFix)
+}
+
+func multFixFloor(x, y uint32) uint32 {
+	return uint32((uint64(x) * uint64(y)) >> rescalerFix)
+}
+
+// clipSample clips the result of multFix, which libwebp converts to int.
+func clipSample(v uint32) uint8 {
+	if int32(v) > 255 {
+		return 255
+	}
+	return uint8(v)
+}
+
+// hasPendingOutput reports whether a scaled row can be exported.
+func (r *rescaler) hasPendingOutput() bool {
+	return r.dstY < r.dstHeight && r.yAccum <= 0
+}
+
+// importRow imports a source row, which must not be called while
+// hasPendingOutput reports true.
+func (r *rescaler) importRow(src []uint8) {
+	if r.yExpand {
+		r.irow, r.frow = r.frow, r.irow
+	}
+	if r.xExpand {
+		r.importRowExpand(src)
+	} else {
+		r.importRowShrink(src)
+	}
+	if !r.yExpand {
+		// Accumulate the contribution of the new row.
+		for i, v := range r.frow {
+			r.irow[i] += v
+		}
+	}
+	r.yAccum -= r.ySub
+}
+
+func (r *rescaler) importRowExpand(src []uint8) {
+	stride := r.numChannels
+	for c := 0; c < stride; c++ {
+		in := c
+		accum := r.xAdd
+		left := uint32(src[in])
+		right := left
+		if r.srcWidth > 1 {
+			right = uint32(src[in+stride])
+		}
+		in += stride
+		for out := c; ; {
+			r.frow[out] = right*uint32(r.xAdd) + (left-right)*uint32(accum)
+			out += stride
+			if out >= len(r.frow) {
+				break
+			}
+			accum -= r.xSub
+			if accum < 0 {
+				left = right
+				in += stride
+				right = uint32(src[in])
+				accum += r.xAdd
+			}
+		}
+	}
+}
+
+func (r *rescaler) importRowShrink(src []uint8) {
+	stride := r.numChannels
+	for c := 0; c < stride; c++ {
+		in := c
+		var sum uint32
+		accum := 0
+		for out := c; out < len(r.frow); out += stride {
+			var base uint32
+			accum += r.xAdd
+			for accum > 0 {
+				accum -= r.xSub
+				base = uint32(src[in])
+				sum += base
+				in += stride
+			}
+			// Emit the next pixel, and carry the fraction to the next one.
+			frac := base * uint32(-accum)
+			r.frow[out] = sum*uint32(r.xSub) - frac
+			sum = multFix(frac, r.fxScale)
+		}
+	}
+}
+
+// exportRow exports a scaled row into dst, which must be called only while
+// hasPendingOutput reports true.
+func (r *rescaler) exportRow(dst []uint8) {
+	switch {
+	case r.yExpand:
+		r.exportRowExpand(dst)
+	case r.fxyScale != 0:
+		r.exportRowShrink(dst)
+	default:
+		// The source and destination have the same height, and the source
+		// has a single column.
+		for i, v := range r.irow {
+			dst[i] = uint8(v)
+			r.irow[i] = 0
+		}
+	}
+	r.yAccum += r.yAdd
+	r.dstY++
+}
+
+func (r *rescaler) exportRowExpand(dst []uint8) {
+	if r.yAccum == 0 {
+		for i, v := range r.frow {
+			dst[i] = clipSample(multFix(v, r.fyScale))
+		}
+		return
+	}
+
+	b := rescalerFrac(uint64(-r.yAccum), uint64(r.ySub))
+	a := uint32(rescalerOne - uint64(b))
+	for i := range r.frow {
+		v := uint64(a)*uint64(r.frow[i]) + uint64(b)*uint64(r.irow[i])
+		dst[i] = clipSample(multFix(uint32((v+rescalerRounder)>>rescalerFix), r.fyScale))
+	}
+}
+
+func (r *rescaler) exportRowShrink(dst []uint8) {
+	yScale := r.fyScale * uint32(-r.yAccum)
+	if yScale == 0 {
+		for i, v := range r.irow {
+			dst[i] = clipSample(multFix(v, r.fxyScale))
+			r.irow[i] = 0
+		}
+		return
+	}
+
+	for i := range r.irow {
+		frac := multFixFloor(r.frow[i], yScale)
+		dst[i] = clipSample(multFix(r.irow[i]-frac, r.fxyScale))
+		// Carry the fraction to the next row.
+		r.irow[i] = frac
+	}
+}
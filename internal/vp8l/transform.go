@@ -0,0 +1,263 @@
+package vp8l
+
+// Types of transforms.
+const (
+	predictorTransform = iota
+	crossColorTransform
+	subtractGreenTransform
+	colorIndexingTransform
+)
+
+// transform represents a transform applied to the image by the encoder.
+type transform struct {
+	kind  int
+	bits  int      // Block size in bits, or the number of bits to pack indices
+	xsize int      // Width of the image after the inverse transform
+	data  []uint32 // Transform image, or the color map of color indexing
+}
+
+// readTransform reads a transform of the image of xsize x ysize. xsize is
+// updated to the width of the image to read next.
+func (d *decoder) readTransform(xsize *int, ysize int) error {
+	kind := int(d.br.read(2))
+	if d.seen&(1<<kind) != 0 {
+		// Each transform is allowed only once.
+		return d.errorAtEOS()
+	}
+	d.seen |= 1 << kind
+
+	t := transform{kind: kind, xsize: *xsize}
+	switch kind {
+	case predictorTransform, crossColorTransform:
+		t.bits = int(d.br.read(3)) + 2
+		var err error
+		t.data, err = d.decodeImageStream(subSampleSize(t.xsize, t.bits), subSampleSize(ysize, t.bits), false)
+		if err != nil {
+			return err
+		}
+
+	case colorIndexingTransform:
+		numColors := int(d.br.read(8)) + 1
+		switch {
+		case numColors > 16:
+			t.bits = 0
+		case numColors > 4:
+			t.bits = 1
+		case numColors > 2:
+			t.bits = 2
+		default:
+			t.bits = 3
+		}
+		palette, err := d.decodeImageStream(numColors, 1, false)
+		if err != nil {
+			return err
+		}
+		t.data = expandColorMap(palette, t.bits)
+		*xsize = subSampleSize(t.xsize, t.bits)
+	}
+	d.transforms = append(d.transforms, t)
+	return nil
+}
+
+// expandColorMap decodes the delta-coded palette, and extends it to all the
+// indices which can be packed with bits, filling transparent black.
+func expandColorMap(palette []uint32, bits int) []uint32 {
+	colorMap := make([]uint32, 1<<(8>>bits))
+	colorMap[0] = palette[0]
+	for i := 1; i < len(palette); i++ {
+		colorMap[i] = addPixels(palette[i], colorMap[i-1])
+	}
+	return colorMap
+}
+
+// inverse applies the inverse transform to the image of height, and returns
+// the result, which may share the memory of pix.
+func (t *transform) inverse(pix []uint32, height int) []uint32 {
+	switch t.kind {
+	case predictorTransform:
+		t.inversePredictor(pix, height)
+	case crossColorTransform:
+		t.inverseCrossColor(pix, height)
+	case subtractGreenTransform:
+		for i, p := range pix {
+			g := (p >> 8) & 0xff
+			pix[i] = p&0xff00ff00 | (p&0x00ff00ff+(g<<16|g))&0x00ff00ff
+		}
+	case colorIndexingTransform:
+		return t.inverseColorIndexing(pix, height)
+	}
+	return pix
+}
+
+// inversePredictor adds the predicted values to the residuals in place.
+func (t *transform) inversePredictor(pix []uint32, height int) {
+	w := t.xsize
+	if w == 0 || height == 0 {
+		return
+	}
+
+	// The first row is predicted by black and L.
+	pix[0] = addPixels(pix[0], 0xff000000)
+	for x := 1; x < w; x++ {
+		pix[x] = addPixels(pix[x], pix[x-1])
+	}
+
+	blocks := subSampleSize(w, t.bits)
+	for y := 1; y < height; y++ {
+		row := y * w
+		modes := t.data[(y>>t.bits)*blocks:]
+		// The first pixel of the row is predicted by T.
+		pix[row] = addPixels(pix[row], pix[row-w])
+		for x := 1; x < w; x++ {
+			i := row + x
+			// TR of the rightmost pixel is the leftmost pixel of the current
+			// row, which follows the top row in memory.
+			pred := predict((modes[x>>t.bits]>>8)&0x0f, pix[i-1], pix[i-w], pix[i-w+1], pix[i-w-1])
+			pix[i] = addPixels(pix[i], pred)
+		}
+	}
+}
+
+// predict returns the predicted value of the mode from the neighbor pixels.
+func predict(mode uint32, l, t, tr, tl uint32) uint32 {
+	switch mode {
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		return selectPixel(t, l, tl)
+	case 12:
+		return clampedAddSubtractFull(l, t, tl)
+	case 13:
+		return clampedAddSubtractHalf(average2(l, t), tl)
+	}
+	// 0, and 14 and 15 which libwebp treats in the same way
+	return 0xff000000
+}
+
+// inverseCrossColor restores red and blue from the color transform elements
+// in place.
+func (t *transform) inverseCrossColor(pix []uint32, height int) {
+	w := t.xsize
+	blocks := subSampleSize(w, t.bits)
+	for y := 0; y < height; y++ {
+		elements := t.data[(y>>t.bits)*blocks:]
+		for x, p := range pix[y*w : (y+1)*w] {
+			m := elements[x>>t.bits]
+			greenToRed, greenToBlue, redToBlue := int8(m), int8(m>>8), int8(m>>16)
+			green := int8(p >> 8)
+			red := (int(p>>16) + colorTransformDelta(greenToRed, green)) & 0xff
+			blue := int(p&0xff) + colorTransformDelta(greenToBlue, green)
+			blue = (blue + colorTransformDelta(redToBlue, int8(red))) & 0xff
+			pix[y*w+x] = p&0xff00ff00 | uint32(red)<<16 | uint32(blue)
+		}
+	}
+}
+
+// colorTransformDelta returns the delta of the color transform.
+func colorTransformDelta(t, c int8) int {
+	return (int(t) * int(c)) >> 5
+}
+
+// inverseColorIndexing unpacks the indices and replaces them with the colors
+// in the color map.
+func (t *transform) inverseColorIndexing(pix []uint32, height int) []uint32 {
+	if t.bits == 0 {
+		for i, p := range pix {
+			pix[i] = t.data[(p>>8)&0xff]
+		}
+		return pix
+	}
+
+	w := t.xsize
+	packed := subSampleSize(w, t.bits)
+	bitsPerPixel := uint(8 >> t.bits)
+	mask := uint32(1)<<bitsPerPixel - 1
+	perByte := 1 << t.bits
+	out := make([]uint32, w*height)
+	for y := 0; y < height; y++ {
+		src := pix[y*packed : (y+1)*packed]
+		dst := out[y*w : (y+1)*w]
+		for x := range dst {
+			index := src[x>>t.bits] >> 8 >> (uint(x&(perByte-1)) * bitsPerPixel)
+			dst[x] = t.data[index&mask]
+		}
+	}
+	return out
+}
+
+// addPixels adds each channel of the pixels modulo 256.
+func addPixels(a, b uint32) uint32 {
+	ag := (a & 0xff00ff00) + (b & 0xff00ff00)
+	rb := (a & 0x00ff00ff) + (b & 0x00ff00ff)
+	return ag&0xff00ff00 | rb&0x00ff00ff
+}
+
+// average2 returns the average of each channel of the pixels, rounded down.
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+// selectPixel selects t or l whichever is closer to the gradient estimate
+// l + t - tl.
+func selectPixel(t, l, tl uint32) uint32 {
+	d := 0
+	for shift := 0; shift < 32; shift += 8 {
+		ct, cl, ctl := int(t>>shift)&0xff, int(l>>shift)&0xff, int(tl>>shift)&0xff
+		d += abs(cl-ctl) - abs(ct-ctl)
+	}
+	if d <= 0 {
+		return t
+	}
+	return l
+}
+
+// clampedAddSubtractFull returns a + b - c for each channel, clamped to
+// [0, 255].
+func clampedAddSubtractFull(a, b, c uint32) uint32 {
+	var p uint32
+	for shift := 0; shift < 32; shift += 8 {
+		v := int(a>>shift)&0xff + int(b>>shift)&0xff - int(c>>shift)&0xff
+		p |= clip255(v) << shift
+	}
+	return p
+}
+
+// clampedAddSubtractHalf returns a + (a - b) / 2 for each channel, clamped to
+// [0, 255].
+func clampedAddSubtractHalf(a, b uint32) uint32 {
+	var p uint32
+	for shift := 0; shift < 32; shift += 8 {
+		ca, cb := int(a>>shift)&0xff, int(b>>shift)&0xff
+		p |= clip255(ca+(ca-cb)/2) << shift
+	}
+	return p
+}
+
+func clip255(v int) uint32 {
+	return uint32(min(max(v, 0), 255))
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,293 @@
+package vp8l
+
+import (
+	"cmp"
+	"math/bits"
+	"slices"
+)
+
+// bitWriter writes bits from the least significant bit of each byte.
+type bitWriter struct {
+	data []byte
+	bits uint64 // Bits not written into data yet
+	n    uint   // Number of bits in bits
+}
+
+// write writes the lower n bits of v, where n is up to 32.
+func (w *bitWriter) write(v uint32, n uint) {
+	w.bits |= uint64(v) << w.n
+	w.n += n
+	for w.n >= 8 {
+		w.data = append(w.data, byte(w.bits))
+		w.bits >>= 8
+		w.n -= 8
+	}
+}
+
+// len returns the number of bits written.
+func (w *bitWriter) len() int {
+	return 8*len(w.data) + int(w.n)
+}
+
+// bytes pads the last byte with zeros, and returns the written data.
+func (w *bitWriter) bytes() []byte {
+	if w.n > 0 {
+		w.data = append(w.data, byte(w.bits))
+		w.bits, w.n = 0, 0
+	}
+	return w.data
+}
+
+// prefixCode holds the canonical prefix codes of symbols to write.
+type prefixCode struct {
+	codes   []uint32 // Codes in the order of bits to write
+	lengths []uint8  // Code lengths, which are zero for the only symbol
+}
+
+// newPrefixCode assigns the canonical codes to the symbols of the code lengths.
+// Like decoders, the code of a single symbol has no bits.
+func newPrefixCode(lengths []int) prefixCode {
+	p := prefixCode{codes: make([]uint32, len(lengths)), lengths: make([]uint8, len(lengths))}
+	var counts [maxCodeLength + 1]int
+	num := 0
+	for _, l := range lengths {
+		if l > 0 {
+			counts[l]++
+			num++
+		}
+	}
+	if num <= 1 {
+		return p
+	}
+
+	var next [maxCodeLength + 1]int
+	code := 0
+	for l := 1; l <= maxCodeLength; l++ {
+		code = (code + counts[l-1]) << 1
+		next[l] = code
+	}
+	for s, l := range lengths {
+		if l > 0 {
+			p.codes[s] = uint32(reverseBits(next[l], l))
+			p.lengths[s] = uint8(l)
+			next[l]++
+		}
+	}
+	return p
+}
+
+// writeSymbol writes the code of the symbol.
+func (w *bitWriter) writeSymbol(p *prefixCode, symbol int) {
+	w.write(p.codes[symbol], uint(p.lengths[symbol]))
+}
+
+// codeLengths returns the lengths of the optimal prefix codes for the
+// histogram, which are limited to limit. Like libwebp, the small counts are
+// raised until the codes fit in the limit.
+func codeLengths(histogram []uint32, limit int) []int {
+	lengths := make([]int, len(histogram))
+	var symbols []int
+	for s, c := range histogram {
+		if c > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+	switch len(symbols) {
+	case 0:
+		return lengths
+	case 1:
+		lengths[symbols[0]] = 1
+		return lengths
+	}
+
+	for countMin := uint32(1); !huffmanLengths(histogram, symbols, countMin, limit, lengths); countMin *= 2 {
+	}
+	return lengths
+}
+
+// huffmanLengths builds the Huffman tree of the symbols, whose counts are at
+// least countMin, and stores the depths of them into lengths. It reports false
+// if the depth exceeds limit.
+func huffmanLengths(histogram []uint32, symbols []int, countMin uint32, limit int, lengths []int) bool {
+	count := func(s int) uint32 { return max(histogram[s], countMin) }
+	n := len(symbols)
+	leaves := slices.Clone(symbols)
+	slices.SortStableFunc(leaves, func(a, b int) int { return cmp.Compare(count(a), count(b)) })
+
+	// The leaves are followed by the internal nodes in the order of their
+	// creation, which are merged from the two queues of them.
+	counts := make([]uint64, 2*n-1)
+	parents := make([]int, 2*n-1)
+	for i, s := range leaves {
+		counts[i] = uint64(count(s))
+	}
+	leaf, node := 0, n
+	pick := func(next int) int {
+		if leaf < n && (node >= next || counts[leaf] <= counts[node]) {
+			leaf++
+			return leaf - 1
+		}
+		node++
+		return node - 1
+	}
+	for next := n; next < len(counts); next++ {
+		a := pick(next)
+		b := pick(next)
+		counts[next] = counts[a] + counts[b]
+		parents[a], parents[b] = next, next
+	}
+
+	depths := make([]int, len(counts))
+	for i := len(counts) - 2; i >= 0; i-- {
+		depths[i] = depths[parents[i]] + 1
+	}
+	for i, s := range leaves {
+		if depths[i] > limit {
+			return false
+		}
+		lengths[s] = depths[i]
+	}
+	return true
+}
+
+// Code length codes
+const (
+	numCodeLengthCodes  = 19
+	codeLengthRepeat    = 16 // Repeats the previous non-zero length 3..6 times
+	codeLengthZeros     = 17 // Repeats zero 3..10 times
+	codeLengthLongZeros = 18 // Repeats zero 11..138 times
+	// maxCodeLengthCodeLength is the maximum length of code length codes.
+	maxCodeLengthCodeLength = 7
+)
+
+// codeLengthToken is a code length code and its extra bits.
+type codeLengthToken struct {
+	code  int
+	extra uint32
+}
+
+// codeLengthTokens converts the code lengths into code length codes, using the
+// repeat codes for runs.
+func codeLengthTokens(lengths []int) []codeLengthToken {
+	var tokens []codeLengthToken
+	prev := 8 // The initial value of the previous non-zero length
+	for i := 0; i < len(lengths); {
+		v := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == v {
+			run++
+		}
+		i += run
+
+		if v == 0 {
+			for run > 0 {
+				switch {
+				case run < 3:
+					tokens = append(tokens, codeLengthToken{code: 0})
+					run--
+				case run <= 10:
+					tokens = append(tokens, codeLengthToken{codeLengthZeros, uint32(run - 3)})
+					run = 0
+				default:
+					n := min(run, 138)
+					tokens = append(tokens, codeLengthToken{codeLengthLongZeros, uint32(n - 11)})
+					run -= n
+				}
+			}
+			continue
+		}
+
+		if v != prev {
+			tokens = append(tokens, codeLengthToken{code: v})
+			prev = v
+			run--
+		}
+		for run > 0 {
+			if run < 3 {
+				tokens = append(tokens, codeLengthToken{code: v})
+				run--
+				continue
+			}
+			n := min(run, 6)
+			tokens = append(tokens, codeLengthToken{codeLengthRepeat, uint32(n - 3)})
+			run -= n
+		}
+	}
+	return tokens
+}
+
+// writeHuffmanCode writes the prefix code of the code lengths, and returns the
+// code to write symbols. The code of at most two symbols below 256 is written
+// as a simple code.
+func (w *bitWriter) writeHuffmanCode(lengths []int) prefixCode {
+	var symbols []int
+	for s, l := range lengths {
+		if l > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+
+	if len(symbols) <= 2 && (len(symbols) == 0 || symbols[len(symbols)-1] < numLiteralCodes) {
+		if len(symbols) == 0 {
+			// An unused code still needs a symbol.
+			symbols = append(symbols, 0)
+		}
+		w.write(1, 1) // Simple code
+		w.write(uint32(len(symbols)-1), 1)
+		if symbols[0] < 2 {
+			w.write(0, 1)
+			w.write(uint32(symbols[0]), 1)
+		} else {
+			w.write(1, 1)
+			w.write(uint32(symbols[0]), 8)
+		}
+		if len(symbols) == 2 {
+			w.write(uint32(symbols[1]), 8)
+		}
+		return newPrefixCode(lengths)
+	}
+
+	w.write(0, 1) // Normal code
+	tokens := codeLengthTokens(lengths)
+	histogram := make([]uint32, numCodeLengthCodes)
+	for _, t := range tokens {
+		histogram[t.code]++
+	}
+	codeLengthLengths := codeLengths(histogram, maxCodeLengthCodeLength)
+	num := len(codeLengthOrder)
+	for num > 4 && codeLengthLengths[codeLengthOrder[num-1]] == 0 {
+		num--
+	}
+	w.write(uint32(num-4), 4)
+	for _, c := range codeLengthOrder[:num] {
+		w.write(uint32(codeLengthLengths[c]), 3)
+	}
+
+	// All the code lengths are written instead of max_symbol.
+	w.write(0, 1)
+	p := newPrefixCode(codeLengthLengths)
+	for _, t := range tokens {
+		w.writeSymbol(&p, t.code)
+		switch t.code {
+		case codeLengthRepeat:
+			w.write(t.extra, 2)
+		case codeLengthZeros:
+			w.write(t.extra, 3)
+		case codeLengthLongZeros:
+			w.write(t.extra, 7)
+		}
+	}
+	return newPrefixCode(lengths)
+}
+
+// prefixEncode returns the prefix symbol of the length or distance v, and its
+// extra bits, which is the inverse of readPrefixValue.
+func prefixEncode(v int) (symbol int, extraBits uint, extra uint32) {
+	v--
+	if v < 4 {
+		return v, 0, 0
+	}
+	h := bits.Len(uint(v)) - 1
+	second := (v >> (h - 1)) & 1
+	return 2*h + second, uint(h - 1), uint32(v & (1<<(h-1) - 1))
+}
@@ -0,0 +1,4 @@
+// Package mux provides an interface to libwebpmux library to manipulate chunks
+// of WebP container, such as metadata. It requires cgo, and only Metadata is
+// available without it, which webp.Config attaches to the encoded images.
+package mux
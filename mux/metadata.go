@@ -0,0 +1,8 @@
+package mux
+
+// Metadata represents metadata chunks in WebP container.
+type Metadata struct {
+	ICCProfile []byte // ICC profile (ICCP chunk)
+	EXIF       []byte // EXIF metadata (EXIF chunk)
+	XMP        []byte // XMP metadata (XMP chunk)
+}
@@ -0,0 +1,163 @@
+package mux
+
+/*
+#cgo LDFLAGS: -lwebpmux -lwebp -lsharpyuv -lm
+
+#include <stdlib.h>
+#include <webp/mux.h>
+
+static WebPMux* newMux(const uint8_t* data, size_t size) {
+	WebPData bitstream = { data, size };
+	return WebPMuxCreate(&bitstream, 1);
+}
+
+static WebPMuxError setChunk(WebPMux* mux, const char* fourcc, const uint8_t* data, size_t size) {
+	WebPData chunk = { data, size };
+	return WebPMuxSetChunk(mux, fourcc, &chunk, 1);
+}
+*/
+import "C"
+
+import (
+	"unsafe"
+)
+
+// Error corresponds to C.WebPMuxError.
+type Error int
+
+const (
+	ErrNotFound        Error = C.WEBP_MUX_NOT_FOUND
+	ErrInvalidArgument Error = C.WEBP_MUX_INVALID_ARGUMENT
+	ErrBadData         Error = C.WEBP_MUX_BAD_DATA
+	ErrMemoryError     Error = C.WEBP_MUX_MEMORY_ERROR
+	ErrNotEnoughData   Error = C.WEBP_MUX_NOT_ENOUGH_DATA
+)
+
+func (e Error) Error() string {
+	switch e {
+	case ErrNotFound:
+		return "WEBP_MUX_NOT_FOUND"
+	case ErrInvalidArgument:
+		return "WEBP_MUX_INVALID_ARGUMENT"
+	case ErrBadData:
+		return "WEBP_MUX_BAD_DATA"
+	case ErrMemoryError:
+		return "WEBP_MUX_MEMORY_ERROR"
+	case ErrNotEnoughData:
+		return "WEBP_MUX_NOT_ENOUGH_DATA"
+	}
+	return "Unexpected Mux Error"
+}
+
+const (
+	fourccICCP = "ICCP"
+	fourccEXIF = "EXIF"
+	fourccXMP  = "XMP "
+)
+
+// GetMetadata retrieves metadata chunks from data stream. The fields of
+// returned Metadata are nil if the corresponding chunks do not exist.
+func GetMetadata(data []byte) (*Metadata, error) {
+	mux, err := newMux(data)
+	if err != nil {
+		return nil, err
+	}
+	defer C.WebPMuxDelete(mux)
+
+	m := &Metadata{}
+	for _, chunk := range []struct {
+		fourcc string
+		dst    *[]byte
+	}{
+		{fourccICCP, &m.ICCProfile},
+		{fourccEXIF, &m.EXIF},
+		{fourccXMP, &m.XMP},
+	} {
+		if *chunk.dst, err = getChunk(mux, chunk.fourcc); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// SetMetadata sets metadata chunks into data stream, and returns the new data
+// stream. Nil fields of m are left as is in the data stream, and empty but
+// non-nil fields remove the corresponding chunks. If m is nil, data is
+// returned as is.
+func SetMetadata(data []byte, m *Metadata) ([]byte, error) {
+	if m == nil {
+		return data, nil
+	}
+	mux, err := newMux(data)
+	if err != nil {
+		return nil, err
+	}
+	defer C.WebPMuxDelete(mux)
+
+	for _, chunk := range []struct {
+		fourcc string
+		src    []byte
+	}{
+		{fourccICCP, m.ICCProfile},
+		{fourccEXIF, m.EXIF},
+		{fourccXMP, m.XMP},
+	} {
+		if err := setChunk(mux, chunk.fourcc, chunk.src); err != nil {
+			return nil, err
+		}
+	}
+
+	var assembled C.WebPData
+	C.WebPDataInit(&assembled)
+	defer C.WebPDataClear(&assembled)
+	if e := C.WebPMuxAssemble(mux, &assembled); e != C.WEBP_MUX_OK {
+		return nil, Error(e)
+	}
+	return C.GoBytes(unsafe.Pointer(assembled.bytes), C.int(assembled.size)), nil
+}
+
+func newMux(data []byte) (*C.WebPMux, error) {
+	if len(data) == 0 {
+		return nil, ErrNotEnoughData
+	}
+	mux := C.newMux((*C.uint8_t)(&data[0]), C.size_t(len(data)))
+	if mux == nil {
+		return nil, ErrBadData
+	}
+	return mux, nil
+}
+
+func getChunk(mux *C.WebPMux, fourcc string) ([]byte, error) {
+	cFourcc := C.CString(fourcc)
+	defer C.free(unsafe.Pointer(cFourcc))
+
+	var chunk C.WebPData
+	switch e := C.WebPMuxGetChunk(mux, cFourcc, &chunk); e {
+	case C.WEBP_MUX_OK:
+		return C.GoBytes(unsafe.Pointer(chunk.bytes), C.int(chunk.size)), nil
+	case C.WEBP_MUX_NOT_FOUND:
+		return nil, nil
+	default:
+		return nil, Error(e)
+	}
+}
+
+func setChunk(mux *C.WebPMux, fourcc string, data []byte) error {
+	if data == nil {
+		return nil
+	}
+
+	cFourcc := C.CString(fourcc)
+	defer C.free(unsafe.Pointer(cFourcc))
+
+	var e C.WebPMuxError
+	if len(data) == 0 {
+		e = C.WebPMuxDeleteChunk(mux, cFourcc)
+	} else {
+		e = C.setChunk(mux, cFourcc, (*C.uint8_t)(&data[0]), C.size_t(len(data)))
+	}
+	if e != C.WEBP_MUX_OK && e != C.WEBP_MUX_NOT_FOUND {
+		return Error(e)
+	}
+	return nil
+}
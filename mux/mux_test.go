@@ -0,0 +1,95 @@
+//go:build cgo
+
+package mux_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/pixiv/go-libwebp/mux"
+	"github.com/pixiv/go-libwebp/test/util"
+)
+
+func TestGetMetadataWithoutMetadata(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	m, err := mux.GetMetadata(data)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if m.ICCProfile != nil || m.EXIF != nil || m.XMP != nil {
+		t.Errorf("Expected no metadata, but got %+v", m)
+	}
+}
+
+func TestSetMetadata(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	expect := &mux.Metadata{
+		ICCProfile: []byte("icc profile"),
+		EXIF:       []byte("exif"),
+		XMP:        []byte("<x:xmpmeta/>"),
+	}
+
+	out, err := mux.SetMetadata(data, expect)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	m, err := mux.GetMetadata(out)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if !bytes.Equal(m.ICCProfile, expect.ICCProfile) {
+		t.Errorf("Expected ICC profile: %q, but got %q", expect.ICCProfile, m.ICCProfile)
+	}
+	if !bytes.Equal(m.EXIF, expect.EXIF) {
+		t.Errorf("Expected EXIF: %q, but got %q", expect.EXIF, m.EXIF)
+	}
+	if !bytes.Equal(m.XMP, expect.XMP) {
+		t.Errorf("Expected XMP: %q, but got %q", expect.XMP, m.XMP)
+	}
+}
+
+func TestSetMetadataRemovesChunk(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	out, err := mux.SetMetadata(data, &mux.Metadata{EXIF: []byte("exif"), XMP: []byte("xmp")})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	out, err = mux.SetMetadata(out, &mux.Metadata{EXIF: []byte{}})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	m, err := mux.GetMetadata(out)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if m.EXIF != nil {
+		t.Errorf("Expected EXIF to be removed, but got %q", m.EXIF)
+	}
+	if string(m.XMP) != "xmp" {
+		t.Errorf("Expected XMP to be left as is, but got %q", m.XMP)
+	}
+}
+
+func TestSetMetadataWithNil(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	out, err := mux.SetMetadata(data, nil)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if !bytes.Equal(out, data) {
+		t.Errorf("Expected data to be left as is")
+	}
+}
+
+func TestGetMetadataWithInvalidData(t *testing.T) {
+	if _, err := mux.GetMetadata([]byte("not a webp")); !errors.Is(err, mux.ErrBadData) {
+		t.Errorf("Expected %v, but got %v", mux.ErrBadData, err)
+	}
+	if _, err := mux.GetMetadata(nil); err == nil {
+		t.Errorf("Expected error for empty data")
+	}
+}
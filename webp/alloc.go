@@ -0,0 +1,69 @@
+package webp
+
+import (
+	"image"
+	"sync"
+)
+
+// Allocator allocates pixel buffers of decoded images.
+type Allocator interface {
+	// Alloc returns a byte slice whose length is n. The content of the slice
+	// may be arbitrary, because it is overwritten by decoding.
+	Alloc(n int) []byte
+}
+
+// PoolAllocator is an Allocator which reuses pixel buffers with sync.Pool.
+// The buffers of decoded images which are no longer used can be returned to the
+// pool by Release. The zero value is ready to use.
+//
+// A pooled buffer is discarded if it is too small for the requested size, so
+// PoolAllocator works best for images of similar sizes.
+type PoolAllocator struct {
+	pool sync.Pool
+}
+
+// Alloc implements Allocator.Alloc.
+func (a *PoolAllocator) Alloc(n int) []byte {
+	if b, ok := a.pool.Get().(*[]byte); ok && cap(*b) >= n {
+		return (*b)[:n]
+	}
+	return make([]byte, n)
+}
+
+// Release returns the pixel buffer of img to the pool. img must be one of
+// *image.RGBA, *image.NRGBA, *RGBImage, *PackedImage and *YUVAImage which is
+// decoded with the allocator, and must not be used after release.
+func (a *PoolAllocator) Release(img any) {
+	var b []byte
+	switch img := img.(type) {
+	case *image.RGBA:
+		b = img.Pix
+	case *image.NRGBA:
+		b = img.Pix
+	case *RGBImage:
+		b = img.Pix
+	case *PackedImage:
+		b = img.Pix
+	case *YUVAImage:
+		// All planes are allocated as a single buffer which begins with Y.
+		b = img.Y
+	default:
+		return
+	}
+	if cap(b) == 0 {
+		return
+	}
+	b = b[:0]
+	a.pool.Put(&b)
+}
+
+var _ Allocator = &PoolAllocator{}
+
+// alloc allocates a byte slice with the allocator in the options, or make if
+// it is not specified.
+func (options *DecoderOptions) alloc(n int) []byte {
+	if options.Allocator == nil {
+		return make([]byte, n)
+	}
+	return options.Allocator.Alloc(n)
+}
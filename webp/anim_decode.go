@@ -0,0 +1,230 @@
+package webp
+
+/*
+#include <stdlib.h>
+#include <webp/decode.h>
+#include <webp/demux.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"time"
+	"unsafe"
+)
+
+// DisposeMethod specifies how the area of a frame is to be treated before
+// rendering the next frame.
+type DisposeMethod int
+
+const (
+	// DisposeNone leaves the canvas as is.
+	DisposeNone DisposeMethod = C.WEBP_MUX_DISPOSE_NONE
+	// DisposeBackground disposes the frame area to the background color.
+	DisposeBackground DisposeMethod = C.WEBP_MUX_DISPOSE_BACKGROUND
+)
+
+// BlendMethod specifies how a frame is blended with the previous canvas.
+type BlendMethod int
+
+const (
+	// BlendAlpha blends the frame with the canvas using alpha-blending.
+	BlendAlpha BlendMethod = C.WEBP_MUX_BLEND
+	// BlendNone overwrites the canvas area with the frame.
+	BlendNone BlendMethod = C.WEBP_MUX_NO_BLEND
+)
+
+// AnimationDecoderOptions specifies decoding options of animated WebP.
+type AnimationDecoderOptions struct {
+	UseThreads bool   // If true, use multi threads
+	Limits     Limits // Limits of animations to decode, checked before allocating the canvas
+}
+
+// AnimationInfo represents the global properties of animated WebP.
+type AnimationInfo struct {
+	CanvasWidth     int         // Canvas width in pixels
+	CanvasHeight    int         // Canvas height in pixels
+	LoopCount       int         // Number of times to repeat the animation [0 = infinite]
+	BackgroundColor color.NRGBA // Background color of the canvas
+	FrameCount      int         // Number of frames
+}
+
+// AnimationFrame represents a decoded frame of animated WebP.
+type AnimationFrame struct {
+	Image         *image.NRGBA    // Fully composited canvas
+	Timestamp     time.Duration   // Time when the frame is displayed
+	Duration      time.Duration   // Display duration of the frame
+	Rect          image.Rectangle // Area of the canvas which the frame covers
+	DisposeMethod DisposeMethod   // Dispose method of the frame
+	BlendMethod   BlendMethod     // Blend method of the frame
+}
+
+// AnimationDecoder decodes frames of animated WebP one by one.
+// It must be released by Close after use.
+type AnimationDecoder struct {
+	dec   *C.WebPAnimDecoder
+	data  unsafe.Pointer
+	info  AnimationInfo
+	frame int
+}
+
+var errAnimationDecoderInitialize = errors.New("Could not initialize animation decoder")
+var errAnimationDecode = errors.New("Could not decode animation frame")
+
+// NewAnimationDecoder creates an AnimationDecoder which decodes data.
+// If options is nil, default options are used. It returns LimitError if the
+// animation exceeds the limits in the options.
+func NewAnimationDecoder(data []byte, options *AnimationDecoderOptions) (*AnimationDecoder, error) {
+	if len(data) == 0 {
+		return nil, newDecodeError(DecodeStageFeatures, C.VP8_STATUS_NOT_ENOUGH_DATA)
+	}
+	var limits Limits
+	if options != nil {
+		limits = options.Limits
+	}
+	if err := checkAnimationLimits(data, limits); err != nil {
+		return nil, err
+	}
+
+	var decOptions C.WebPAnimDecoderOptions
+	if C.WebPAnimDecoderOptionsInit(&decOptions) == 0 {
+		return nil, errAnimationDecoderInitialize
+	}
+	decOptions.color_mode = C.MODE_RGBA
+	if options != nil && options.UseThreads {
+		decOptions.use_threads = 1
+	}
+
+	// The decoder refers to the data until it is deleted, so it must be in C memory.
+	d := &AnimationDecoder{data: C.CBytes(data)}
+	webpData := C.WebPData{bytes: (*C.uint8_t)(d.data), size: C.size_t(len(data))}
+	d.dec = C.WebPAnimDecoderNew(&webpData, &decOptions)
+	if d.dec == nil {
+		C.free(d.data)
+		return nil, errAnimationDecoderInitialize
+	}
+
+	var info C.WebPAnimInfo
+	if C.WebPAnimDecoderGetInfo(d.dec, &info) == 0 {
+		d.Close()
+		return nil, errAnimationDecoderInitialize
+	}
+	d.info = AnimationInfo{
+		CanvasWidth:     int(info.canvas_width),
+		CanvasHeight:    int(info.canvas_height),
+		LoopCount:       int(info.loop_count),
+		BackgroundColor: bgColorToColor(info.bgcolor),
+		FrameCount:      int(info.frame_count),
+	}
+
+	return d, nil
+}
+
+// checkAnimationLimits checks the size of the canvas and the number of frames
+// against the limits, without allocating the canvas.
+func checkAnimationLimits(data []byte, limits Limits) error {
+	if limits == (Limits{}) {
+		return nil
+	}
+	if err := limits.checkInputBytes(len(data)); err != nil {
+		return err
+	}
+
+	f, status := getFeatures(data)
+	if status != C.VP8_STATUS_OK {
+		return newDecodeError(DecodeStageFeatures, status)
+	}
+	if err := limits.checkSize(f.Width, f.Height); err != nil {
+		return err
+	}
+
+	if limits.MaxFrames > 0 {
+		// The demuxer refers to the data until it is deleted, so it must be in C memory.
+		cdata := C.CBytes(data)
+		defer C.free(cdata)
+		webpData := C.WebPData{bytes: (*C.uint8_t)(cdata), size: C.size_t(len(data))}
+		demux := C.WebPDemux(&webpData)
+		if demux == nil {
+			return errAnimationDecoderInitialize
+		}
+		defer C.WebPDemuxDelete(demux)
+		if err := limits.checkFrames(int(C.WebPDemuxGetI(demux, C.WEBP_FF_FRAME_COUNT))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Info returns the global properties of the animation.
+func (d *AnimationDecoder) Info() AnimationInfo {
+	return d.info
+}
+
+// HasMoreFrames returns true if there are more frames to decode.
+func (d *AnimationDecoder) HasMoreFrames() bool {
+	return C.WebPAnimDecoderHasMoreFrames(d.dec) != 0
+}
+
+// NextFrame decodes the next frame and returns it. The image of returned frame
+// is newly allocated for each call. It returns io.EOF if there are no more
+// frames.
+func (d *AnimationDecoder) NextFrame() (*AnimationFrame, error) {
+	if !d.HasMoreFrames() {
+		return nil, io.EOF
+	}
+
+	var buf *C.uint8_t
+	var timestamp C.int
+	if C.WebPAnimDecoderGetNext(d.dec, &buf, &timestamp) == 0 {
+		return nil, errAnimationDecode
+	}
+	d.frame++
+
+	img := image.NewNRGBA(image.Rect(0, 0, d.info.CanvasWidth, d.info.CanvasHeight))
+	copy(img.Pix, unsafe.Slice((*byte)(buf), len(img.Pix)))
+
+	// Retrieve the properties of the frame from the underlying demuxer
+	var iter C.WebPIterator
+	if C.WebPDemuxGetFrame(C.WebPAnimDecoderGetDemuxer(d.dec), C.int(d.frame), &iter) == 0 {
+		return nil, errAnimationDecode
+	}
+	defer C.WebPDemuxReleaseIterator(&iter)
+
+	// The timestamp given by the decoder is the end time of the frame.
+	duration := time.Duration(iter.duration) * time.Millisecond
+	return &AnimationFrame{
+		Image:         img,
+		Timestamp:     time.Duration(timestamp)*time.Millisecond - duration,
+		Duration:      duration,
+		Rect:          image.Rect(int(iter.x_offset), int(iter.y_offset), int(iter.x_offset+iter.width), int(iter.y_offset+iter.height)),
+		DisposeMethod: DisposeMethod(iter.dispose_method),
+		BlendMethod:   BlendMethod(iter.blend_method),
+	}, nil
+}
+
+// Reset rewinds the decoder to the first frame.
+func (d *AnimationDecoder) Reset() {
+	C.WebPAnimDecoderReset(d.dec)
+	d.frame = 0
+}
+
+// Close releases the resources of the decoder.
+func (d *AnimationDecoder) Close() {
+	if d.dec != nil {
+		C.WebPAnimDecoderDelete(d.dec)
+		d.dec = nil
+	}
+	if d.data != nil {
+		C.free(d.data)
+		d.data = nil
+	}
+}
+
+// bgColorToColor converts the background color of animation, that is stored
+// as 0xAARRGGBB, into color.NRGBA.
+func bgColorToColor(c C.uint32_t) color.NRGBA {
+	return color.NRGBA{R: uint8(c >> 16), G: uint8(c >> 8), B: uint8(c), A: uint8(c >> 24)}
+}
@@ -0,0 +1,153 @@
+package webp
+
+/*
+#include <stdlib.h>
+#include <webp/encode.h>
+#include <webp/mux.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"time"
+	"unsafe"
+)
+
+// AnimationEncoderOptions specifies options of animated WebP encoding. The
+// zero value of each field keeps the default of libwebp, so that the options
+// which set only some fields behave as nil for the others.
+type AnimationEncoderOptions struct {
+	LoopCount       int         // Number of times to repeat the animation [0 = infinite]
+	BackgroundColor color.Color // Background color of the canvas [nil = opaque white]
+	MinimizeSize    bool        // If true, minimize the output size (slow)
+	KMin            int         // Minimum distance between consecutive key frames [0 = default]
+	KMax            int         // Maximum distance between consecutive key frames [0 = default]
+	AllowMixed      bool        // If true, use mixed lossy and lossless frames
+}
+
+// AnimationEncoder encodes a sequence of images into an animated WebP image.
+// It must be released by Close after use.
+type AnimationEncoder struct {
+	enc *C.WebPAnimEncoder
+}
+
+var errAnimationEncoderInitialize = errors.New("Could not initialize animation encoder")
+var errAnimationEncoderClosed = errors.New("Animation encoder is already closed")
+
+// NewAnimationEncoder creates an AnimationEncoder with given canvas size and
+// options. If options is nil, default options are used.
+func NewAnimationEncoder(width, height int, options *AnimationEncoderOptions) (*AnimationEncoder, error) {
+	var encOptions C.WebPAnimEncoderOptions
+	if C.WebPAnimEncoderOptionsInit(&encOptions) == 0 {
+		return nil, errAnimationEncoderInitialize
+	}
+
+	if options != nil {
+		encOptions.anim_params.loop_count = C.int(options.LoopCount)
+		if options.BackgroundColor != nil {
+			encOptions.anim_params.bgcolor = colorToBGColor(color.NRGBAModel.Convert(options.BackgroundColor).(color.NRGBA))
+		}
+		encOptions.minimize_size = boolToValue(options.MinimizeSize)
+		if options.KMin != 0 {
+			encOptions.kmin = C.int(options.KMin)
+		}
+		if options.KMax != 0 {
+			encOptions.kmax = C.int(options.KMax)
+		}
+		encOptions.allow_mixed = boolToValue(options.AllowMixed)
+	}
+
+	enc := C.WebPAnimEncoderNew(C.int(width), C.int(height), &encOptions)
+	if enc == nil {
+		return nil, errAnimationEncoderInitialize
+	}
+
+	return &AnimationEncoder{enc: enc}, nil
+}
+
+// AddFrame adds a frame which is displayed from given timestamp. The size of
+// the frame must be same as the canvas.
+// It supports any image.Image as well as EncodeRGBA.
+func (e *AnimationEncoder) AddFrame(img image.Image, timestamp time.Duration, c *Config) (err error) {
+	if e.enc == nil {
+		return errAnimationEncoderClosed
+	}
+	if err = ValidateConfig(c); err != nil {
+		return
+	}
+
+	pic := (*C.WebPPicture)(C.calloc(1, C.sizeof_WebPPicture))
+	if pic == nil {
+		return errWebPPictureAllocate
+	}
+	defer C.free(unsafe.Pointer(pic))
+
+	if C.WebPPictureInit(pic) == 0 {
+		return errWebPPictureInitialize
+	}
+	defer C.WebPPictureFree(pic)
+
+	if err = importRGBA(pic, img); err != nil {
+		return
+	}
+	// The animation encoder composes frames in ARGB.
+	if pic.use_argb == 0 && C.WebPPictureYUVAToARGB(pic) == 0 {
+		return &EncodeError{encodeErrorCode: EncodeErrorCode(pic.error_code)}
+	}
+
+	if C.WebPAnimEncoderAdd(e.enc, pic, C.int(timestamp.Milliseconds()), c.c.toC()) == 0 {
+		return e.frameError(pic)
+	}
+	return
+}
+
+// Encode assembles added frames and writes them into the writer as animated
+// WebP. endTimestamp specifies the time when the last frame ends.
+func (e *AnimationEncoder) Encode(w io.Writer, endTimestamp time.Duration) (err error) {
+	if e.enc == nil {
+		return errAnimationEncoderClosed
+	}
+	if C.WebPAnimEncoderAdd(e.enc, nil, C.int(endTimestamp.Milliseconds()), nil) == 0 {
+		return e.lastError()
+	}
+
+	var data C.WebPData
+	C.WebPDataInit(&data)
+	defer C.WebPDataClear(&data)
+
+	if C.WebPAnimEncoderAssemble(e.enc, &data) == 0 {
+		return e.lastError()
+	}
+
+	_, err = w.Write(unsafe.Slice((*byte)(data.bytes), int(data.size)))
+	return
+}
+
+// Close releases the resources of the encoder. The other methods return an
+// error after Close.
+func (e *AnimationEncoder) Close() {
+	if e.enc != nil {
+		C.WebPAnimEncoderDelete(e.enc)
+		e.enc = nil
+	}
+}
+
+func (e *AnimationEncoder) frameError(pic *C.WebPPicture) error {
+	if pic.error_code != C.VP8_ENC_OK {
+		return &EncodeError{encodeErrorCode: EncodeErrorCode(pic.error_code)}
+	}
+	return e.lastError()
+}
+
+func (e *AnimationEncoder) lastError() error {
+	return errors.New(C.GoString(C.WebPAnimEncoderGetError(e.enc)))
+}
+
+// colorToBGColor converts color into the background color of animation params,
+// that is stored as 0xAARRGGBB.
+func colorToBGColor(c color.NRGBA) C.uint32_t {
+	return C.uint32_t(c.A)<<24 | C.uint32_t(c.R)<<16 | C.uint32_t(c.G)<<8 | C.uint32_t(c.B)
+}
@@ -0,0 +1,150 @@
+package webp
+
+import (
+	"image"
+	"image/color"
+)
+
+// argbRowFiller returns the function which fills row with the pixels of the
+// row of image.Image beginning at (x0, y).
+func argbRowFiller(img image.Image) func(row []uint32, x0, y int) {
+	switch p := img.(type) {
+	case *image.Paletted:
+		// Colors are kept as they are in the palette, so that lossless
+		// encoding can use them as the color indexing transform.
+		var palette [256]uint32
+		for i, c := range p.Palette {
+			if i >= len(palette) {
+				break
+			}
+			palette[i] = nrgbaToARGB(color.NRGBAModel.Convert(c).(color.NRGBA))
+		}
+		return func(row []uint32, x0, y int) {
+			pix := p.Pix[p.PixOffset(x0, y):]
+			for x := range row {
+				row[x] = palette[pix[x]]
+			}
+		}
+	case *image.Gray:
+		return func(row []uint32, x0, y int) {
+			pix := p.Pix[p.PixOffset(x0, y):]
+			for x := range row {
+				v := uint32(pix[x])
+				row[x] = 0xff000000 | v<<16 | v<<8 | v
+			}
+		}
+	case *image.Gray16:
+		return func(row []uint32, x0, y int) {
+			pix := p.Pix[p.PixOffset(x0, y):]
+			for x := range row {
+				v := uint32(pix[2*x])
+				row[x] = 0xff000000 | v<<16 | v<<8 | v
+			}
+		}
+	case *image.NRGBA64:
+		return func(row []uint32, x0, y int) {
+			pix := p.Pix[p.PixOffset(x0, y):]
+			for x := range row {
+				s := pix[8*x : 8*x+8 : 8*x+8]
+				row[x] = uint32(s[6])<<24 | uint32(s[0])<<16 | uint32(s[2])<<8 | uint32(s[4])
+			}
+		}
+	case *image.RGBA64:
+		return func(row []uint32, x0, y int) {
+			pix := p.Pix[p.PixOffset(x0, y):]
+			for x := range row {
+				s := pix[8*x : 8*x+8 : 8*x+8]
+				c := color.RGBA64{
+					R: uint16(s[0])<<8 | uint16(s[1]),
+					G: uint16(s[2])<<8 | uint16(s[3]),
+					B: uint16(s[4])<<8 | uint16(s[5]),
+					A: uint16(s[6])<<8 | uint16(s[7]),
+				}
+				row[x] = nrgbaToARGB(color.NRGBAModel.Convert(c).(color.NRGBA))
+			}
+		}
+	case *image.CMYK:
+		return func(row []uint32, x0, y int) {
+			pix := p.Pix[p.PixOffset(x0, y):]
+			for x := range row {
+				s := pix[4*x : 4*x+4 : 4*x+4]
+				r, g, b := color.CMYKToRGB(s[0], s[1], s[2], s[3])
+				row[x] = 0xff000000 | uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+			}
+		}
+	}
+	return func(row []uint32, x0, y int) {
+		for x := range row {
+			row[x] = nrgbaToARGB(color.NRGBAModel.Convert(img.At(x0+x, y)).(color.NRGBA))
+		}
+	}
+}
+
+func nrgbaToARGB(c color.NRGBA) uint32 {
+	return uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+}
+
+// imageToARGB returns the pixels of image.Image in ARGB order with straight
+// alpha, whose stride is the width of the image. The colors of image.RGBA are
+// unpremultiplied in the same way as importing it into WebPPicture. Like
+// libwebp, the colors of transparent pixels are discarded unless exact.
+func imageToARGB(img image.Image, exact bool) []uint32 {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	argb := make([]uint32, width*height)
+	var fill func(row []uint32, x0, y int)
+	switch p := img.(type) {
+	case *RGBImage:
+		fill = func(row []uint32, x0, y int) {
+			pix := p.Pix[p.PixOffset(x0, y):]
+			for x := range row {
+				s := pix[3*x : 3*x+3 : 3*x+3]
+				row[x] = 0xff000000 | uint32(s[0])<<16 | uint32(s[1])<<8 | uint32(s[2])
+			}
+		}
+	case *image.NRGBA:
+		fill = func(row []uint32, x0, y int) {
+			pix := p.Pix[p.PixOffset(x0, y):]
+			for x := range row {
+				s := pix[4*x : 4*x+4 : 4*x+4]
+				row[x] = uint32(s[3])<<24 | uint32(s[0])<<16 | uint32(s[1])<<8 | uint32(s[2])
+			}
+		}
+	case *image.RGBA:
+		fill = func(row []uint32, x0, y int) {
+			pix := p.Pix[p.PixOffset(x0, y):]
+			for x := range row {
+				s := pix[4*x : 4*x+4 : 4*x+4]
+				row[x] = unpremultiplyARGB(s[0], s[1], s[2], s[3])
+			}
+		}
+	default:
+		fill = argbRowFiller(img)
+	}
+	for y := 0; y < height; y++ {
+		fill(argb[y*width:(y+1)*width], b.Min.X, b.Min.Y+y)
+	}
+	if !exact {
+		for i, p := range argb {
+			if p>>24 == 0 {
+				argb[i] = 0
+			}
+		}
+	}
+	return argb
+}
+
+// unpremultiplyARGB converts the premultiplied color into ARGB with straight
+// alpha. The samples exceeding alpha are invalid, and clamped.
+func unpremultiplyARGB(r, g, b, a uint8) uint32 {
+	switch a {
+	case 0:
+		return 0
+	case 0xff:
+		return 0xff000000 | uint32(r)<<16 | uint32(g)<<8 | uint32(b)
+	}
+	unpremultiply := func(v uint8) uint32 {
+		return min((uint32(v)*255+uint32(a)/2)/uint32(a), 255)
+	}
+	return uint32(a)<<24 | unpremultiply(r)<<16 | unpremultiply(g)<<8 | unpremultiply(b)
+}
@@ -0,0 +1,464 @@
+package webp
+
+import (
+	"github.com/pixiv/go-libwebp/mux"
+)
+
+// Config specifies WebP encoding configuration. Without cgo, only lossless
+// encoding is supported, and Lossless, Method, Quality and Exact are used.
+type Config struct {
+	c        config
+	metadata *mux.Metadata
+}
+
+// config holds the same parameters as C.WebPConfig, which is converted into
+// C.WebPConfig on encoding with cgo.
+type config struct {
+	lossless         bool
+	quality          float32
+	method           int
+	imageHint        ImageHint
+	targetPSNR       float32
+	targetSize       int
+	segments         int
+	snsStrength      int
+	filterStrength   int
+	filterSharpness  int
+	filterType       FilterType
+	autoFilter       bool
+	alphaCompression int
+	alphaFiltering   int
+	alphaQuality     int
+	pass             int
+	showCompressed   bool
+	preprocessing    Preprocessing
+	partitions       int
+	partitionLimit   int
+	emulateJPEGSize  bool
+	threadLevel      int
+	lowMemory        bool
+	nearLossless     int
+	exact            bool
+	useDeltaPalette  bool
+	useSharpYUV      bool
+	qMin             int
+	qMax             int
+}
+
+// Parameters of presets, which are the same as libwebp. They are used to
+// initialize configurations without cgo.
+var (
+	defaultConfig = config{
+		quality:          75,
+		method:           4,
+		segments:         4,
+		snsStrength:      50,
+		filterStrength:   60,
+		filterType:       StrongFilter,
+		alphaCompression: 1,
+		alphaFiltering:   1,
+		alphaQuality:     100,
+		pass:             1,
+		nearLossless:     100,
+		qMax:             100,
+	}
+	losslessPresets = [...]struct {
+		method  int
+		quality float32
+	}{
+		{0, 0}, {1, 20}, {2, 25}, {3, 30}, {3, 50},
+		{4, 50}, {4, 75}, {4, 90}, {5, 90}, {6, 100},
+	}
+)
+
+// presetConfig returns the parameters of the preset and the quality factor in
+// the same way as WebPConfigPreset.
+func presetConfig(preset Preset, quality float32) config {
+	c := defaultConfig
+	c.quality = quality
+	switch preset {
+	case PresetPicture:
+		c.snsStrength = 80
+		c.filterSharpness = 4
+		c.filterStrength = 35
+		c.preprocessing &^= 2 // No dithering
+	case PresetPhoto:
+		c.snsStrength = 80
+		c.filterSharpness = 3
+		c.filterStrength = 30
+		c.preprocessing |= 2
+	case PresetDrawing:
+		c.snsStrength = 25
+		c.filterSharpness = 6
+		c.filterStrength = 10
+	case PresetIcon:
+		c.snsStrength = 0
+		c.filterStrength = 0 // Disable filtering to retain sharpness
+		c.preprocessing &^= 2
+	case PresetText:
+		c.snsStrength = 0
+		c.filterStrength = 0
+		c.preprocessing &^= 2
+		c.segments = 2
+	}
+	return c
+}
+
+// losslessPresetConfig returns the parameters of the lossless preset of the
+// level in the same way as WebPConfigLosslessPreset. It returns false if the
+// level is out of range.
+func losslessPresetConfig(level int) (config, bool) {
+	if level < 0 || level >= len(losslessPresets) {
+		return config{}, false
+	}
+	c := defaultConfig
+	c.lossless = true
+	c.method = losslessPresets[level].method
+	c.quality = losslessPresets[level].quality
+	return c, true
+}
+
+// valid reports whether the parameters are in range in the same way as
+// WebPValidateConfig.
+func (p *config) valid() bool {
+	return p.quality >= 0 && p.quality <= 100 &&
+		p.targetSize >= 0 &&
+		p.targetPSNR >= 0 &&
+		p.method >= 0 && p.method <= 6 &&
+		p.segments >= 1 && p.segments <= 4 &&
+		p.snsStrength >= 0 && p.snsStrength <= 100 &&
+		p.filterStrength >= 0 && p.filterStrength <= 100 &&
+		p.filterSharpness >= 0 && p.filterSharpness <= 7 &&
+		p.filterType >= 0 && p.filterType <= 1 &&
+		p.pass >= 1 && p.pass <= 10 &&
+		p.qMin >= 0 && p.qMax <= 100 && p.qMin <= p.qMax &&
+		p.preprocessing >= 0 && p.preprocessing <= 7 &&
+		p.partitions >= 0 && p.partitions <= 3 &&
+		p.partitionLimit >= 0 && p.partitionLimit <= 100 &&
+		p.alphaCompression >= 0 &&
+		p.alphaFiltering >= 0 &&
+		p.alphaQuality >= 0 && p.alphaQuality <= 100 &&
+		p.nearLossless >= 0 && p.nearLossless <= 100 &&
+		p.imageHint >= 0 && p.imageHint < HintLast &&
+		p.threadLevel >= 0 && p.threadLevel <= 1
+}
+
+// SetLossless sets lossless parameter that specifies whether to enable lossless
+// encoding.
+func (c *Config) SetLossless(v bool) {
+	c.c.lossless = v
+}
+
+// Lossless returns lossless parameter flag whether to enable lossless encoding.
+func (c *Config) Lossless() bool {
+	return c.c.lossless
+}
+
+// SetQuality sets encoding quality factor between 0 (smallest file) and 100
+// (biggest).
+func (c *Config) SetQuality(v float32) {
+	c.c.quality = v
+}
+
+// Quality returns encoding quality factor.
+func (c *Config) Quality() float32 {
+	return c.c.quality
+}
+
+// SetMethod sets method parameter that specifies quality/speed trade-off
+// (0=fast, 6=slower-better).
+func (c *Config) SetMethod(v int) {
+	c.c.method = v
+}
+
+// Method returns method parameter.
+func (c *Config) Method() int {
+	return c.c.method
+}
+
+// SetImageHint sets hint for image type. It is used to only lossless encoding
+// for now.
+func (c *Config) SetImageHint(v ImageHint) {
+	c.c.imageHint = v
+}
+
+// ImageHint returns hint parameter for image type.
+func (c *Config) ImageHint() ImageHint {
+	return c.c.imageHint
+}
+
+// SetTargetPSNR sets target PSNR value that specifies the minimal distortion to
+// try to achieve. If it sets 0, disable target PSNR.
+func (c *Config) SetTargetPSNR(v float32) {
+	c.c.targetPSNR = v
+}
+
+// TargetPSNR returns target PSNR value.
+func (c *Config) TargetPSNR() float32 {
+	return c.c.targetPSNR
+}
+
+// SetTargetSize sets target size in bytes that specifies the size of encoded
+// WebP to try to achieve. It takes precedence over quality factor. If it sets 0,
+// disable target size.
+func (c *Config) SetTargetSize(v int) {
+	c.c.targetSize = v
+}
+
+// TargetSize returns target size in bytes.
+func (c *Config) TargetSize() int {
+	return c.c.targetSize
+}
+
+// SetSegments sets segments parameter that specifies the maximum number of
+// segments to use, in [1..4].
+func (c *Config) SetSegments(v int) {
+	c.c.segments = v
+}
+
+// Segments returns segments parameter.
+func (c *Config) Segments() int {
+	return c.c.segments
+}
+
+// SetSNSStrength sets SNS strength parameter between 0 (off) and 100 (maximum).
+func (c *Config) SetSNSStrength(v int) {
+	c.c.snsStrength = v
+}
+
+// SNSStrength returns SNS strength parameter.
+func (c *Config) SNSStrength() int {
+	return c.c.snsStrength
+}
+
+// SetFilterStrength sets filter strength parameter between 0 (off) and 100
+// (strongest).
+func (c *Config) SetFilterStrength(v int) {
+	c.c.filterStrength = v
+}
+
+// FilterStrength returns filter strength parameter.
+func (c *Config) FilterStrength() int {
+	return c.c.filterStrength
+}
+
+// SetFilterSharpness sets filter sharpness parameter between 0 (off) and 7
+// (least sharp).
+func (c *Config) SetFilterSharpness(v int) {
+	c.c.filterSharpness = v
+}
+
+// FilterSharpness returns filter sharpness parameter.
+func (c *Config) FilterSharpness() int {
+	return c.c.filterSharpness
+}
+
+// SetFilterType sets filter type parameter.
+func (c *Config) SetFilterType(v FilterType) {
+	c.c.filterType = v
+}
+
+// FilterType returns filter type parameter.
+func (c *Config) FilterType() FilterType {
+	return c.c.filterType
+}
+
+// SetAutoFilter sets auto filter flag that specifies whether to auto adjust
+// filter strength.
+func (c *Config) SetAutoFilter(v bool) {
+	c.c.autoFilter = v
+}
+
+// AutoFilter returns auto filter flag.
+func (c *Config) AutoFilter() bool {
+	return c.c.autoFilter
+}
+
+// SetAlphaCompression sets alpha compression parameter.
+func (c *Config) SetAlphaCompression(v int) {
+	c.c.alphaCompression = v
+}
+
+// AlphaCompression returns alpha compression parameter.
+func (c *Config) AlphaCompression() int {
+	return c.c.alphaCompression
+}
+
+// SetAlphaFiltering sets alpha filtering parameter.
+func (c *Config) SetAlphaFiltering(v int) {
+	c.c.alphaFiltering = v
+}
+
+// AlphaFiltering returns alpha filtering parameter.
+func (c *Config) AlphaFiltering() int {
+	return c.c.alphaFiltering
+}
+
+// SetAlphaQuality sets alpha quality parameter.
+func (c *Config) SetAlphaQuality(v int) {
+	c.c.alphaQuality = v
+}
+
+// AlphaQuality returns alpha quality parameter.
+func (c *Config) AlphaQuality() int {
+	return c.c.alphaQuality
+}
+
+// SetPass sets pass parameter that specifies number of entropy-analysis passes
+// between 1 and 10.
+func (c *Config) SetPass(v int) {
+	c.c.pass = v
+}
+
+// Pass returns pass parameter.
+func (c *Config) Pass() int {
+	return c.c.pass
+}
+
+// SetShowCompressed sets the flag whether to export the compressed picture
+// back. In-loop filtering is not applied.
+func (c *Config) SetShowCompressed(v bool) {
+	c.c.showCompressed = v
+}
+
+// ShowCompressed returns the flag whether to export the compressed picture.
+func (c *Config) ShowCompressed() bool {
+	return c.c.showCompressed
+}
+
+// SetPreprocessing sets preprocessing filter.
+func (c *Config) SetPreprocessing(v Preprocessing) {
+	c.c.preprocessing = v
+}
+
+// Preprocessing returns preprocessing filter.
+func (c *Config) Preprocessing() Preprocessing {
+	return c.c.preprocessing
+}
+
+// SetPartitions sets partitions parameter.
+func (c *Config) SetPartitions(v int) {
+	c.c.partitions = v
+}
+
+// Partitions returns partitions parameter.
+func (c *Config) Partitions() int {
+	return c.c.partitions
+}
+
+// SetPartitionLimit returns partition limit parameter.
+func (c *Config) SetPartitionLimit(v int) {
+	c.c.partitionLimit = v
+}
+
+// PartitionLimit returns partition limit parameter.
+func (c *Config) PartitionLimit() int {
+	return c.c.partitionLimit
+}
+
+// SetEmulateJPEGSize sets flag whether the compression parameters remaps to
+// match the expected output size from JPEG compression.
+func (c *Config) SetEmulateJPEGSize(v bool) {
+	c.c.emulateJPEGSize = v
+}
+
+// EmulateJPEGSize returns the flag whether to enable emulating JPEG size.
+func (c *Config) EmulateJPEGSize() bool {
+	return c.c.emulateJPEGSize
+}
+
+// SetThreadLevel sets thread level parameter. If non-zero value is specified,
+// try and use multi-threaded encoding.
+func (c *Config) SetThreadLevel(v int) {
+	c.c.threadLevel = v
+}
+
+// ThreadLevel returns thread level parameter.
+func (c *Config) ThreadLevel() int {
+	return c.c.threadLevel
+}
+
+// SetLowMemory sets flag whether to reduce memory usage.
+func (c *Config) SetLowMemory(v bool) {
+	c.c.lowMemory = v
+}
+
+// LowMemory returns low memory flag.
+func (c *Config) LowMemory() bool {
+	return c.c.lowMemory
+}
+
+// SetNearLossless sets near lossless encoding factor between 0 (max loss) and
+// 100 (disable near lossless encoding, default).
+func (c *Config) SetNearLossless(v int) {
+	c.c.nearLossless = v
+}
+
+// NearLossless returns near lossless encoding factor.
+func (c *Config) NearLossless() int {
+	return c.c.nearLossless
+}
+
+// SetExact sets the flag whether to preserve the exact RGB values under
+// transparent area.
+func (c *Config) SetExact(v bool) {
+	c.c.exact = v
+}
+
+// Exact returns exact flag.
+func (c *Config) Exact() bool {
+	return c.c.exact
+}
+
+// SetUseDeltaPalette sets the flag whether to use delta palette. It is reserved
+// for future lossless feature.
+func (c *Config) SetUseDeltaPalette(v bool) {
+	c.c.useDeltaPalette = v
+}
+
+// UseDeltaPalette returns the flag whether to use delta palette.
+func (c *Config) UseDeltaPalette() bool {
+	return c.c.useDeltaPalette
+}
+
+// SetUseSharpYUV sets the flag whether to use sharp (and slow) RGB->YUV
+// conversion.
+func (c *Config) SetUseSharpYUV(v bool) {
+	c.c.useSharpYUV = v
+}
+
+// UseSharpYUV returns the flag whether to use sharp RGB->YUV conversion.
+func (c *Config) UseSharpYUV() bool {
+	return c.c.useSharpYUV
+}
+
+// SetQMin sets minimum permissible quality factor between 0 and 100.
+func (c *Config) SetQMin(v int) {
+	c.c.qMin = v
+}
+
+// QMin returns minimum permissible quality factor.
+func (c *Config) QMin() int {
+	return c.c.qMin
+}
+
+// SetQMax sets maximum permissible quality factor between 0 and 100.
+func (c *Config) SetQMax(v int) {
+	c.c.qMax = v
+}
+
+// QMax returns maximum permissible quality factor.
+func (c *Config) QMax() int {
+	return c.c.qMax
+}
+
+// SetMetadata sets metadata such as ICC profile, EXIF and XMP, which is
+// attached to the encoded WebP. If nil is specified, no metadata is attached.
+func (c *Config) SetMetadata(m *mux.Metadata) {
+	c.metadata = m
+}
+
+// Metadata returns metadata which is attached to the encoded WebP.
+func (c *Config) Metadata() *mux.Metadata {
+	return c.metadata
+}
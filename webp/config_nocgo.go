@@ -0,0 +1,33 @@
+//go:build !cgo
+
+package webp
+
+// ConfigPreset returns initialized configuration with given preset and quality
+// factor.
+func ConfigPreset(preset Preset, quality float32) (*Config, error) {
+	c := &Config{c: presetConfig(preset, quality)}
+	if ValidateConfig(c) != nil {
+		return nil, errInitializeWebPConfig
+	}
+	return c, nil
+}
+
+// ConfigLosslessPreset returns initialized configuration for lossless encoding.
+// Given level specifies desired efficiency level between 0 (fastest, lowest
+// compression) and 9 (slower, best compression).
+func ConfigLosslessPreset(level int) (*Config, error) {
+	p, ok := losslessPresetConfig(level)
+	if !ok {
+		return nil, errInitializeWebPConfig
+	}
+	return &Config{c: p}, nil
+}
+
+// ValidateConfig reports an error if a parameter of the configuration is out of
+// range, which is the same as libwebp.
+func ValidateConfig(c *Config) error {
+	if !c.c.valid() {
+		return errInvalidConfiguration
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+//go:build cgo
+
+package webp
+
+import (
+	"testing"
+)
+
+// The parameters of presets and the validation in Go are used without cgo, so
+// they are compared with libwebp here.
+
+func TestPresetConfigMatchesLibwebp(t *testing.T) {
+	presets := []Preset{PresetDefault, PresetPicture, PresetPhoto, PresetDrawing, PresetIcon, PresetText}
+	for _, preset := range presets {
+		for _, quality := range []float32{0, 42.5, 75, 100} {
+			c, err := ConfigPreset(preset, quality)
+			if err != nil {
+				t.Fatalf("Got Error: %v", err)
+			}
+			if got := presetConfig(preset, quality); got != c.c {
+				t.Errorf("Preset %d of quality %v: Expected %+v, but got %+v", preset, quality, c.c, got)
+			}
+		}
+	}
+
+	for level := -1; level <= 10; level++ {
+		c, err := ConfigLosslessPreset(level)
+		got, ok := losslessPresetConfig(level)
+		if ok != (err == nil) {
+			t.Errorf("Lossless preset %d: Expected error %v, but got ok %v", level, err, ok)
+			continue
+		}
+		if ok && got != c.c {
+			t.Errorf("Lossless preset %d: Expected %+v, but got %+v", level, c.c, got)
+		}
+	}
+}
+
+func TestValidConfigMatchesLibwebp(t *testing.T) {
+	tests := []func(c *Config){
+		func(c *Config) {},
+		func(c *Config) { c.SetQuality(101) },
+		func(c *Config) { c.SetTargetSize(-1) },
+		func(c *Config) { c.SetTargetPSNR(-1) },
+		func(c *Config) { c.SetMethod(7) },
+		func(c *Config) { c.SetImageHint(HintLast) },
+		func(c *Config) { c.SetSegments(0) },
+		func(c *Config) { c.SetSNSStrength(101) },
+		func(c *Config) { c.SetFilterStrength(-1) },
+		func(c *Config) { c.SetFilterSharpness(8) },
+		func(c *Config) { c.SetFilterType(2) },
+		func(c *Config) { c.SetAlphaCompression(-1) },
+		func(c *Config) { c.SetAlphaFiltering(-1) },
+		func(c *Config) { c.SetAlphaQuality(101) },
+		func(c *Config) { c.SetPass(11) },
+		func(c *Config) { c.SetPreprocessing(8) },
+		func(c *Config) { c.SetPartitions(4) },
+		func(c *Config) { c.SetPartitionLimit(101) },
+		func(c *Config) { c.SetThreadLevel(2) },
+		func(c *Config) { c.SetNearLossless(101) },
+		func(c *Config) { c.SetQMin(50); c.SetQMax(40) },
+		func(c *Config) { c.SetQMax(101) },
+	}
+
+	for i, tt := range tests {
+		c, err := ConfigPreset(PresetDefault, 75)
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+		tt(c)
+		if expect := ValidateConfig(c) == nil; c.c.valid() != expect {
+			t.Errorf("Test %d: Expected valid %v for %+v", i, expect, c.c)
+		}
+	}
+}
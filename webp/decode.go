@@ -3,39 +3,21 @@ package webp
 /*
 #include <stdlib.h>
 #include <webp/decode.h>
-
-static VP8StatusCode CheckDecBuffer(const WebPDecBuffer* const buffer);
-
 */
 import "C"
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"image"
+	"runtime"
 	"unsafe"
 )
 
-// DecoderOptions specifies decoding options of WebP.
-type DecoderOptions struct {
-	BypassFiltering        bool            // If true, bypass filtering process
-	NoFancyUpsampling      bool            // If true, do not fancy upsampling
-	Crop                   image.Rectangle // Do cropping if image.Rectangle is not empty.
-	Scale                  image.Rectangle // Do scaling if image.Rectangle is not empty.
-	UseThreads             bool            // If true, use multi threads
-	DitheringStrength      int             // Specify dithering strength [0=Off .. 100=full]
-	Flip                   bool            // If true, flip output vertically
-	AlphaDitheringStrength int             // Specify alpha dithering strength in [0..100]
-}
-
-// BitstreamFeatures represents the image properties which are retrived from
-// data stream.
-type BitstreamFeatures struct {
-	Width        int  // Image width in pixels
-	Height       int  // Image height in pixles
-	HasAlpha     bool // True if data stream contains a alpha channel.
-	HasAnimation bool // True if data stream is an animation
-	Format       int  // Image compression format
+// newDecodeError returns DecodeError of the status at the stage.
+func newDecodeError(stage DecodeStage, status C.VP8StatusCode) error {
+	return &DecodeError{Stage: stage, Status: Status(status)}
 }
 
 // GetDecoderVersion returns decoder's version number, packed in hexadecimal.
@@ -44,187 +26,482 @@ func GetDecoderVersion() (v int) {
 	return int(C.WebPGetDecoderVersion())
 }
 
-// GetInfo retrives width/height from data bytes.
+// GetInfo retrives width/height from data bytes. It returns zero if data is
+// not a valid WebP header. Use GetInfoWithError to know the reason.
 func GetInfo(data []byte) (width, height int) {
+	width, height, _ = GetInfoWithError(data)
+	return
+}
+
+// GetInfoWithError retrives width/height from data bytes. It returns
+// DecodeError if data is not a valid WebP header.
+func GetInfoWithError(data []byte) (width, height int, err error) {
+	if len(data) == 0 {
+		return 0, 0, newDecodeError(DecodeStageFeatures, C.VP8_STATUS_NOT_ENOUGH_DATA)
+	}
+
 	var w, h C.int
-	C.WebPGetInfo((*C.uint8_t)(&data[0]), (C.size_t)(len(data)), &w, &h)
-	return int(w), int(h)
+	if C.WebPGetInfo((*C.uint8_t)(&data[0]), (C.size_t)(len(data)), &w, &h) == 0 {
+		// WebPGetInfo does not tell the reason of failure.
+		_, status := getFeatures(data)
+		if status == C.VP8_STATUS_OK {
+			status = C.VP8_STATUS_BITSTREAM_ERROR
+		}
+		return 0, 0, newDecodeError(DecodeStageFeatures, status)
+	}
+	return int(w), int(h), nil
 }
 
 // GetFeatures returns features as BitstreamFeatures retrived from data stream.
 func GetFeatures(data []byte) (f *BitstreamFeatures, err error) {
+	f, status := getFeatures(data)
+	if status != C.VP8_STATUS_OK {
+		return nil, newDecodeError(DecodeStageFeatures, status)
+	}
+	return
+}
+
+// getFeatures retrives features from data stream, and returns them with the
+// status code of WebPGetFeatures.
+func getFeatures(data []byte) (*BitstreamFeatures, C.VP8StatusCode) {
+	if len(data) == 0 {
+		return nil, C.VP8_STATUS_NOT_ENOUGH_DATA
+	}
+
 	var cf C.WebPBitstreamFeatures
 	status := C.WebPGetFeatures((*C.uint8_t)(&data[0]), (C.size_t)(len(data)), &cf)
-
 	if status != C.VP8_STATUS_OK {
-		return nil, fmt.Errorf("WebPGetFeatures returns unexpected status: %s", statusString(status))
+		return nil, status
 	}
 
-	f = &BitstreamFeatures{
+	return &BitstreamFeatures{
 		Width:        int(cf.width), // TODO: use Rectangle instaed?
 		Height:       int(cf.height),
 		HasAlpha:     cf.has_alpha > 0,
 		HasAnimation: cf.has_animation > 0,
 		Format:       int(cf.format),
-	}
-	return
+	}, status
 }
 
 // DecodeYUVA decodes WebP image into YUV image with alpha channel, and returns
 // it as *YUVAImage.
 func DecodeYUVA(data []byte, options *DecoderOptions) (img *YUVAImage, err error) {
-	config, err := initDecoderConfig(options)
+	return decodeYUVA(context.Background(), data, options, func(hasAlpha bool) ColorSpace {
+		if hasAlpha {
+			return YUV420A
+		}
+		return YUV420
+	})
+}
+
+// decodeYUVA decodes WebP image into YUV image, whose color space is selected
+// by colorSpace according to whether the bitstream has alpha channel.
+func decodeYUVA(ctx context.Context, data []byte, options *DecoderOptions, colorSpace func(hasAlpha bool) ColorSpace) (img *YUVAImage, err error) {
+	options = options.orZero()
+	config, outWidth, outHeight, err := initDecoder(data, options)
 	if err != nil {
 		return nil, err
 	}
 
-	cDataPtr := (*C.uint8_t)(&data[0])
-	cDataSize := (C.size_t)(len(data))
+	// Allocate image and fill into buffer
+	img = newYUVAImage(image.Rect(0, 0, outWidth, outHeight), colorSpace(config.input.has_alpha > 0), options.alloc)
+	setYUVABuffer(config, img)
 
-	// Retrive WebP features from data stream
-	if status := C.WebPGetFeatures(cDataPtr, cDataSize, &config.input); status != C.VP8_STATUS_OK {
-		return nil, fmt.Errorf("Could not get features from the data stream, return %s", statusString(status))
+	if err := decode(ctx, data, config); err != nil {
+		return nil, err
 	}
+	return
+}
 
-	outWidth, outHeight := calcOutputSize(config)
-	buf := (*C.WebPYUVABuffer)(unsafe.Pointer(&config.output.u[0]))
+// DecodeRGBA decodes WebP image into rgbA image and returns it as an *image.RGBA.
+func DecodeRGBA(data []byte, options *DecoderOptions) (img *image.RGBA, err error) {
+	return decodeRGBA(context.Background(), data, options)
+}
 
-	// Set up output configurations
-	colorSpace := YUV420
-	config.output.colorspace = C.MODE_YUV
-	if config.input.has_alpha > 0 {
-		colorSpace = YUV420A
-		config.output.colorspace = C.MODE_YUVA
+func decodeRGBA(ctx context.Context, data []byte, options *DecoderOptions) (img *image.RGBA, err error) {
+	options = options.orZero()
+	config, outWidth, outHeight, err := initDecoder(data, options)
+	if err != nil {
+		return nil, err
 	}
-	config.output.is_external_memory = 1
 
-	// Allocate image and fill into buffer
-	img = NewYUVAImage(image.Rect(0, 0, outWidth, outHeight), colorSpace)
-	buf.y = (*C.uint8_t)(&img.Y[0])
-	buf.u = (*C.uint8_t)(&img.Cb[0])
-	buf.v = (*C.uint8_t)(&img.Cr[0])
-	buf.a = nil
-	buf.y_stride = C.int(img.YStride)
-	buf.u_stride = C.int(img.CStride)
-	buf.v_stride = C.int(img.CStride)
-	buf.a_stride = 0
-	buf.y_size = C.size_t(len(img.Y))
-	buf.u_size = C.size_t(len(img.Cb))
-	buf.v_size = C.size_t(len(img.Cr))
-	buf.a_size = 0
-
-	if config.input.has_alpha > 0 {
-		buf.a = (*C.uint8_t)(&img.A[0])
-		buf.a_stride = C.int(img.AStride)
-		buf.a_size = C.size_t(len(img.A))
+	// Allocate output image
+	img = &image.RGBA{
+		Pix:    options.alloc(4 * outWidth * outHeight),
+		Stride: 4 * outWidth,
+		Rect:   image.Rect(0, 0, outWidth, outHeight),
 	}
+	setRGBABuffer(config, C.MODE_rgbA, img.Pix, img.Stride)
 
-	if status := C.WebPDecode(cDataPtr, cDataSize, config); status != C.VP8_STATUS_OK {
-		return nil, fmt.Errorf("Could not decode data stream, return %s", statusString(status))
+	if err := decode(ctx, data, config); err != nil {
+		return nil, err
 	}
-
 	return
 }
 
-// DecodeRGBA decodes WebP image into rgbA image and returns it as an *image.RGBA.
-func DecodeRGBA(data []byte, options *DecoderOptions) (img *image.RGBA, err error) {
-	config, err := initDecoderConfig(options)
+// DecodeNRGBA decodes WebP image into RGBA image and returns it as an *image.NRGBA.
+func DecodeNRGBA(data []byte, options *DecoderOptions) (img *image.NRGBA, err error) {
+	return decodeNRGBA(context.Background(), data, options)
+}
+
+func decodeNRGBA(ctx context.Context, data []byte, options *DecoderOptions) (img *image.NRGBA, err error) {
+	options = options.orZero()
+	config, outWidth, outHeight, err := initDecoder(data, options)
 	if err != nil {
 		return nil, err
 	}
 
-	cDataPtr := (*C.uint8_t)(&data[0])
-	cDataSize := (C.size_t)(len(data))
+	// Allocate output image
+	img = &image.NRGBA{
+		Pix:    options.alloc(4 * outWidth * outHeight),
+		Stride: 4 * outWidth,
+		Rect:   image.Rect(0, 0, outWidth, outHeight),
+	}
+	setRGBABuffer(config, C.MODE_RGBA, img.Pix, img.Stride)
+
+	if err := decode(ctx, data, config); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// DecodeRGB decodes WebP image into RGB image without alpha channel and
+// returns it as an *RGBImage.
+func DecodeRGB(data []byte, options *DecoderOptions) (img *RGBImage, err error) {
+	return decodeRGB(context.Background(), data, options)
+}
 
-	// Retrive WebP features
-	if status := C.WebPGetFeatures(cDataPtr, cDataSize, &config.input); status != C.VP8_STATUS_OK {
-		return nil, fmt.Errorf("Could not get features from the data stream, return %s", statusString(status))
+func decodeRGB(ctx context.Context, data []byte, options *DecoderOptions) (img *RGBImage, err error) {
+	options = options.orZero()
+	config, outWidth, outHeight, err := initDecoder(data, options)
+	if err != nil {
+		return nil, err
 	}
 
 	// Allocate output image
-	outWidth, outHeight := calcOutputSize(config)
-	img = image.NewRGBA(image.Rect(0, 0, outWidth, outHeight))
+	img = &RGBImage{
+		Pix:    options.alloc(3 * outWidth * outHeight),
+		Stride: 3 * outWidth,
+		Rect:   image.Rect(0, 0, outWidth, outHeight),
+	}
+	setRGBABuffer(config, C.MODE_RGB, img.Pix, img.Stride)
 
-	// Set up output configurations
-	config.output.colorspace = C.MODE_rgbA
-	config.output.is_external_memory = 1
+	if err := decode(ctx, data, config); err != nil {
+		return nil, err
+	}
+	return
+}
 
-	// Allocate WebPRGBABuffer and fill in the pointers to output image
-	buf := (*C.WebPRGBABuffer)(unsafe.Pointer(&config.output.u[0]))
-	buf.rgba = (*C.uint8_t)(&img.Pix[0])
-	buf.stride = C.int(img.Stride)
-	buf.size = (C.size_t)(len(img.Pix))
+// DecodePacked decodes WebP image into the image of the color mode, which must
+// be one of RGB modes, and returns it as a *PackedImage.
+func DecodePacked(data []byte, mode ColorMode, options *DecoderOptions) (img *PackedImage, err error) {
+	return decodePacked(context.Background(), data, mode, options)
+}
 
-	// Decode
-	if status := C.WebPDecode(cDataPtr, cDataSize, config); status != C.VP8_STATUS_OK {
-		return nil, fmt.Errorf("Could not decode data stream, return %s", statusString(status))
+func decodePacked(ctx context.Context, data []byte, mode ColorMode, options *DecoderOptions) (img *PackedImage, err error) {
+	options = options.orZero()
+	if !mode.IsRGB() {
+		return nil, fmt.Errorf("Color mode %d is not supported by PackedImage", mode)
 	}
 
+	config, outWidth, outHeight, err := initDecoder(data, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Allocate output image
+	img = newPackedImage(image.Rect(0, 0, outWidth, outHeight), mode, options.alloc)
+	setRGBABuffer(config, C.WEBP_CSP_MODE(mode), img.Pix, img.Stride)
+
+	if err := decode(ctx, data, config); err != nil {
+		return nil, err
+	}
 	return
 }
 
-// DecodeNRGBA decodes WebP image into RGBA image and returns it as an *image.NRGBA.
-func DecodeNRGBA(data []byte, options *DecoderOptions) (img *image.NRGBA, err error) {
-	config, err := initDecoderConfig(options)
+// DecodeTo decodes WebP image into the image of the color mode. The type of
+// returned image depends on the color mode:
+//
+//	ModeRGB:               *RGBImage
+//	ModeRGBA:              *image.NRGBA
+//	ModePremultipliedRGBA: *image.RGBA
+//	ModeYUV:               *YUVAImage of YUV420
+//	ModeYUVA:              *YUVAImage of YUV420A
+//	Other RGB modes:       *PackedImage
+func DecodeTo(data []byte, mode ColorMode, options *DecoderOptions) (image.Image, error) {
+	return DecodeToContext(context.Background(), data, mode, options)
+}
+
+// DecodeToContext decodes WebP image into the image of the color mode as well
+// as DecodeTo. Decoding is aborted when ctx is done, and ctx.Err() is
+// returned.
+func DecodeToContext(ctx context.Context, data []byte, mode ColorMode, options *DecoderOptions) (image.Image, error) {
+	var img image.Image
+	var err error
+	switch mode {
+	case ModeRGB:
+		img, err = decodeRGB(ctx, data, options)
+	case ModeRGBA:
+		img, err = decodeNRGBA(ctx, data, options)
+	case ModePremultipliedRGBA:
+		img, err = decodeRGBA(ctx, data, options)
+	case ModeYUV:
+		img, err = decodeYUVA(ctx, data, options, func(bool) ColorSpace { return YUV420 })
+	case ModeYUVA:
+		img, err = decodeYUVA(ctx, data, options, func(bool) ColorSpace { return YUV420A })
+	default:
+		img, err = decodePacked(ctx, data, mode, options)
+	}
 	if err != nil {
 		return nil, err
 	}
+	return img, nil
+}
 
-	cDataPtr := (*C.uint8_t)(&data[0])
-	cDataSize := (C.size_t)(len(data))
+// DecodeInto decodes WebP image into the existing image dst, which must be
+// one of *image.RGBA, *image.NRGBA, *RGBImage, *PackedImage and *YUVAImage. The size of dst
+// must be equal to the size of output image, which is the size of the
+// bitstream, or of Crop or Scale in the options. dst may be a sub-image, or may
+// have arbitrary stride. It returns DecodeError at DecodeStageBufferCheck if
+// the size or the pixel buffer of dst does not fit the output image, or if dst
+// is *YUVAImage whose origin is at odd coordinates.
+//
+// The alpha channel is dropped if dst is *RGBImage, *PackedImage of the color
+// mode without alpha channel, or *YUVAImage whose color space is YUV420, and
+// it is filled with opaque if the bitstream does not have alpha channel.
+func DecodeInto(data []byte, dst any, options *DecoderOptions) error {
+	return DecodeIntoContext(context.Background(), data, dst, options)
+}
 
-	// Retrive WebP features
-	if status := C.WebPGetFeatures(cDataPtr, cDataSize, &config.input); status != C.VP8_STATUS_OK {
-		return nil, fmt.Errorf("Could not get features from the data stream, return %s", statusString(status))
+// DecodeIntoContext decodes WebP image into the existing image dst as well as
+// DecodeInto. Decoding is aborted when ctx is done, and ctx.Err() is returned.
+// dst may be partially decoded then.
+func DecodeIntoContext(ctx context.Context, data []byte, dst any, options *DecoderOptions) error {
+	options = options.orZero()
+	config, outWidth, outHeight, err := initDecoder(data, options)
+	if err != nil {
+		return err
 	}
 
-	// Allocate output image
-	outWidth, outHeight := calcOutputSize(config)
-	img = image.NewNRGBA(image.Rect(0, 0, outWidth, outHeight))
+	var rect image.Rectangle
+	var ok bool
+	switch dst := dst.(type) {
+	case *image.RGBA:
+		rect = dst.Rect
+		ok = checkBuffer(len(dst.Pix)-dst.PixOffset(rect.Min.X, rect.Min.Y), dst.Stride, 4*outWidth, outHeight)
+	case *image.NRGBA:
+		rect = dst.Rect
+		ok = checkBuffer(len(dst.Pix)-dst.PixOffset(rect.Min.X, rect.Min.Y), dst.Stride, 4*outWidth, outHeight)
+	case *RGBImage:
+		rect = dst.Rect
+		ok = checkBuffer(len(dst.Pix)-dst.PixOffset(rect.Min.X, rect.Min.Y), dst.Stride, 3*outWidth, outHeight)
+	case *PackedImage:
+		if !dst.Mode.IsRGB() {
+			return fmt.Errorf("Color mode %d is not supported by PackedImage", dst.Mode)
+		}
+		rect = dst.Rect
+		ok = checkBuffer(len(dst.Pix)-dst.PixOffset(rect.Min.X, rect.Min.Y), dst.Stride, dst.Mode.BytesPerPixel()*outWidth, outHeight)
+	case *YUVAImage:
+		if dst.ColorSpace == YUV420A && dst.A == nil {
+			return errors.New("Destination image of YUV420A does not have alpha plane")
+		}
+		rect = dst.Rect
+		cw, ch := (outWidth+1)/2, (outHeight+1)/2
+		// libwebp writes each chroma sample for the 2x2 pixels from even
+		// coordinates, so the chroma planes of a sub-image at odd coordinates
+		// cannot be shared.
+		ok = rect.Min.X%2 == 0 && rect.Min.Y%2 == 0 &&
+			checkBuffer(len(dst.Y), dst.YStride, outWidth, outHeight) &&
+			checkBuffer(len(dst.Cb), dst.CStride, cw, ch) &&
+			checkBuffer(len(dst.Cr), dst.CStride, cw, ch) &&
+			(dst.ColorSpace != YUV420A || checkBuffer(len(dst.A), dst.AStride, outWidth, outHeight))
+	default:
+		return errUnsupportedImageType
+	}
+	if rect.Dx() != outWidth || rect.Dy() != outHeight || !ok {
+		return &DecodeError{Stage: DecodeStageBufferCheck, Status: StatusInvalidParam}
+	}
+
+	switch dst := dst.(type) {
+	case *image.RGBA:
+		setRGBABuffer(config, C.MODE_rgbA, dst.Pix[dst.PixOffset(rect.Min.X, rect.Min.Y):], dst.Stride)
+	case *image.NRGBA:
+		setRGBABuffer(config, C.MODE_RGBA, dst.Pix[dst.PixOffset(rect.Min.X, rect.Min.Y):], dst.Stride)
+	case *RGBImage:
+		setRGBABuffer(config, C.MODE_RGB, dst.Pix[dst.PixOffset(rect.Min.X, rect.Min.Y):], dst.Stride)
+	case *PackedImage:
+		setRGBABuffer(config, C.WEBP_CSP_MODE(dst.Mode), dst.Pix[dst.PixOffset(rect.Min.X, rect.Min.Y):], dst.Stride)
+	case *YUVAImage:
+		setYUVABuffer(config, dst)
+	}
+
+	return decode(ctx, data, config)
+}
+
+// initDecoder initializes a decoder configuration with the options and the
+// features retrieved from data stream, and returns it with the size of output
+// image. It returns LimitError if the data stream, the bitstream or the output
+// image exceeds the limits in the options.
+func initDecoder(data []byte, options *DecoderOptions) (config *C.WebPDecoderConfig, width, height int, err error) {
+	config, err = initDecoderConfig(options)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	if len(data) == 0 {
+		return nil, 0, 0, newDecodeError(DecodeStageFeatures, C.VP8_STATUS_NOT_ENOUGH_DATA)
+	}
+	if err := options.Limits.checkInputBytes(len(data)); err != nil {
+		return nil, 0, 0, err
+	}
+
+	// Retrive WebP features from data stream
+	if status := C.WebPGetFeatures((*C.uint8_t)(&data[0]), (C.size_t)(len(data)), &config.input); status != C.VP8_STATUS_OK {
+		return nil, 0, 0, newDecodeError(DecodeStageFeatures, status)
+	}
+	if err := options.Limits.checkSize(int(config.input.width), int(config.input.height)); err != nil {
+		return nil, 0, 0, err
+	}
+
+	width, height, err = calcOutputSize(config)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if err := options.Limits.checkSize(width, height); err != nil {
+		return nil, 0, 0, err
+	}
+	return
+}
+
+// checkBuffer reports whether the buffer of size bytes can hold height rows of
+// rowSize bytes with the stride, in the same way as CheckDecBuffer of libwebp.
+func checkBuffer(size, stride, rowSize, height int) bool {
+	return stride >= rowSize && size >= stride*(height-1)+rowSize
+}
 
-	// Set up output configurations
-	config.output.colorspace = C.MODE_RGBA
+// setRGBABuffer sets up the decoder configuration to decode into pix, whose
+// first element is the top-left pixel of output image.
+func setRGBABuffer(config *C.WebPDecoderConfig, mode C.WEBP_CSP_MODE, pix []uint8, stride int) {
+	config.output.colorspace = mode
 	config.output.is_external_memory = 1
 
-	// Allocate WebPRGBABuffer and fill in the pointers to output image
+	// Fill in the pointers to output image
 	buf := (*C.WebPRGBABuffer)(unsafe.Pointer(&config.output.u[0]))
-	buf.rgba = (*C.uint8_t)(&img.Pix[0])
-	buf.stride = C.int(img.Stride)
-	buf.size = (C.size_t)(len(img.Pix))
+	buf.rgba = (*C.uint8_t)(&pix[0])
+	buf.stride = C.int(stride)
+	buf.size = (C.size_t)(len(pix))
+}
 
-	// Decode
-	if status := C.WebPDecode(cDataPtr, cDataSize, config); status != C.VP8_STATUS_OK {
-		return nil, fmt.Errorf("Could not decode data stream, return %s", statusString(status))
+// setYUVABuffer sets up the decoder configuration to decode into img, whose
+// planes begin with the top-left samples of output image. The origin of img
+// must be at even coordinates, so that Cb and Cr begin with whole samples.
+func setYUVABuffer(config *C.WebPDecoderConfig, img *YUVAImage) {
+	config.output.colorspace = C.MODE_YUV
+	if img.ColorSpace == YUV420A {
+		config.output.colorspace = C.MODE_YUVA
 	}
+	config.output.is_external_memory = 1
 
-	return
+	// Fill in the pointers to output image
+	buf := (*C.WebPYUVABuffer)(unsafe.Pointer(&config.output.u[0]))
+	buf.y = (*C.uint8_t)(&img.Y[0])
+	buf.u = (*C.uint8_t)(&img.Cb[0])
+	buf.v = (*C.uint8_t)(&img.Cr[0])
+	buf.a = nil
+	buf.y_stride = C.int(img.YStride)
+	buf.u_stride = C.int(img.CStride)
+	buf.v_stride = C.int(img.CStride)
+	buf.a_stride = 0
+	buf.y_size = C.size_t(len(img.Y))
+	buf.u_size = C.size_t(len(img.Cb))
+	buf.v_size = C.size_t(len(img.Cr))
+	buf.a_size = 0
+
+	if img.ColorSpace == YUV420A {
+		buf.a = (*C.uint8_t)(&img.A[0])
+		buf.a_stride = C.int(img.AStride)
+		buf.a_size = C.size_t(len(img.A))
+	}
+}
+
+// decode decodes data stream into the output buffer set up in the decoder
+// configuration. If ctx can be cancelled, data stream is decoded incrementally
+// in chunks, and ctx is checked between them.
+func decode(ctx context.Context, data []byte, config *C.WebPDecoderConfig) error {
+	if len(data) == 0 {
+		return newDecodeError(DecodeStageDecode, C.VP8_STATUS_NOT_ENOUGH_DATA)
+	}
+	if ctx.Done() != nil {
+		return decodeIncrementally(ctx, data, config)
+	}
+
+	if status := C.WebPDecode((*C.uint8_t)(&data[0]), (C.size_t)(len(data)), config); status != C.VP8_STATUS_OK {
+		return newDecodeError(DecodeStageDecode, status)
+	}
+	return nil
+}
+
+// decodeIncrementally decodes data stream in chunks of decodeChunkSize by the
+// incremental decoder, and returns ctx.Err() if ctx is done between chunks.
+func decodeIncrementally(ctx context.Context, data []byte, config *C.WebPDecoderConfig) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// The decoder refers to the config and the output buffer until it is
+	// deleted, so they are pinned.
+	var pinner runtime.Pinner
+	defer pinner.Unpin()
+	pinner.Pin(config)
+	pinOutputBuffer(&pinner, &config.output)
+
+	idec := C.WebPIDecode(nil, 0, config)
+	if idec == nil {
+		return errIncrementalDecoderInitialize
+	}
+	defer C.WebPIDelete(idec)
+
+	for len(data) > 0 {
+		n := min(len(data), decodeChunkSize)
+		switch status := C.WebPIAppend(idec, (*C.uint8_t)(&data[0]), C.size_t(n)); status {
+		case C.VP8_STATUS_OK:
+			return nil
+		case C.VP8_STATUS_SUSPENDED:
+		default:
+			return newDecodeError(DecodeStageDecode, status)
+		}
+		data = data[n:]
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return newDecodeError(DecodeStageDecode, C.VP8_STATUS_NOT_ENOUGH_DATA)
 }
 
-// sattusString convert the VP8StatsCode to string.
-func statusString(status C.VP8StatusCode) string {
-	switch status {
-	case C.VP8_STATUS_OK:
-		return "VP8_STATUS_OK"
-	case C.VP8_STATUS_OUT_OF_MEMORY:
-		return "VP8_STATUS_OUT_OF_MEMORY"
-	case C.VP8_STATUS_INVALID_PARAM:
-		return "VP8_STATUS_INVALID_PARAM"
-	case C.VP8_STATUS_BITSTREAM_ERROR:
-		return "VP8_STATUS_BITSTREAM_ERROR"
-	case C.VP8_STATUS_UNSUPPORTED_FEATURE:
-		return "VP8_STATUS_UNSUPPORTED_FEATURE"
-	case C.VP8_STATUS_SUSPENDED:
-		return "VP8_STATUS_SUSPENDED"
-	case C.VP8_STATUS_USER_ABORT:
-		return "VP8_STATUS_USER_ABORT"
-	case C.VP8_STATUS_NOT_ENOUGH_DATA:
-		return "VP8_STATUS_NOT_ENOUGH_DATA"
-	}
-	return "Unexpected Status Code"
+// pinOutputBuffer pins the external memory of the output buffer.
+func pinOutputBuffer(pinner *runtime.Pinner, output *C.WebPDecBuffer) {
+	if output.colorspace < C.MODE_YUV {
+		buf := (*C.WebPRGBABuffer)(unsafe.Pointer(&output.u[0]))
+		pinner.Pin(unsafe.Pointer(buf.rgba))
+		return
+	}
+
+	buf := (*C.WebPYUVABuffer)(unsafe.Pointer(&output.u[0]))
+	pinner.Pin(unsafe.Pointer(buf.y))
+	pinner.Pin(unsafe.Pointer(buf.u))
+	pinner.Pin(unsafe.Pointer(buf.v))
+	if buf.a != nil {
+		pinner.Pin(unsafe.Pointer(buf.a))
+	}
 }
 
 // initDecoderConfing initializes a decoder configration and sets up the options.
 func initDecoderConfig(options *DecoderOptions) (config *C.WebPDecoderConfig, err error) {
+	if err := options.validate(); err != nil {
+		return nil, err
+	}
+
 	// Initialize decoder config
 	config = &C.WebPDecoderConfig{}
 	if C.WebPInitDecoderConfig(config) == 0 {
@@ -238,41 +515,51 @@ func initDecoderConfig(options *DecoderOptions) (config *C.WebPDecoderConfig, er
 	if options.NoFancyUpsampling {
 		config.options.no_fancy_upsampling = 1
 	}
-	if options.Crop.Max.X > 0 && options.Crop.Max.Y > 0 {
+	if options.useCropping() {
 		config.options.use_cropping = 1
 		config.options.crop_left = C.int(options.Crop.Min.X)
 		config.options.crop_top = C.int(options.Crop.Min.Y)
 		config.options.crop_width = C.int(options.Crop.Dx())
 		config.options.crop_height = C.int(options.Crop.Dy())
 	}
-	if options.Scale.Max.X > 0 && options.Scale.Max.Y > 0 {
+	if options.useScaling() {
 		config.options.use_scaling = 1
-		config.options.scaled_width = C.int(options.Scale.Max.X)
-		config.options.scaled_height = C.int(options.Scale.Max.Y)
+		config.options.scaled_width = C.int(options.Scale.Dx())
+		config.options.scaled_height = C.int(options.Scale.Dy())
 	}
 	if options.UseThreads {
 		config.options.use_threads = 1
 	}
 	config.options.dithering_strength = C.int(options.DitheringStrength)
+	if options.Flip {
+		config.options.flip = 1
+	}
+	config.options.alpha_dithering_strength = C.int(options.AlphaDitheringStrength)
 
 	return
 }
 
-// calcOutputSize retrives width and height of output image from the decoder configuration.
-func calcOutputSize(config *C.WebPDecoderConfig) (width, height int) {
-	options := config.options
-	if options.use_scaling > 0 {
-		width = int(config.options.scaled_width)
-		height = int(config.options.scaled_height)
-		return
-	}
-	if config.options.use_cropping > 0 {
-		width = int(config.options.crop_width)
-		height = int(config.options.crop_height)
-		return
-	}
-
+// calcOutputSize retrives width and height of output image from the decoder
+// configuration whose input features are already retrieved, and stores the
+// scaled size into the configuration. It returns *OptionError if the cropping
+// area exceeds the image bounds.
+func calcOutputSize(config *C.WebPDecoderConfig) (width, height int, err error) {
+	options := &config.options
 	width = int(config.input.width)
 	height = int(config.input.height)
+
+	if options.use_cropping > 0 {
+		left, top := int(options.crop_left), int(options.crop_top)
+		crop := image.Rect(left, top, left+int(options.crop_width), top+int(options.crop_height))
+		if width, height, err = cropSize(width, height, crop); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	if options.use_scaling > 0 {
+		width, height = scaledSize(width, height, int(options.scaled_width), int(options.scaled_height))
+		options.scaled_width = C.int(width)
+		options.scaled_height = C.int(height)
+	}
 	return
 }
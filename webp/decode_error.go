@@ -0,0 +1,111 @@
+package webp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Status represents the status of decoding, which corresponds to
+// C.VP8StatusCode. The values are the same as libwebp, so that they are
+// available without cgo.
+type Status int
+
+const (
+	StatusOK                 Status = iota // VP8_STATUS_OK
+	StatusOutOfMemory                      // VP8_STATUS_OUT_OF_MEMORY
+	StatusInvalidParam                     // VP8_STATUS_INVALID_PARAM
+	StatusBitstreamError                   // VP8_STATUS_BITSTREAM_ERROR
+	StatusUnsupportedFeature               // VP8_STATUS_UNSUPPORTED_FEATURE
+	StatusSuspended                        // VP8_STATUS_SUSPENDED
+	StatusUserAbort                        // VP8_STATUS_USER_ABORT
+	StatusNotEnoughData                    // VP8_STATUS_NOT_ENOUGH_DATA
+)
+
+// Errors which DecodeError matches with errors.Is according to its status.
+var (
+	ErrOutOfMemory        = errors.New("out of memory")
+	ErrInvalidParam       = errors.New("invalid parameter")
+	ErrBitstream          = errors.New("bitstream error")
+	ErrUnsupportedFeature = errors.New("unsupported feature")
+	ErrSuspended          = errors.New("suspended")
+	ErrUserAbort          = errors.New("user abort")
+	ErrNotEnoughData      = errors.New("not enough data")
+)
+
+// err returns the error corresponding to the status, or nil if the status is
+// StatusOK or unknown.
+func (s Status) err() error {
+	switch s {
+	case StatusOutOfMemory:
+		return ErrOutOfMemory
+	case StatusInvalidParam:
+		return ErrInvalidParam
+	case StatusBitstreamError:
+		return ErrBitstream
+	case StatusUnsupportedFeature:
+		return ErrUnsupportedFeature
+	case StatusSuspended:
+		return ErrSuspended
+	case StatusUserAbort:
+		return ErrUserAbort
+	case StatusNotEnoughData:
+		return ErrNotEnoughData
+	}
+	return nil
+}
+
+func (s Status) String() string {
+	if s == StatusOK {
+		return "ok"
+	}
+	if err := s.err(); err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("unknown status %d", int(s))
+}
+
+// DecodeStage represents the stage of decoding where DecodeError occurs.
+type DecodeStage int
+
+const (
+	DecodeStageFeatures    DecodeStage = iota // Retrieving features from the data stream
+	DecodeStageDecode                         // Decoding the data stream
+	DecodeStageBufferCheck                    // Checking the output buffer
+)
+
+func (s DecodeStage) String() string {
+	switch s {
+	case DecodeStageFeatures:
+		return "features"
+	case DecodeStageDecode:
+		return "decode"
+	case DecodeStageBufferCheck:
+		return "buffer check"
+	}
+	return fmt.Sprintf("unknown stage %d", int(s))
+}
+
+// DecodeError is returned when decoding fails with the status other than
+// StatusOK. It matches the error of the status, such as ErrNotEnoughData, with
+// errors.Is.
+type DecodeError struct {
+	Stage  DecodeStage // Stage where decoding fails
+	Status Status      // Status returned by libwebp
+}
+
+func (e *DecodeError) Error() string {
+	switch e.Stage {
+	case DecodeStageFeatures:
+		return fmt.Sprintf("Could not get features from the data stream: %v", e.Status)
+	case DecodeStageBufferCheck:
+		return fmt.Sprintf("Invalid output buffer: %v", e.Status)
+	}
+	return fmt.Sprintf("Could not decode data stream: %v", e.Status)
+}
+
+// Unwrap returns the error corresponding to the status.
+func (e *DecodeError) Unwrap() error {
+	return e.Status.err()
+}
+
+var _ error = &DecodeError{}
@@ -0,0 +1,100 @@
+//go:build !cgo
+
+package webp
+
+import (
+	"image"
+	"io"
+)
+
+// Without cgo, the package decodes only still lossless (VP8L) images in pure
+// Go. The decoded pixels are the same as the ones of libwebp.
+
+func init() {
+	image.RegisterFormat("webp", "RIFF????WEBP", Decode, DecodeConfig)
+}
+
+// GetInfo retrives width/height from data bytes. It returns zero if data is
+// not a valid WebP header. Use GetInfoWithError to know the reason.
+//
+// Without cgo, data must contain the whole image.
+func GetInfo(data []byte) (width, height int) {
+	width, height, _ = GetInfoWithError(data)
+	return
+}
+
+// GetInfoWithError retrives width/height from data bytes. It returns
+// DecodeError if data is not a valid WebP header.
+//
+// Without cgo, data must contain the whole image.
+func GetInfoWithError(data []byte) (width, height int, err error) {
+	f, _, err := getLosslessFeatures(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	return f.Width, f.Height, nil
+}
+
+// GetFeatures returns features as BitstreamFeatures retrived from data stream.
+//
+// Without cgo, data must contain the whole image.
+func GetFeatures(data []byte) (f *BitstreamFeatures, err error) {
+	f, _, err = getLosslessFeatures(data)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// DecodeRGBA decodes WebP image into rgbA image and returns it as an *image.RGBA.
+//
+// Without cgo, only still lossless images can be decoded, and DecodeError of
+// StatusUnsupportedFeature is returned for the others.
+func DecodeRGBA(data []byte, options *DecoderOptions) (img *image.RGBA, err error) {
+	return decodeLosslessRGBA(data, options)
+}
+
+// DecodeNRGBA decodes WebP image into RGBA image and returns it as an *image.NRGBA.
+//
+// Without cgo, only still lossless images can be decoded, and DecodeError of
+// StatusUnsupportedFeature is returned for the others.
+func DecodeNRGBA(data []byte, options *DecoderOptions) (img *image.NRGBA, err error) {
+	return decodeLosslessNRGBA(data, options)
+}
+
+// Decode reads a WebP image from r and returns it as an image.Image.
+// The type of returned image is *image.NRGBA if the image has an alpha
+// channel, otherwise *image.RGBA.
+//
+// Without cgo, only still lossless images can be decoded.
+func Decode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := GetFeatures(data)
+	if err != nil {
+		return nil, err
+	}
+	if f.HasAlpha {
+		return DecodeNRGBA(data, &DecoderOptions{})
+	}
+	return DecodeRGBA(data, &DecoderOptions{})
+}
+
+// DecodeConfig returns the color model and dimensions of a WebP image.
+//
+// Without cgo, the whole image is read from r.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+
+	f, err := GetFeatures(data)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return imageConfig(f), nil
+}
@@ -0,0 +1,142 @@
+package webp
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/pixiv/go-libwebp/container"
+)
+
+// DecoderOptions specifies decoding options of WebP. Nil options are the same
+// as the zero value, which decodes the whole image without any options.
+type DecoderOptions struct {
+	BypassFiltering        bool            // If true, bypass filtering process
+	NoFancyUpsampling      bool            // If true, do not fancy upsampling
+	Crop                   image.Rectangle // Do cropping if image.Rectangle is not zero.
+	Scale                  image.Rectangle // Do scaling to the size of image.Rectangle if it is not zero. A zero width or height preserves the aspect ratio.
+	UseThreads             bool            // If true, use multi threads
+	DitheringStrength      int             // Specify dithering strength [0=Off .. 100=full]
+	Flip                   bool            // If true, flip output vertically
+	AlphaDitheringStrength int             // Specify alpha dithering strength in [0..100]
+	Allocator              Allocator       // Allocator of output images. If nil, they are allocated by make.
+	Limits                 Limits          // Limits of images to decode, checked before allocating output images
+}
+
+// OptionError is returned when DecoderOptions has an invalid value or an
+// invalid combination of values.
+type OptionError struct {
+	Option string // Name of the invalid option
+	Reason string // Why the option is invalid
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("Invalid decoder option %s: %s", e.Option, e.Reason)
+}
+
+var _ error = &OptionError{}
+
+// orZero returns the options, or the zero options if they are nil.
+func (options *DecoderOptions) orZero() *DecoderOptions {
+	if options == nil {
+		return &DecoderOptions{}
+	}
+	return options
+}
+
+// validate checks the options which do not depend on the image to decode.
+func (options *DecoderOptions) validate() error {
+	if options.useCropping() {
+		if options.Crop.Min.X < 0 || options.Crop.Min.Y < 0 {
+			return &OptionError{Option: "Crop", Reason: fmt.Sprintf("%v has negative offset", options.Crop)}
+		}
+		if options.Crop.Empty() {
+			return &OptionError{Option: "Crop", Reason: fmt.Sprintf("%v is empty", options.Crop)}
+		}
+	}
+	if options.useScaling() && options.Scale.Dx() == 0 && options.Scale.Dy() == 0 {
+		return &OptionError{Option: "Scale", Reason: fmt.Sprintf("%v is empty", options.Scale)}
+	}
+	if options.DitheringStrength < 0 || options.DitheringStrength > 100 {
+		return &OptionError{Option: "DitheringStrength", Reason: fmt.Sprintf("%d is out of range [0..100]", options.DitheringStrength)}
+	}
+	if options.AlphaDitheringStrength < 0 || options.AlphaDitheringStrength > 100 {
+		return &OptionError{Option: "AlphaDitheringStrength", Reason: fmt.Sprintf("%d is out of range [0..100]", options.AlphaDitheringStrength)}
+	}
+	return nil
+}
+
+func (options *DecoderOptions) useCropping() bool {
+	return options.Crop != image.Rectangle{}
+}
+
+func (options *DecoderOptions) useScaling() bool {
+	return options.Scale != image.Rectangle{}
+}
+
+// outputSize returns the size of output image decoded from the image of
+// width x height. Scaling is applied to the cropped area. It returns
+// *OptionError if the cropping area exceeds the image bounds.
+func (options *DecoderOptions) outputSize(width, height int) (int, int, error) {
+	if options.useCropping() {
+		var err error
+		if width, height, err = cropSize(width, height, options.Crop); err != nil {
+			return 0, 0, err
+		}
+	}
+	if options.useScaling() {
+		width, height = scaledSize(width, height, options.Scale.Dx(), options.Scale.Dy())
+	}
+	return width, height, nil
+}
+
+// cropSize returns the size of the cropping area in the image of width x
+// height, or *OptionError if it exceeds the image bounds.
+func cropSize(width, height int, crop image.Rectangle) (int, int, error) {
+	if crop.Max.X > width || crop.Max.Y > height {
+		return 0, 0, &OptionError{
+			Option: "Crop",
+			Reason: fmt.Sprintf("%v exceeds the image bounds %dx%d", crop, width, height),
+		}
+	}
+	return crop.Dx(), crop.Dy(), nil
+}
+
+// scaledSize returns the size of the image of width x height scaled to
+// scaledWidth x scaledHeight. The omitted (zero) dimension is calculated from
+// the aspect ratio of the image in the same way as
+// WebPRescalerGetScaledDimensions of libwebp.
+func scaledSize(width, height, scaledWidth, scaledHeight int) (int, int) {
+	if scaledWidth == 0 {
+		scaledWidth = (width*scaledHeight + height - 1) / height
+	}
+	if scaledHeight == 0 {
+		scaledHeight = (height*scaledWidth + width - 1) / width
+	}
+	return scaledWidth, scaledHeight
+}
+
+// BitstreamFeatures represents the image properties which are retrived from
+// data stream.
+type BitstreamFeatures struct {
+	Width        int  // Image width in pixels
+	Height       int  // Image height in pixles
+	HasAlpha     bool // True if data stream contains a alpha channel.
+	HasAnimation bool // True if data stream is an animation
+	Format       int  // Image compression format
+}
+
+// imageConfig returns the image.Config of the image which is returned by
+// Decode.
+func imageConfig(f *BitstreamFeatures) image.Config {
+	config := image.Config{
+		ColorModel: color.RGBAModel,
+		Width:      f.Width,
+		Height:     f.Height,
+	}
+	// The color model of YUVAImage is also color.NRGBAModel.
+	if f.HasAlpha || f.HasAnimation || f.Format == int(container.FormatLossy) {
+		config.ColorModel = color.NRGBAModel
+	}
+	return config
+}
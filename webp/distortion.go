@@ -0,0 +1,89 @@
+package webp
+
+/*
+#include <webp/encode.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"image"
+)
+
+var errDistortion = errors.New("Could not compute distortion")
+
+// Metric represents the metric of distortion between images, which
+// corresponds to metric_type of WebPPictureDistortion.
+type Metric int
+
+const (
+	// MetricPSNR specifies peak signal-to-noise ratio.
+	MetricPSNR Metric = 0
+	// MetricSSIM specifies structural similarity.
+	MetricSSIM Metric = 1
+	// MetricLSIM specifies local similarity, which is the similarity of each
+	// pixel to the most similar pixel in its 7x7 neighborhood.
+	MetricLSIM Metric = 2
+)
+
+// Distortion computes the distortion of candidate image against reference
+// image ref with the metric. The images must have the same size, but may have
+// different types and bounds, so that the result of DecodeNRGBA can be
+// compared with the original image. The results are in dB, in the order of
+// blue, green, red, alpha and all channels.
+func Distortion(ref, candidate image.Image, metric Metric) ([5]float32, error) {
+	if ref.Bounds().Size() != candidate.Bounds().Size() {
+		return [5]float32{}, fmt.Errorf("Size of images does not match: %v and %v", ref.Bounds().Size(), candidate.Bounds().Size())
+	}
+
+	refPic, err := NewPicture(ref)
+	if err != nil {
+		return [5]float32{}, err
+	}
+	defer refPic.Close()
+
+	candidatePic, err := NewPicture(candidate)
+	if err != nil {
+		return [5]float32{}, err
+	}
+	defer candidatePic.Close()
+
+	return PictureDistortion(refPic, candidatePic, metric)
+}
+
+// PictureDistortion computes the distortion of candidate picture against
+// reference picture ref with the metric. The results are the same as
+// Distortion.
+func PictureDistortion(ref, candidate *Picture, metric Metric) (result [5]float32, err error) {
+	var r [5]C.float
+	if C.WebPPictureDistortion(candidate.pic, ref.pic, C.int(metric), &r[0]) == 0 {
+		return result, errDistortion
+	}
+	for i := range result {
+		result[i] = float32(r[i])
+	}
+	return
+}
+
+// GrayDistortion computes the distortion of candidate gray image against
+// reference gray image ref with the metric, without conversion into ARGB. The
+// result is in dB.
+func GrayDistortion(ref, candidate *image.Gray, metric Metric) (float32, error) {
+	size := ref.Rect.Size()
+	if size != candidate.Rect.Size() {
+		return 0, fmt.Errorf("Size of images does not match: %v and %v", size, candidate.Rect.Size())
+	}
+	if size.X <= 0 || size.Y <= 0 {
+		return 0, errDistortion
+	}
+
+	var distortion, result C.float
+	src := &candidate.Pix[candidate.PixOffset(candidate.Rect.Min.X, candidate.Rect.Min.Y)]
+	refPix := &ref.Pix[ref.PixOffset(ref.Rect.Min.X, ref.Rect.Min.Y)]
+	if C.WebPPlaneDistortion((*C.uint8_t)(src), C.size_t(candidate.Stride), (*C.uint8_t)(refPix), C.size_t(ref.Stride),
+		C.int(size.X), C.int(size.Y), 1, C.int(metric), &distortion, &result) == 0 {
+		return 0, errDistortion
+	}
+	return float32(result), nil
+}
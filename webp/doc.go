@@ -0,0 +1,6 @@
+// Package webp provides an interface to libwebp library to decoding/encoding
+// WebP image.
+//
+// Without cgo, the package falls back to pure Go, which decodes and encodes
+// only still lossless (VP8L) images.
+package webp
@@ -2,12 +2,21 @@ package webp
 
 /*
 #include <stdlib.h>
+#include <stdint.h>
 #include <string.h>
 #include <webp/encode.h>
 
 int golibwebpWriteWebP(uint8_t*, size_t, struct WebPPicture*);
 int golibwebpProgressHook(int, struct WebPPicture*);
 
+static void setHandle(WebPPicture* picture, uintptr_t handle) {
+	picture->custom_ptr = (void*)handle;
+}
+
+static uintptr_t getHandle(const WebPPicture* picture) {
+	return (uintptr_t)picture->custom_ptr;
+}
+
 static WebPPicture *calloc_WebPPicture(void) {
 	return calloc(sizeof(WebPPicture), 1);
 }
@@ -61,324 +70,114 @@ static int webpEncodeGray(const WebPConfig *config, WebPPicture *picture, uint8_
 import "C"
 
 import (
+	"bytes"
+	"context"
 	"errors"
-	"fmt"
 	"image"
 	"io"
-	"sync"
+	"runtime/cgo"
+	"sync/atomic"
 	"unsafe"
-)
-
-// Config specifies WebP encoding configuration.
-type Config struct {
-	c C.WebPConfig
-}
-
-type ProgressHook func(int) bool
-
-type EncodeError struct {
-	encodeErrorCode EncodeErrorCode
-}
-
-func (e *EncodeError) Error() string {
-	return fmt.Sprintf("Encoding error: %d", e.encodeErrorCode)
-}
 
-func (e *EncodeError) EncodeErrorCode() EncodeErrorCode {
-	return e.encodeErrorCode
-}
-
-var _ error = &EncodeError{}
-
-type EncodeErrorCode int
-
-const (
-	EncodeErrorCodeVP8EncOK                        EncodeErrorCode = C.VP8_ENC_OK
-	EncodeErrorCodeVP8EncErrorOutOfMemory          EncodeErrorCode = C.VP8_ENC_ERROR_OUT_OF_MEMORY
-	EncodeErrorCodeVP8EncErrorBitstreamOutOfMemory EncodeErrorCode = C.VP8_ENC_ERROR_BITSTREAM_OUT_OF_MEMORY
-	EncodeErrorCodeVP8EncErrorNullParameter        EncodeErrorCode = C.VP8_ENC_ERROR_NULL_PARAMETER
-	EncodeErrorCodeVP8EncErrorInvalidConfiguration EncodeErrorCode = C.VP8_ENC_ERROR_INVALID_CONFIGURATION
-	EncodeErrorCodeVP8EncErrorBadDimension         EncodeErrorCode = C.VP8_ENC_ERROR_BAD_DIMENSION
-	EncodeErrorCodeVP8EncErrorPartition0Overflow   EncodeErrorCode = C.VP8_ENC_ERROR_PARTITION0_OVERFLOW
-	EncodeErrorCodeVP8EncErrorPartitionOverflow    EncodeErrorCode = C.VP8_ENC_ERROR_PARTITION_OVERFLOW
-	EncodeErrorCodeVP8EncErrorBadWrite             EncodeErrorCode = C.VP8_ENC_ERROR_BAD_WRITE
-	EncodeErrorCodeVP8EncErrorFileTooBig           EncodeErrorCode = C.VP8_ENC_ERROR_FILE_TOO_BIG
-	EncodeErrorCodeVP8EncErrorUserAbort            EncodeErrorCode = C.VP8_ENC_ERROR_USER_ABORT
-	EncodeErrorCodeVP8ErrorLast                    EncodeErrorCode = C.VP8_ENC_ERROR_LAST
+	"github.com/pixiv/go-libwebp/mux"
 )
 
 var errWebPPictureAllocate = errors.New("Could not allocate webp picture")
 var errWebPPictureInitialize = errors.New("Could not initialize webp picture")
 var errUnsupportedImageType = errors.New("unsupported image type")
-var errInvalidConfiguration = errors.New("invalid configuration")
-var errInitializeWebPConfig = errors.New("failed to initialize webp config")
 
 // ConfigPreset returns initialized configuration with given preset and quality
 // factor.
 func ConfigPreset(preset Preset, quality float32) (*Config, error) {
-	c := &Config{}
-	if C.WebPConfigPreset(&c.c, C.WebPPreset(preset), C.float(quality)) == 0 {
+	var c C.WebPConfig
+	if C.WebPConfigPreset(&c, C.WebPPreset(preset), C.float(quality)) == 0 {
 		return nil, errInitializeWebPConfig
 	}
-	return c, nil
+	return &Config{c: newConfig(&c)}, nil
 }
 
 // ConfigLosslessPreset returns initialized configuration for lossless encoding.
 // Given level specifies desired efficiency level between 0 (fastest, lowest
 // compression) and 9 (slower, best compression).
 func ConfigLosslessPreset(level int) (*Config, error) {
-	c := &Config{}
-	if C.WebPConfigPreset(&c.c, C.WebPPreset(PresetDefault), C.float(0)) == 0 {
+	var c C.WebPConfig
+	if C.WebPConfigPreset(&c, C.WebPPreset(PresetDefault), C.float(0)) == 0 {
 		return nil, errInitializeWebPConfig
 	}
-	if C.WebPConfigLosslessPreset(&c.c, C.int(level)) == 0 {
+	if C.WebPConfigLosslessPreset(&c, C.int(level)) == 0 {
 		return nil, errInitializeWebPConfig
 	}
-	return c, nil
-}
-
-// SetLossless sets lossless parameter that specifies whether to enable lossless
-// encoding.
-func (c *Config) SetLossless(v bool) {
-	c.c.lossless = boolToValue(v)
-}
-
-// Lossless returns lossless parameter flag whether to enable lossless encoding.
-func (c *Config) Lossless() bool {
-	return valueToBool(c.c.lossless)
-}
-
-// SetQuality sets encoding quality factor between 0 (smallest file) and 100
-// (biggest).
-func (c *Config) SetQuality(v float32) {
-	c.c.quality = C.float(v)
-}
-
-// Quality returns encoding quality factor.
-func (c *Config) Quality() float32 {
-	return float32(c.c.quality)
-}
-
-// SetMethod sets method parameter that specifies quality/speed trade-off
-// (0=fast, 6=slower-better).
-func (c *Config) SetMethod(v int) {
-	c.c.method = C.int(v)
-}
-
-// Method returns method parameter.
-func (c *Config) Method() int {
-	return int(c.c.method)
-}
-
-// SetImageHint sets hint for image type. It is used to only lossless encoding
-// for now.
-func (c *Config) SetImageHint(v ImageHint) {
-	c.c.image_hint = C.WebPImageHint(v)
-}
-
-// ImageHint returns hint parameter for image type.
-func (c *Config) ImageHint() ImageHint {
-	return ImageHint(c.c.image_hint)
-}
-
-// SetTargetPSNR sets target PSNR value that specifies the minimal distortion to
-// try to achieve. If it sets 0, disable target PSNR.
-func (c *Config) SetTargetPSNR(v float32) {
-	c.c.target_PSNR = C.float(v)
-}
-
-// TargetPSNR returns target PSNR value.
-func (c *Config) TargetPSNR() float32 {
-	return float32(c.c.target_PSNR)
-}
-
-// SetSegments sets segments parameter that specifies the maximum number of
-// segments to use, in [1..4].
-func (c *Config) SetSegments(v int) {
-	c.c.segments = C.int(v)
-}
-
-// Segments returns segments parameter.
-func (c *Config) Segments() int {
-	return int(c.c.segments)
-}
-
-// SetSNSStrength sets SNS strength parameter between 0 (off) and 100 (maximum).
-func (c *Config) SetSNSStrength(v int) {
-	c.c.sns_strength = C.int(v)
-}
-
-// SNSStrength returns SNS strength parameter.
-func (c *Config) SNSStrength() int {
-	return int(c.c.sns_strength)
-}
-
-// SetFilterStrength sets filter strength parameter between 0 (off) and 100
-// (strongest).
-func (c *Config) SetFilterStrength(v int) {
-	c.c.filter_strength = C.int(v)
-}
-
-// FilterStrength returns filter strength parameter.
-func (c *Config) FilterStrength() int {
-	return int(c.c.filter_strength)
-}
-
-// SetFilterSharpness sets filter sharpness parameter between 0 (off) and 7
-// (least sharp).
-func (c *Config) SetFilterSharpness(v int) {
-	c.c.filter_sharpness = C.int(v)
-}
-
-// FilterSharpness returns filter sharpness parameter.
-func (c *Config) FilterSharpness() int {
-	return int(c.c.filter_sharpness)
-}
-
-// SetFilterType sets filter type parameter.
-func (c *Config) SetFilterType(v FilterType) {
-	c.c.filter_type = C.int(v)
-}
-
-// FilterType returns filter type parameter.
-func (c *Config) FilterType() FilterType {
-	return FilterType(c.c.filter_type)
-}
-
-// SetAutoFilter sets auto filter flag that specifies whether to auto adjust
-// filter strength.
-func (c *Config) SetAutoFilter(v bool) {
-	c.c.autofilter = boolToValue(v)
-}
-
-// AutoFilter returns auto filter flag.
-func (c *Config) AutoFilter() bool {
-	return valueToBool(c.c.autofilter)
-}
-
-// SetAlphaCompression sets alpha compression parameter.
-func (c *Config) SetAlphaCompression(v int) {
-	c.c.alpha_compression = C.int(v)
-}
-
-// AlphaCompression returns alpha compression parameter.
-func (c *Config) AlphaCompression() int {
-	return int(c.c.alpha_compression)
-}
-
-// SetAlphaFiltering sets alpha filtering parameter.
-func (c *Config) SetAlphaFiltering(v int) {
-	c.c.alpha_filtering = C.int(v)
-}
-
-// AlphaFiltering returns alpha filtering parameter.
-func (c *Config) AlphaFiltering() int {
-	return int(c.c.alpha_filtering)
-}
-
-// SetAlphaQuality sets alpha quality parameter.
-func (c *Config) SetAlphaQuality(v int) {
-	c.c.alpha_quality = C.int(v)
-}
-
-// AlphaQuality returns alpha quality parameter.
-func (c *Config) AlphaQuality() int {
-	return int(c.c.alpha_quality)
-}
-
-// SetPass sets pass parameter that specifies number of entropy-analysis passes
-// between 1 and 10.
-func (c *Config) SetPass(v int) {
-	c.c.pass = C.int(v)
-}
-
-// Pass returns pass parameter.
-func (c *Config) Pass() int {
-	return int(c.c.pass)
-}
-
-// SetPreprocessing sets preprocessing filter.
-func (c *Config) SetPreprocessing(v Preprocessing) {
-	c.c.preprocessing = C.int(v)
-}
-
-// Preprocessing returns preprocessing filter.
-func (c *Config) Preprocessing() Preprocessing {
-	return Preprocessing(c.c.preprocessing)
-}
-
-// SetPartitions sets partitions parameter.
-func (c *Config) SetPartitions(v int) {
-	c.c.partitions = C.int(v)
-}
-
-// Partitions returns partitions parameter.
-func (c *Config) Partitions() int {
-	return int(c.c.partitions)
-}
-
-// SetPartitionLimit returns partition limit parameter.
-func (c *Config) SetPartitionLimit(v int) {
-	c.c.partition_limit = C.int(v)
-}
-
-// PartitionLimit returns partition limit parameter.
-func (c *Config) PartitionLimit() int {
-	return int(c.c.partition_limit)
-}
-
-// SetEmulateJPEGSize sets flag whether the compression parameters remaps to
-// match the expected output size from JPEG compression.
-func (c *Config) SetEmulateJPEGSize(v bool) {
-	c.c.emulate_jpeg_size = boolToValue(v)
-}
-
-// EmulateJPEGSize returns the flag whether to enable emulating JPEG size.
-func (c *Config) EmulateJPEGSize() bool {
-	return valueToBool(c.c.emulate_jpeg_size)
-}
-
-// SetThreadLevel sets thread level parameter. If non-zero value is specified,
-// try and use multi-threaded encoding.
-func (c *Config) SetThreadLevel(v int) {
-	c.c.thread_level = C.int(v)
-}
-
-// ThreadLevel returns thread level parameter.
-func (c *Config) ThreadLevel() int {
-	return int(c.c.thread_level)
-}
-
-// SetLowMemory sets flag whether to reduce memory usage.
-func (c *Config) SetLowMemory(v bool) {
-	c.c.low_memory = boolToValue(v)
-}
-
-// LowMemory returns low memory flag.
-func (c *Config) LowMemory() bool {
-	return valueToBool(c.c.low_memory)
-}
-
-// SetNearLossless sets near lossless encoding factor between 0 (max loss) and
-// 100 (disable near lossless encoding, default).
-func (c *Config) SetNearLossless(v int) {
-	c.c.near_lossless = C.int(v)
-}
-
-// NearLossless returns near lossless encoding factor.
-func (c *Config) NearLossless() int {
-	return int(c.c.near_lossless)
-}
-
-// SetExact sets the flag whether to preserve the exact RGB values under
-// transparent area.
-func (c *Config) SetExact(v bool) {
-	c.c.exact = boolToValue(v)
+	return &Config{c: newConfig(&c)}, nil
+}
+
+// newConfig converts C.WebPConfig into config.
+func newConfig(c *C.WebPConfig) config {
+	return config{
+		lossless:         valueToBool(c.lossless),
+		quality:          float32(c.quality),
+		method:           int(c.method),
+		imageHint:        ImageHint(c.image_hint),
+		targetPSNR:       float32(c.target_PSNR),
+		targetSize:       int(c.target_size),
+		segments:         int(c.segments),
+		snsStrength:      int(c.sns_strength),
+		filterStrength:   int(c.filter_strength),
+		filterSharpness:  int(c.filter_sharpness),
+		filterType:       FilterType(c.filter_type),
+		autoFilter:       valueToBool(c.autofilter),
+		alphaCompression: int(c.alpha_compression),
+		alphaFiltering:   int(c.alpha_filtering),
+		alphaQuality:     int(c.alpha_quality),
+		pass:             int(c.pass),
+		showCompressed:   valueToBool(c.show_compressed),
+		preprocessing:    Preprocessing(c.preprocessing),
+		partitions:       int(c.partitions),
+		partitionLimit:   int(c.partition_limit),
+		emulateJPEGSize:  valueToBool(c.emulate_jpeg_size),
+		threadLevel:      int(c.thread_level),
+		lowMemory:        valueToBool(c.low_memory),
+		nearLossless:     int(c.near_lossless),
+		exact:            valueToBool(c.exact),
+		useDeltaPalette:  valueToBool(c.use_delta_palette),
+		useSharpYUV:      valueToBool(c.use_sharp_yuv),
+		qMin:             int(c.qmin),
+		qMax:             int(c.qmax),
+	}
 }
 
-// Exact returns exact flag.
-func (c *Config) Exact() bool {
-	return valueToBool(c.c.exact)
+// toC converts the parameters into C.WebPConfig, which is passed to libwebp.
+func (p *config) toC() *C.WebPConfig {
+	return &C.WebPConfig{
+		lossless:          boolToValue(p.lossless),
+		quality:           C.float(p.quality),
+		method:            C.int(p.method),
+		image_hint:        C.WebPImageHint(p.imageHint),
+		target_PSNR:       C.float(p.targetPSNR),
+		target_size:       C.int(p.targetSize),
+		segments:          C.int(p.segments),
+		sns_strength:      C.int(p.snsStrength),
+		filter_strength:   C.int(p.filterStrength),
+		filter_sharpness:  C.int(p.filterSharpness),
+		filter_type:       C.int(p.filterType),
+		autofilter:        boolToValue(p.autoFilter),
+		alpha_compression: C.int(p.alphaCompression),
+		alpha_filtering:   C.int(p.alphaFiltering),
+		alpha_quality:     C.int(p.alphaQuality),
+		pass:              C.int(p.pass),
+		show_compressed:   boolToValue(p.showCompressed),
+		preprocessing:     C.int(p.preprocessing),
+		partitions:        C.int(p.partitions),
+		partition_limit:   C.int(p.partitionLimit),
+		emulate_jpeg_size: boolToValue(p.emulateJPEGSize),
+		thread_level:      C.int(p.threadLevel),
+		low_memory:        boolToValue(p.lowMemory),
+		near_lossless:     C.int(p.nearLossless),
+		exact:             boolToValue(p.exact),
+		use_delta_palette: boolToValue(p.useDeltaPalette),
+		use_sharp_yuv:     boolToValue(p.useSharpYUV),
+		qmin:              C.int(p.qMin),
+		qmax:              C.int(p.qMax),
+	}
 }
 
 func boolToValue(v bool) C.int {
@@ -395,48 +194,118 @@ func valueToBool(v C.int) bool {
 	return false
 }
 
+// attachStats allocates C.WebPAuxStats for the picture if the destination of
+// statistics is not nil. It returns the function to fill the destination after
+// encoding, and the function to release the allocated stats.
+func attachStats(pic *C.WebPPicture, dst *EncodeStats) (collect func(), release func()) {
+	if dst == nil {
+		return func() {}, func() {}
+	}
+
+	stats := (*C.WebPAuxStats)(C.calloc(1, C.sizeof_WebPAuxStats))
+	pic.stats = stats
+	collect = func() {
+		if stats != nil {
+			*dst = newEncodeStats(stats)
+		}
+	}
+	release = func() {
+		pic.stats = nil
+		C.free(unsafe.Pointer(stats))
+	}
+	return
+}
+
+func newEncodeStats(s *C.WebPAuxStats) (stats EncodeStats) {
+	stats.CodedSize = int(s.coded_size)
+	for i := range stats.PSNR {
+		stats.PSNR[i] = float32(s.PSNR[i])
+	}
+	for i := range stats.BlockCount {
+		stats.BlockCount[i] = int(s.block_count[i])
+	}
+	for i := range stats.HeaderBytes {
+		stats.HeaderBytes[i] = int(s.header_bytes[i])
+	}
+	for i := range stats.ResidualBytes {
+		for j := range stats.ResidualBytes[i] {
+			stats.ResidualBytes[i][j] = int(s.residual_bytes[i][j])
+		}
+	}
+	for i := 0; i < 4; i++ {
+		stats.SegmentSize[i] = int(s.segment_size[i])
+		stats.SegmentQuant[i] = int(s.segment_quant[i])
+		stats.SegmentLevel[i] = int(s.segment_level[i])
+	}
+	stats.AlphaDataSize = int(s.alpha_data_size)
+	stats.LayerDataSize = int(s.layer_data_size)
+	stats.LosslessFeatures = LosslessFeatures(s.lossless_features)
+	stats.HistogramBits = int(s.histogram_bits)
+	stats.TransformBits = int(s.transform_bits)
+	stats.CacheBits = int(s.cache_bits)
+	stats.PaletteSize = int(s.palette_size)
+	stats.LosslessSize = int(s.lossless_size)
+	stats.LosslessHeaderSize = int(s.lossless_hdr_size)
+	stats.LosslessDataSize = int(s.lossless_data_size)
+	return
+}
+
+// destinationManager holds the writer and the progress hook of an encoding.
+// It is associated with the WebPPicture through custom_ptr as cgo.Handle, so
+// that the callbacks from libwebp can find it.
 type destinationManager struct {
 	writer       io.Writer
 	progressHook ProgressHook
+	err          error // first error returned by the writer
+	handle       cgo.Handle
 }
 
-var destinationManagerMapMutex sync.RWMutex
-var destinationManagerMap = make(map[uintptr]*destinationManager)
+// destinationManagerCount is the number of destinationManagers which are not
+// released yet.
+var destinationManagerCount atomic.Int64
 
-// GetDestinationManagerMapLen returns the number of globally working sourceManagers for debug
+// GetDestinationManagerMapLen returns the number of globally working destinationManagers for debug
 func GetDestinationManagerMapLen() int {
-	destinationManagerMapMutex.RLock()
-	defer destinationManagerMapMutex.RUnlock()
-	return len(destinationManagerMap)
+	return int(destinationManagerCount.Load())
 }
 
+// makeDestinationManager associates a new destinationManager with the picture.
+// It must be called after the picture is initialized, and must be released by
+// releaseDestinationManager.
 func makeDestinationManager(w io.Writer, progressHook ProgressHook, pic *C.WebPPicture) (mgr *destinationManager) {
 	mgr = &destinationManager{writer: w, progressHook: progressHook}
-	destinationManagerMapMutex.Lock()
-	defer destinationManagerMapMutex.Unlock()
-	destinationManagerMap[uintptr(unsafe.Pointer(pic))] = mgr
+	mgr.handle = cgo.NewHandle(mgr)
+	C.setHandle(pic, C.uintptr_t(mgr.handle))
+	destinationManagerCount.Add(1)
 	return
 }
 
 func releaseDestinationManager(pic *C.WebPPicture) {
-	destinationManagerMapMutex.Lock()
-	defer destinationManagerMapMutex.Unlock()
-	delete(destinationManagerMap, uintptr(unsafe.Pointer(pic)))
+	cgo.Handle(C.getHandle(pic)).Delete()
+	C.setHandle(pic, 0)
+	destinationManagerCount.Add(-1)
 }
 
 func getDestinationManager(pic *C.WebPPicture) *destinationManager {
-	destinationManagerMapMutex.RLock()
-	defer destinationManagerMapMutex.RUnlock()
-	return destinationManagerMap[uintptr(unsafe.Pointer(pic))]
+	return cgo.Handle(C.getHandle(pic)).Value().(*destinationManager)
+}
+
+// encodeError returns EncodeError of the failed encoding of the picture. It
+// wraps the error of the writer if writing failed.
+func (mgr *destinationManager) encodeError(pic *C.WebPPicture) error {
+	return &EncodeError{encodeErrorCode: EncodeErrorCode(pic.error_code), err: mgr.err}
 }
 
 //export golibwebpWriteWebP
 func golibwebpWriteWebP(data *C.uint8_t, size C.size_t, pic *C.WebPPicture) C.int {
 	mgr := getDestinationManager(pic)
-	bytes := C.GoBytes(unsafe.Pointer(data), C.int(size))
-	_, err := mgr.writer.Write(bytes)
+	if size == 0 {
+		return 1
+	}
+	_, err := mgr.writer.Write(unsafe.Slice((*byte)(data), int(size)))
 	if err != nil {
-		return 0 // TODO: can't pass error message
+		mgr.err = err
+		return 0
 	}
 	return 1
 }
@@ -459,58 +328,109 @@ func golibwebpProgressHook(percent C.int, pic *C.WebPPicture) C.int {
 	return boolToValue(shouldContinue)
 }
 
+// metadataWriter returns the writer which the encoded WebP is written to, and
+// the function to flush it. If the configuration has metadata, the encoded WebP
+// is buffered and written into w with the metadata by flush.
+func metadataWriter(w io.Writer, c *Config) (io.Writer, func() error) {
+	if c.metadata == nil {
+		return w, func() error { return nil }
+	}
+
+	var buf bytes.Buffer
+	return &buf, func() error {
+		data, err := mux.SetMetadata(buf.Bytes(), c.metadata)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+}
+
 // EncodeRGBA encodes and writes image.Image into the writer as WebP.
-// Now supports image.RGBA or image.NRGBA.
+// It supports any image.Image, and has fast paths for the image types of the
+// standard library and RGBImage.
 func EncodeRGBA(w io.Writer, img image.Image, c *Config) (err error) {
 	return EncodeRGBAWithProgress(w, img, c, nil)
 }
 
 // EncodeRGBAWithProgress encodes and writes image.Image into the writer as WebP.
-// Now supports image.RGBA or image.NRGBA.
+// It supports any image.Image as well as EncodeRGBA.
 // This function accepts progress hook function and supports cancellation.
 func EncodeRGBAWithProgress(w io.Writer, img image.Image, c *Config, progressHook ProgressHook) (err error) {
+	return encodeRGBA(w, img, c, progressHook, nil)
+}
+
+// EncodeRGBAWithStats encodes and writes image.Image into the writer as WebP.
+// It supports any image.Image as well as EncodeRGBA, and returns the
+// statistics of the encoding.
+func EncodeRGBAWithStats(w io.Writer, img image.Image, c *Config) (*EncodeStats, error) {
+	var stats EncodeStats
+	if err := encodeRGBA(w, img, c, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// encodeRGBA encodes and writes image.Image into the writer, and fills stats
+// with the statistics if it is not nil.
+func encodeRGBA(w io.Writer, img image.Image, c *Config, progressHook ProgressHook, stats *EncodeStats) (err error) {
 	if err = ValidateConfig(c); err != nil {
 		return
 	}
 
-	pic := C.calloc_WebPPicture()
-	if pic == nil {
-		return errWebPPictureAllocate
+	p, err := NewPicture(img)
+	if err != nil {
+		return
 	}
-	defer C.free_WebPPicture(pic)
+	defer p.Close()
 
-	makeDestinationManager(w, progressHook, pic)
-	defer releaseDestinationManager(pic)
+	return encodePicture(w, p.pic, c, progressHook, stats)
+}
 
-	if C.WebPPictureInit(pic) == 0 {
-		return errWebPPictureInitialize
+// EncodeRGBAContext encodes and writes image.Image into the writer as WebP.
+// It supports any image.Image as well as EncodeRGBA. Encoding is aborted when
+// ctx is done, and the returned EncodeError wraps ctx.Err().
+func EncodeRGBAContext(ctx context.Context, w io.Writer, img image.Image, c *Config) error {
+	return encodeWithContext(ctx, func(progressHook ProgressHook) error {
+		return EncodeRGBAWithProgress(w, img, c, progressHook)
+	})
+}
+
+// importRGBA imports pixels of image.Image into the WebPPicture. YUVAImage,
+// image.YCbCr and image.NYCbCrA are imported as YUV, and the others are
+// imported as ARGB.
+func importRGBA(pic *C.WebPPicture, img image.Image) error {
+	b := img.Bounds()
+	if b.Empty() {
+		return &EncodeError{encodeErrorCode: EncodeErrorCodeVP8EncErrorBadDimension}
 	}
-	defer C.WebPPictureFree(pic)
 
 	pic.use_argb = 1
+	pic.width = C.int(b.Dx())
+	pic.height = C.int(b.Dy())
 
-	pic.width = C.int(img.Bounds().Dx())
-	pic.height = C.int(img.Bounds().Dy())
-
-	pic.progress_hook = C.WebPProgressHook(C.golibwebpProgressHook)
-	pic.writer = C.WebPWriterFunction(C.golibwebpWriteWebP)
-
+	var ok C.int
 	switch p := img.(type) {
 	case *RGBImage:
-		C.WebPPictureImportRGB(pic, (*C.uint8_t)(&p.Pix[0]), C.int(p.Stride))
+		ok = C.WebPPictureImportRGB(pic, (*C.uint8_t)(&p.Pix[p.PixOffset(b.Min.X, b.Min.Y)]), C.int(p.Stride))
 	case *image.RGBA:
-		C.WebPPictureImportRGBA(pic, (*C.uint8_t)(&p.Pix[0]), C.int(p.Stride))
+		return importPremultipliedRGBA(pic, p)
 	case *image.NRGBA:
-		C.WebPPictureImportRGBA(pic, (*C.uint8_t)(&p.Pix[0]), C.int(p.Stride))
+		ok = C.WebPPictureImportRGBA(pic, (*C.uint8_t)(&p.Pix[p.PixOffset(b.Min.X, b.Min.Y)]), C.int(p.Stride))
+	case *YUVAImage:
+		return importYUVA(pic, p)
+	case *image.YCbCr:
+		return importYCbCr(pic, p, nil, 0)
+	case *image.NYCbCrA:
+		return importYCbCr(pic, &p.YCbCr, p.A[p.AOffset(b.Min.X, b.Min.Y):], p.AStride)
 	default:
-		return errUnsupportedImageType
+		return importARGB(pic, img)
 	}
-
-	if C.WebPEncode(&c.c, pic) == 0 {
-		return &EncodeError{encodeErrorCode: EncodeErrorCode(pic.error_code)}
+	if ok == 0 {
+		return errWebPPictureAllocate
 	}
-
-	return
+	return nil
 }
 
 // EncodeGray encodes and writes Gray Image data into the writer as WebP.
@@ -521,6 +441,22 @@ func EncodeGray(w io.Writer, p *image.Gray, c *Config) (err error) {
 // EncodeGrayWithProgress encodes and writes Gray Image data into the writer as WebP.
 // This function accepts progress hook function and supports cancellation.
 func EncodeGrayWithProgress(w io.Writer, p *image.Gray, c *Config, progressHook ProgressHook) (err error) {
+	return encodeGray(w, p, c, progressHook, nil)
+}
+
+// EncodeGrayWithStats encodes and writes Gray Image data into the writer as
+// WebP, and returns the statistics of the encoding.
+func EncodeGrayWithStats(w io.Writer, p *image.Gray, c *Config) (*EncodeStats, error) {
+	var stats EncodeStats
+	if err := encodeGray(w, p, c, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// encodeGray encodes and writes Gray Image data into the writer, and fills
+// stats with the statistics if it is not nil.
+func encodeGray(w io.Writer, p *image.Gray, c *Config, progressHook ProgressHook, stats *EncodeStats) (err error) {
 	if err = ValidateConfig(c); err != nil {
 		return
 	}
@@ -531,24 +467,42 @@ func EncodeGrayWithProgress(w io.Writer, p *image.Gray, c *Config, progressHook
 	}
 	defer C.free_WebPPicture(pic)
 
-	makeDestinationManager(w, progressHook, pic)
-	defer releaseDestinationManager(pic)
-
 	if C.WebPPictureInit(pic) == 0 {
 		return errWebPPictureInitialize
 	}
 	defer C.WebPPictureFree(pic)
 
+	out, flush := metadataWriter(w, c)
+	mgr := makeDestinationManager(out, progressHook, pic)
+	defer releaseDestinationManager(pic)
+
+	collectStats, releaseStats := attachStats(pic, stats)
+	defer releaseStats()
+
+	if p.Rect.Empty() {
+		return &EncodeError{encodeErrorCode: EncodeErrorCodeVP8EncErrorBadDimension}
+	}
+
 	pic.use_argb = 0
 	pic.width = C.int(p.Rect.Dx())
 	pic.height = C.int(p.Rect.Dy())
 	pic.y_stride = C.int(p.Stride)
 
-	if C.webpEncodeGray(&c.c, pic, (*C.uint8_t)(&p.Pix[0])) == 0 {
-		return &EncodeError{encodeErrorCode: EncodeErrorCode(pic.error_code)}
+	if C.webpEncodeGray(c.c.toC(), pic, (*C.uint8_t)(&p.Pix[p.PixOffset(p.Rect.Min.X, p.Rect.Min.Y)])) == 0 {
+		return mgr.encodeError(pic)
 	}
 
-	return
+	collectStats()
+	return flush()
+}
+
+// EncodeGrayContext encodes and writes Gray Image data into the writer as
+// WebP. Encoding is aborted when ctx is done, and the returned EncodeError
+// wraps ctx.Err().
+func EncodeGrayContext(ctx context.Context, w io.Writer, p *image.Gray, c *Config) error {
+	return encodeWithContext(ctx, func(progressHook ProgressHook) error {
+		return EncodeGrayWithProgress(w, p, c, progressHook)
+	})
 }
 
 // EncodeYUVA encodes and writes YUVA Image data into the writer as WebP.
@@ -559,6 +513,22 @@ func EncodeYUVA(w io.Writer, img *YUVAImage, c *Config) (err error) {
 // EncodeYUVAWithProgress encodes and writes YUVA Image data into the writer as WebP.
 // This function accepts progress hook function and supports cancellation.
 func EncodeYUVAWithProgress(w io.Writer, img *YUVAImage, c *Config, progressHook ProgressHook) (err error) {
+	return encodeYUVA(w, img, c, progressHook, nil)
+}
+
+// EncodeYUVAWithStats encodes and writes YUVA Image data into the writer as
+// WebP, and returns the statistics of the encoding.
+func EncodeYUVAWithStats(w io.Writer, img *YUVAImage, c *Config) (*EncodeStats, error) {
+	var stats EncodeStats
+	if err := encodeYUVA(w, img, c, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// encodeYUVA encodes and writes YUVA Image data into the writer, and fills
+// stats with the statistics if it is not nil.
+func encodeYUVA(w io.Writer, img *YUVAImage, c *Config, progressHook ProgressHook, stats *EncodeStats) (err error) {
 	if err = ValidateConfig(c); err != nil {
 		return
 	}
@@ -569,14 +539,38 @@ func EncodeYUVAWithProgress(w io.Writer, img *YUVAImage, c *Config, progressHook
 	}
 	defer C.free_WebPPicture(pic)
 
-	makeDestinationManager(w, progressHook, pic)
-	defer releaseDestinationManager(pic)
-
 	if C.WebPPictureInit(pic) == 0 {
 		return errWebPPictureInitialize
 	}
 	defer C.WebPPictureFree(pic)
 
+	out, flush := metadataWriter(w, c)
+	mgr := makeDestinationManager(out, progressHook, pic)
+	defer releaseDestinationManager(pic)
+
+	collectStats, releaseStats := attachStats(pic, stats)
+	defer releaseStats()
+
+	if img.Rect.Empty() {
+		return &EncodeError{encodeErrorCode: EncodeErrorCodeVP8EncErrorBadDimension}
+	}
+
+	// The planes are copied into the picture if the top-left pixel is not
+	// aligned with the chroma samples, so that they can be resampled.
+	if img.Rect.Min.X%2 != 0 || img.Rect.Min.Y%2 != 0 {
+		if err = importYUVA(pic, img); err != nil {
+			return
+		}
+		pic.progress_hook = C.WebPProgressHook(C.golibwebpProgressHook)
+		pic.writer = C.WebPWriterFunction(C.golibwebpWriteWebP)
+
+		if C.WebPEncode(c.c.toC(), pic) == 0 {
+			return mgr.encodeError(pic)
+		}
+		collectStats()
+		return flush()
+	}
+
 	pic.use_argb = 0
 	pic.colorspace = C.WebPEncCSP(img.ColorSpace)
 	pic.width = C.int(img.Rect.Dx())
@@ -590,14 +584,24 @@ func EncodeYUVAWithProgress(w io.Writer, img *YUVAImage, c *Config, progressHook
 		a = (*C.uint8_t)(&img.A[0])
 	}
 
-	if C.webpEncodeYUVA(&c.c, pic, y, u, v, a) == 0 {
-		return &EncodeError{encodeErrorCode: EncodeErrorCode(pic.error_code)}
+	if C.webpEncodeYUVA(c.c.toC(), pic, y, u, v, a) == 0 {
+		return mgr.encodeError(pic)
 	}
-	return
+	collectStats()
+	return flush()
+}
+
+// EncodeYUVAContext encodes and writes YUVA Image data into the writer as
+// WebP. Encoding is aborted when ctx is done, and the returned EncodeError
+// wraps ctx.Err().
+func EncodeYUVAContext(ctx context.Context, w io.Writer, img *YUVAImage, c *Config) error {
+	return encodeWithContext(ctx, func(progressHook ProgressHook) error {
+		return EncodeYUVAWithProgress(w, img, c, progressHook)
+	})
 }
 
 func ValidateConfig(c *Config) error {
-	if C.WebPValidateConfig(&c.c) == 0 {
+	if C.WebPValidateConfig(c.c.toC()) == 0 {
 		return errInvalidConfiguration
 	}
 	return nil
@@ -0,0 +1,81 @@
+package webp
+
+import (
+	"errors"
+	"fmt"
+)
+
+type EncodeError struct {
+	encodeErrorCode EncodeErrorCode
+	err             error
+}
+
+func (e *EncodeError) Error() string {
+	if e.err != nil {
+		return fmt.Sprintf("Encoding error: %v: %v", e.encodeErrorCode, e.err)
+	}
+	return fmt.Sprintf("Encoding error: %v", e.encodeErrorCode)
+}
+
+// Unwrap returns the error returned by the writer, if the encoding failed to
+// write.
+func (e *EncodeError) Unwrap() error {
+	return e.err
+}
+
+func (e *EncodeError) EncodeErrorCode() EncodeErrorCode {
+	return e.encodeErrorCode
+}
+
+var _ error = &EncodeError{}
+
+// EncodeErrorCode represents the error code of encoding, which corresponds to
+// C.WebPEncodingError. The values are the same as libwebp, so that they are
+// available without cgo.
+type EncodeErrorCode int
+
+const (
+	EncodeErrorCodeVP8EncOK                        EncodeErrorCode = iota // VP8_ENC_OK
+	EncodeErrorCodeVP8EncErrorOutOfMemory                                 // VP8_ENC_ERROR_OUT_OF_MEMORY
+	EncodeErrorCodeVP8EncErrorBitstreamOutOfMemory                        // VP8_ENC_ERROR_BITSTREAM_OUT_OF_MEMORY
+	EncodeErrorCodeVP8EncErrorNullParameter                               // VP8_ENC_ERROR_NULL_PARAMETER
+	EncodeErrorCodeVP8EncErrorInvalidConfiguration                        // VP8_ENC_ERROR_INVALID_CONFIGURATION
+	EncodeErrorCodeVP8EncErrorBadDimension                                // VP8_ENC_ERROR_BAD_DIMENSION
+	EncodeErrorCodeVP8EncErrorPartition0Overflow                          // VP8_ENC_ERROR_PARTITION0_OVERFLOW
+	EncodeErrorCodeVP8EncErrorPartitionOverflow                           // VP8_ENC_ERROR_PARTITION_OVERFLOW
+	EncodeErrorCodeVP8EncErrorBadWrite                                    // VP8_ENC_ERROR_BAD_WRITE
+	EncodeErrorCodeVP8EncErrorFileTooBig                                  // VP8_ENC_ERROR_FILE_TOO_BIG
+	EncodeErrorCodeVP8EncErrorUserAbort                                   // VP8_ENC_ERROR_USER_ABORT
+	EncodeErrorCodeVP8ErrorLast                                           // VP8_ENC_ERROR_LAST
+)
+
+func (c EncodeErrorCode) String() string {
+	switch c {
+	case EncodeErrorCodeVP8EncOK:
+		return "ok"
+	case EncodeErrorCodeVP8EncErrorOutOfMemory:
+		return "out of memory"
+	case EncodeErrorCodeVP8EncErrorBitstreamOutOfMemory:
+		return "out of memory while flushing bits"
+	case EncodeErrorCodeVP8EncErrorNullParameter:
+		return "null parameter"
+	case EncodeErrorCodeVP8EncErrorInvalidConfiguration:
+		return "invalid configuration"
+	case EncodeErrorCodeVP8EncErrorBadDimension:
+		return "bad picture dimension"
+	case EncodeErrorCodeVP8EncErrorPartition0Overflow:
+		return "partition #0 is too big"
+	case EncodeErrorCodeVP8EncErrorPartitionOverflow:
+		return "partition is too big"
+	case EncodeErrorCodeVP8EncErrorBadWrite:
+		return "write error"
+	case EncodeErrorCodeVP8EncErrorFileTooBig:
+		return "file is too big"
+	case EncodeErrorCodeVP8EncErrorUserAbort:
+		return "aborted by user"
+	}
+	return fmt.Sprintf("unknown error code %d", int(c))
+}
+
+var errInvalidConfiguration = errors.New("invalid configuration")
+var errInitializeWebPConfig = errors.New("failed to initialize webp config")
@@ -0,0 +1,101 @@
+//go:build !cgo
+
+package webp
+
+import (
+	"context"
+	"image"
+	"io"
+)
+
+// Without cgo, the package encodes only lossless images in pure Go. The
+// encoded images are decoded into the same pixels as the ones encoded by
+// libwebp, while they are usually larger.
+
+// EncodeRGBA encodes and writes image.Image into the writer as WebP.
+// It supports any image.Image.
+//
+// Without cgo, the configuration must be lossless, and YUV images are
+// converted into RGB by their color models.
+func EncodeRGBA(w io.Writer, img image.Image, c *Config) (err error) {
+	return EncodeRGBAWithProgress(w, img, c, nil)
+}
+
+// EncodeRGBAWithProgress encodes and writes image.Image into the writer as WebP.
+// It supports any image.Image as well as EncodeRGBA.
+// This function accepts progress hook function and supports cancellation.
+func EncodeRGBAWithProgress(w io.Writer, img image.Image, c *Config, progressHook ProgressHook) (err error) {
+	return encodeRGBA(w, img, c, progressHook, nil)
+}
+
+// EncodeRGBAWithStats encodes and writes image.Image into the writer as WebP.
+// It supports any image.Image as well as EncodeRGBA, and returns the
+// statistics of the encoding.
+func EncodeRGBAWithStats(w io.Writer, img image.Image, c *Config) (*EncodeStats, error) {
+	var stats EncodeStats
+	if err := encodeRGBA(w, img, c, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// encodeRGBA encodes and writes image.Image into the writer, and fills stats
+// with the statistics if it is not nil.
+func encodeRGBA(w io.Writer, img image.Image, c *Config, progressHook ProgressHook, stats *EncodeStats) error {
+	data, err := appendEncodeLossless(nil, img, c, progressHook, stats)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return &EncodeError{encodeErrorCode: EncodeErrorCodeVP8EncErrorBadWrite, err: err}
+	}
+	return nil
+}
+
+// EncodeRGBAContext encodes and writes image.Image into the writer as WebP.
+// It supports any image.Image as well as EncodeRGBA. Encoding is aborted when
+// ctx is done, and the returned EncodeError wraps ctx.Err().
+func EncodeRGBAContext(ctx context.Context, w io.Writer, img image.Image, c *Config) error {
+	return encodeWithContext(ctx, func(progressHook ProgressHook) error {
+		return EncodeRGBAWithProgress(w, img, c, progressHook)
+	})
+}
+
+// EncodeGray encodes and writes Gray Image data into the writer as WebP.
+//
+// Without cgo, the configuration must be lossless.
+func EncodeGray(w io.Writer, p *image.Gray, c *Config) (err error) {
+	return EncodeRGBAWithProgress(w, p, c, nil)
+}
+
+// EncodeGrayWithProgress encodes and writes Gray Image data into the writer as WebP.
+// This function accepts progress hook function and supports cancellation.
+func EncodeGrayWithProgress(w io.Writer, p *image.Gray, c *Config, progressHook ProgressHook) (err error) {
+	return EncodeRGBAWithProgress(w, p, c, progressHook)
+}
+
+// EncodeGrayWithStats encodes and writes Gray Image data into the writer as
+// WebP, and returns the statistics of the encoding.
+func EncodeGrayWithStats(w io.Writer, p *image.Gray, c *Config) (*EncodeStats, error) {
+	return EncodeRGBAWithStats(w, p, c)
+}
+
+// EncodeGrayContext encodes and writes Gray Image data into the writer as
+// WebP. Encoding is aborted when ctx is done, and the returned EncodeError
+// wraps ctx.Err().
+func EncodeGrayContext(ctx context.Context, w io.Writer, p *image.Gray, c *Config) error {
+	return EncodeRGBAContext(ctx, w, p, c)
+}
+
+// EncodeToBytes encodes image.Image into WebP and returns it as a byte slice.
+// It supports any image.Image as well as EncodeRGBA.
+func EncodeToBytes(img image.Image, c *Config) ([]byte, error) {
+	return AppendEncode(nil, img, c)
+}
+
+// AppendEncode encodes image.Image into WebP, and appends it to dst. It
+// returns the extended slice, so that the capacity of dst can be reused
+// across encodings. dst is returned as it is if an error occurs.
+func AppendEncode(dst []byte, img image.Image, c *Config) ([]byte, error) {
+	return appendEncodeLossless(dst, img, c, nil, nil)
+}
@@ -0,0 +1,80 @@
+package webp
+
+import (
+	"context"
+	"errors"
+)
+
+// ImageHint corresponds to C.WebPImageHint. The values are the same as libwebp,
+// so that they are available without cgo.
+type ImageHint int
+
+const (
+	HintDefault ImageHint = iota // WEBP_HINT_DEFAULT
+	HintPicture                  // WEBP_HINT_PICTURE
+	HintPhoto                    // WEBP_HINT_PHOTO
+	HintGraph                    // WEBP_HINT_GRAPH
+	HintLast                     // WEBP_HINT_LAST
+)
+
+// Preset corresponds to C.WebPPreset.
+type Preset int
+
+const (
+	// PresetDefault corresponds to WEBP_PRESET_DEFAULT, for default preset.
+	PresetDefault Preset = iota
+	// PresetPicture corresponds to WEBP_PRESET_PICTURE, for digital picture, like portrait, inner shot
+	PresetPicture
+	// PresetPhoto corresponds to WEBP_PRESET_PHOTO, for outdoor photograph, with natural lighting
+	PresetPhoto
+	// PresetDrawing corresponds to WEBP_PRESET_DRAWING, for hand or line drawing, with high-contrast details
+	PresetDrawing
+	// PresetIcon corresponds to WEBP_PRESET_ICON, for small-sized colorful images
+	PresetIcon
+	// PresetText corresponds to WEBP_PRESET_TEXT, for text-like
+	PresetText
+)
+
+// FilterType corresponds to filter types in compression parameters.
+type FilterType int
+
+const (
+	// SimpleFilter (=0, default)
+	SimpleFilter FilterType = iota
+	// StrongFilter (=1)
+	StrongFilter
+)
+
+// Preprocessing corresponds to preprocessing filter parameter.
+type Preprocessing int
+
+const (
+	// PreprocessingNone specifies to disable preprocessing filter.
+	PreprocessingNone = 0
+	// PreprocessingSegmentSmooth specifies segment-smooth filter.
+	PreprocessingSegmentSmooth = 1
+	//PreprocessingPseudoRandomDithering specifies pseudo-random dithering filter.
+	PreprocessingPseudoRandomDithering = 2
+)
+
+// ProgressHook is called with the progress of encoding in percent. Encoding
+// is aborted if it returns false.
+type ProgressHook func(int) bool
+
+// encodeWithContext calls encode with the progress hook which aborts encoding
+// when ctx is done. The returned EncodeError of aborted encoding wraps the
+// error of ctx.
+func encodeWithContext(ctx context.Context, encode func(progressHook ProgressHook) error) error {
+	if err := ctx.Err(); err != nil {
+		return &EncodeError{encodeErrorCode: EncodeErrorCodeVP8EncErrorUserAbort, err: err}
+	}
+
+	err := encode(func(int) bool {
+		return ctx.Err() == nil
+	})
+	var encodeErr *EncodeError
+	if errors.As(err, &encodeErr) && encodeErr.encodeErrorCode == EncodeErrorCodeVP8EncErrorUserAbort && ctx.Err() != nil {
+		return &EncodeError{encodeErrorCode: EncodeErrorCodeVP8EncErrorUserAbort, err: ctx.Err()}
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package webp
+
+/*
+#include <webp/decode.h>
+*/
+import "C"
+
+import (
+	"bytes"
+	"image"
+	"io"
+
+	"github.com/pixiv/go-libwebp/container"
+)
+
+// headerSize is the initial size of data read to retrieve features in
+// DecodeConfig. It is enough for simple formats, and it grows when the data
+// stream has metadata chunks before the image data.
+const headerSize = 64
+
+func init() {
+	image.RegisterFormat("webp", "RIFF????WEBP", Decode, DecodeConfig)
+}
+
+// Decode reads a WebP image from r and returns it as an image.Image.
+// The type of returned image is *image.NRGBA if the image has an alpha
+// channel or is animated, *YUVAImage if the image is lossy, otherwise
+// *image.RGBA. If the image is animated, the first frame is returned.
+//
+// Like the other lossy decoders registered with the image package, opaque
+// lossy images are returned in YUV without conversion. They are not returned
+// as *image.YCbCr, since its RGB-YCbCr conversion differs from the one of
+// WebP. See YUVAImage for details.
+func Decode(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := GetFeatures(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.HasAnimation {
+		return decodeFirstFrame(data)
+	}
+	if f.HasAlpha {
+		return DecodeNRGBA(data, &DecoderOptions{})
+	}
+	if f.Format == int(container.FormatLossy) {
+		return DecodeYUVA(data, &DecoderOptions{})
+	}
+	return DecodeRGBA(data, &DecoderOptions{})
+}
+
+// DecodeConfig returns the color model and dimensions of a WebP image without
+// decoding the entire image.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	var buf bytes.Buffer
+	for size := int64(headerSize); ; size *= 2 {
+		n, err := io.CopyN(&buf, r, size-int64(buf.Len()))
+		if err != nil && err != io.EOF {
+			return image.Config{}, err
+		}
+
+		f, status := getFeatures(buf.Bytes())
+		if status == C.VP8_STATUS_NOT_ENOUGH_DATA && err == nil && n > 0 {
+			continue
+		}
+		if status != C.VP8_STATUS_OK {
+			return image.Config{}, newDecodeError(DecodeStageFeatures, status)
+		}
+
+		return imageConfig(f), nil
+	}
+}
+
+// decodeFirstFrame decodes the first frame of animated WebP.
+func decodeFirstFrame(data []byte) (image.Image, error) {
+	dec, err := NewAnimationDecoder(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+
+	frame, err := dec.NextFrame()
+	if err != nil {
+		return nil, err
+	}
+	return frame.Image, nil
+}
@@ -0,0 +1,60 @@
+//go:build cgo
+
+package webp_test
+
+import (
+	"context"
+	"image"
+	"testing"
+
+	"github.com/pixiv/go-libwebp/webp"
+)
+
+// FuzzDecodeTo exercises the decoders which are available only with cgo.
+func FuzzDecodeTo(f *testing.F) {
+	addFuzzSeeds(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		options := &webp.DecoderOptions{Limits: fuzzLimits}
+		features, _ := webp.GetFeatures(data)
+
+		if img, err := webp.DecodeYUVA(data, options); err == nil {
+			checkBounds(t, "DecodeYUVA", img.Rect)
+		}
+		for _, mode := range []webp.ColorMode{webp.ModeRGB, webp.ModeRGBA4444, webp.ModeRGB565, webp.ModePremultipliedARGB, webp.ModeYUV} {
+			if img, err := webp.DecodeTo(data, mode, options); err == nil {
+				checkBounds(t, "DecodeTo", img.Bounds())
+			}
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		if img, err := webp.DecodeToContext(ctx, data, webp.ModeRGBA, options); err == nil {
+			checkBounds(t, "DecodeToContext", img.Bounds())
+		}
+		cancel()
+
+		if features != nil && features.Width*features.Height <= fuzzLimits.MaxPixels {
+			dst := image.NewNRGBA(image.Rect(0, 0, features.Width, features.Height))
+			webp.DecodeInto(data, dst, options)
+		}
+
+		if dec, err := webp.NewIncrementalDecoder(options); err == nil {
+			for i := 0; i < len(data); i += 1024 {
+				if err := dec.Append(data[i:min(i+1024, len(data))]); err != nil {
+					break
+				}
+				dec.DecodedNRGBA()
+			}
+			dec.Close()
+		}
+
+		if dec, err := webp.NewAnimationDecoder(data, &webp.AnimationDecoderOptions{Limits: fuzzLimits}); err == nil {
+			for dec.HasMoreFrames() {
+				if _, err := dec.NextFrame(); err != nil {
+					break
+				}
+			}
+			dec.Close()
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package webp_test
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/pixiv/go-libwebp/test/util"
+	"github.com/pixiv/go-libwebp/webp"
+)
+
+// fuzzLimits keeps the fuzzer from allocating huge images.
+var fuzzLimits = webp.Limits{MaxWidth: 4096, MaxHeight: 4096, MaxPixels: 1 << 20, MaxFrames: 16, MaxInputBytes: 1 << 20}
+
+// checkBounds fails if the decoded image exceeds the limits.
+func checkBounds(t *testing.T, name string, r image.Rectangle) {
+	if r.Dx() > fuzzLimits.MaxWidth || r.Dy() > fuzzLimits.MaxHeight || r.Dx()*r.Dy() > fuzzLimits.MaxPixels {
+		t.Errorf("%v: Decoded image %v exceeds the limits", name, r)
+	}
+}
+
+// addFuzzSeeds adds the example images and some edge cases to the seed corpus.
+// The lossless images are encoded by the package, so that the pure Go decoder
+// gets valid bitstreams without cgo.
+func addFuzzSeeds(f *testing.F) {
+	for _, file := range []string{"butterfly.webp", "fizyplankton.webp", "yellow-rose-3.webp"} {
+		f.Add(util.ReadFile(file))
+	}
+	for _, level := range []int{0, 6} {
+		config, err := webp.ConfigLosslessPreset(level)
+		if err != nil {
+			f.Fatalf("Got Error: %v", err)
+		}
+		data, err := webp.EncodeToBytes(util.ReadPNG("checkerboard.png"), config)
+		if err != nil {
+			f.Fatalf("Got Error: %v", err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte{})
+	f.Add([]byte("RIFF\x00\x00\x00\x00WEBP"))
+	f.Add([]byte("RIFF\x1a\x00\x00\x00WEBPVP8L\x0d\x00\x00\x00\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00"))
+}
+
+// FuzzDecode exercises the decoders which are available with and without cgo.
+func FuzzDecode(f *testing.F) {
+	addFuzzSeeds(f)
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		options := &webp.DecoderOptions{Limits: fuzzLimits}
+
+		webp.GetInfoWithError(data)
+		features, _ := webp.GetFeatures(data)
+
+		if img, err := webp.DecodeRGBA(data, options); err == nil {
+			checkBounds(t, "DecodeRGBA", img.Rect)
+		}
+		if img, err := webp.DecodeNRGBA(data, options); err == nil {
+			checkBounds(t, "DecodeNRGBA", img.Rect)
+		}
+		if features != nil && features.Width > 1 && features.Height > 1 {
+			scaled := &webp.DecoderOptions{
+				Crop:   image.Rect(1, 1, features.Width, features.Height),
+				Scale:  image.Rect(0, 0, 7, 0),
+				Flip:   true,
+				Limits: fuzzLimits,
+			}
+			if img, err := webp.DecodeNRGBA(data, scaled); err == nil {
+				checkBounds(t, "DecodeNRGBA with scaling", img.Rect)
+			}
+		}
+
+		image.DecodeConfig(bytes.NewReader(data))
+	})
+}
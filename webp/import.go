@@ -0,0 +1,206 @@
+package webp
+
+/*
+#include <stdint.h>
+#include <webp/encode.h>
+
+static uint32_t unpremultiplySample(uint32_t v, uint32_t a) {
+	// Samples exceeding alpha are invalid, and clamped.
+	v = (v * 255 + a / 2) / a;
+	return v > 255 ? 255 : v;
+}
+
+// importPremultipliedRGBA allocates ARGB buffer of the picture, and fills it
+// with the samples of RGBA with premultiplied alpha converted into straight
+// alpha.
+static int importPremultipliedRGBA(WebPPicture* picture, const uint8_t* rgba, int stride) {
+	int x, y;
+	if (!WebPPictureAlloc(picture)) {
+		return 0;
+	}
+	for (y = 0; y < picture->height; ++y) {
+		const uint8_t* src = rgba + y * stride;
+		uint32_t* dst = picture->argb + y * picture->argb_stride;
+		for (x = 0; x < picture->width; ++x) {
+			const uint32_t a = src[4 * x + 3];
+			uint32_t r = src[4 * x + 0], g = src[4 * x + 1], b = src[4 * x + 2];
+			if (a == 0) {
+				r = g = b = 0;
+			} else if (a < 255) {
+				r = unpremultiplySample(r, a);
+				g = unpremultiplySample(g, a);
+				b = unpremultiplySample(b, a);
+			}
+			dst[x] = a << 24 | r << 16 | g << 8 | b;
+		}
+	}
+	return 1;
+}
+*/
+import "C"
+
+import (
+	"image"
+	"math"
+	"unsafe"
+)
+
+// importARGB allocates ARGB buffer of the WebPPicture, and fills it with the
+// pixels of image.Image. It has fast paths for image types of the standard
+// library, and converts the other types through color.NRGBAModel.
+func importARGB(pic *C.WebPPicture, img image.Image) error {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	pic.use_argb = 1
+	pic.width = C.int(width)
+	pic.height = C.int(height)
+	if C.WebPPictureAlloc(pic) == 0 {
+		return errWebPPictureAllocate
+	}
+
+	fill := argbRowFiller(img)
+	stride := int(pic.argb_stride)
+	argb := unsafe.Slice((*uint32)(unsafe.Pointer(pic.argb)), stride*(height-1)+width)
+	for y := 0; y < height; y++ {
+		fill(argb[y*stride:y*stride+width], b.Min.X, b.Min.Y+y)
+	}
+	return nil
+}
+
+// importPremultipliedRGBA allocates ARGB buffer of the WebPPicture, and fills
+// it with the pixels of image.RGBA. image.RGBA has premultiplied alpha, while
+// libwebp expects straight alpha, so the colors are unpremultiplied.
+func importPremultipliedRGBA(pic *C.WebPPicture, img *image.RGBA) error {
+	b := img.Rect
+	pic.use_argb = 1
+	pic.width = C.int(b.Dx())
+	pic.height = C.int(b.Dy())
+	if C.importPremultipliedRGBA(pic, (*C.uint8_t)(&img.Pix[img.PixOffset(b.Min.X, b.Min.Y)]), C.int(img.Stride)) == 0 {
+		return errWebPPictureAllocate
+	}
+	return nil
+}
+
+// Lookup tables to convert the full range YCbCr of JFIF into the limited range
+// YUV of ITU-R BT.601 used in WebP. Both of them share the same coefficients
+// of RGB-YCbCr conversion, but differ in the range of values.
+var (
+	jfifToBT601Luma   [256]uint8
+	jfifToBT601Chroma [256]uint8
+)
+
+func init() {
+	for i := range jfifToBT601Luma {
+		jfifToBT601Luma[i] = uint8(16 + math.Round(float64(219*i)/255))
+		jfifToBT601Chroma[i] = uint8(128 + math.Round(float64(224*(i-128))/255))
+	}
+}
+
+// importYCbCr allocates YUV buffers of the WebPPicture, and fills them with the
+// pixels of image.YCbCr. The chroma samples of any subsample ratio are
+// resampled into 4:2:0 by averaging the samples which cover each 2x2 block.
+// If alpha is not nil, it is imported as alpha channel, whose first element
+// corresponds to the top-left pixel.
+func importYCbCr(pic *C.WebPPicture, img *image.YCbCr, alpha []uint8, alphaStride int) error {
+	b := img.Rect
+	width, height := b.Dx(), b.Dy()
+	pic.use_argb = 0
+	pic.colorspace = C.WEBP_YUV420
+	if alpha != nil {
+		pic.colorspace = C.WEBP_YUV420A
+	}
+	pic.width = C.int(width)
+	pic.height = C.int(height)
+	if C.WebPPictureAlloc(pic) == 0 {
+		return errWebPPictureAllocate
+	}
+
+	py, pu, pv, yStride, uvStride := pictureYUV(pic)
+	for y := 0; y < height; y++ {
+		src := img.Y[img.YOffset(b.Min.X, b.Min.Y+y):]
+		dst := py[y*yStride : y*yStride+width]
+		for x := range dst {
+			dst[x] = jfifToBT601Luma[src[x]]
+		}
+	}
+
+	resampleChroma(pu, pv, uvStride, b, img.Cb, img.Cr, img.COffset, &jfifToBT601Chroma)
+
+	if alpha != nil {
+		aStride := int(pic.a_stride)
+		pa := unsafe.Slice((*uint8)(unsafe.Pointer(pic.a)), aStride*(height-1)+width)
+		for y := 0; y < height; y++ {
+			copy(pa[y*aStride:y*aStride+width], alpha[y*alphaStride:])
+		}
+	}
+	return nil
+}
+
+// importYUVA allocates YUV buffers of the WebPPicture, and copies the pixels of
+// YUVAImage. The chroma samples are resampled if the top-left pixel is not
+// aligned with them.
+func importYUVA(pic *C.WebPPicture, img *YUVAImage) error {
+	b := img.Rect
+	width, height := b.Dx(), b.Dy()
+	pic.use_argb = 0
+	pic.colorspace = C.WebPEncCSP(img.ColorSpace)
+	pic.width = C.int(width)
+	pic.height = C.int(height)
+	if C.WebPPictureAlloc(pic) == 0 {
+		return errWebPPictureAllocate
+	}
+
+	py, pu, pv, yStride, uvStride := pictureYUV(pic)
+	for y := 0; y < height; y++ {
+		copy(py[y*yStride:y*yStride+width], img.Y[y*img.YStride:])
+	}
+	resampleChroma(pu, pv, uvStride, b, img.Cb, img.Cr, img.COffset, nil)
+
+	if img.ColorSpace == YUV420A {
+		aStride := int(pic.a_stride)
+		pa := unsafe.Slice((*uint8)(unsafe.Pointer(pic.a)), aStride*(height-1)+width)
+		for y := 0; y < height; y++ {
+			copy(pa[y*aStride:y*aStride+width], img.A[y*img.AStride:])
+		}
+	}
+	return nil
+}
+
+// pictureYUV returns the YUV planes allocated in the WebPPicture as slices,
+// with their strides.
+func pictureYUV(pic *C.WebPPicture) (y, u, v []uint8, yStride, uvStride int) {
+	width, height := int(pic.width), int(pic.height)
+	cw, ch := (width+1)/2, (height+1)/2
+	yStride, uvStride = int(pic.y_stride), int(pic.uv_stride)
+	y = unsafe.Slice((*uint8)(unsafe.Pointer(pic.y)), yStride*(height-1)+width)
+	u = unsafe.Slice((*uint8)(unsafe.Pointer(pic.u)), uvStride*(ch-1)+cw)
+	v = unsafe.Slice((*uint8)(unsafe.Pointer(pic.v)), uvStride*(ch-1)+cw)
+	return
+}
+
+// resampleChroma fills the 4:2:0 chroma planes dstU and dstV of the image
+// whose bounds are r. Each sample is the average of the source samples
+// covering the 2x2 block of pixels, where offset returns the index of source
+// samples for the pixel. The samples are converted with lut if it is not nil.
+func resampleChroma(dstU, dstV []uint8, dstStride int, r image.Rectangle, srcU, srcV []uint8, offset func(x, y int) int, lut *[256]uint8) {
+	cw, ch := (r.Dx()+1)/2, (r.Dy()+1)/2
+	for cy := 0; cy < ch; cy++ {
+		for cx := 0; cx < cw; cx++ {
+			var u, v, n int
+			for y := r.Min.Y + 2*cy; y < r.Min.Y+2*cy+2 && y < r.Max.Y; y++ {
+				for x := r.Min.X + 2*cx; x < r.Min.X+2*cx+2 && x < r.Max.X; x++ {
+					i := offset(x, y)
+					u += int(srcU[i])
+					v += int(srcV[i])
+					n++
+				}
+			}
+			u, v = (u+n/2)/n, (v+n/2)/n
+			if lut != nil {
+				u, v = int(lut[u]), int(lut[v])
+			}
+			dstU[cy*dstStride+cx] = uint8(u)
+			dstV[cy*dstStride+cx] = uint8(v)
+		}
+	}
+}
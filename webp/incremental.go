@@ -0,0 +1,266 @@
+package webp
+
+/*
+#include <stdlib.h>
+#include <webp/decode.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"image"
+	"io"
+	"unsafe"
+)
+
+// incrementalChunkSize is the size of chunks read by IncrementalDecoder.ReadFrom.
+const incrementalChunkSize = 32 * 1024
+
+// decodeChunkSize is the size of chunks decoded between the checks of
+// cancellation by the decoders with context.
+const decodeChunkSize = 16 * 1024
+
+var errIncrementalDecoderInitialize = errors.New("Could not initialize incremental decoder")
+
+// IncrementalDecoder decodes WebP image progressively from data which arrives
+// in chunks. The rows decoded so far can be retrieved before the whole data is
+// available. It must be released by Close after use.
+//
+// The decoder copies appended data internally, so the caller can reuse the
+// buffer passed to Append.
+type IncrementalDecoder struct {
+	idec   *C.WebPIDecoder
+	config *C.WebPDecoderConfig
+	done   bool
+
+	limits  Limits
+	size    int    // Total size of appended data
+	header  []byte // Data buffered until the features are retrieved
+	checked bool   // Whether the features are checked against the limits
+
+	nrgba *image.NRGBA
+	yuva  *YUVAImage
+	rows  int
+	flip  bool // Whether the rows are decoded bottom-up
+}
+
+// NewIncrementalDecoder creates an IncrementalDecoder which decodes WebP image
+// into RGBA image.
+func NewIncrementalDecoder(options *DecoderOptions) (*IncrementalDecoder, error) {
+	return newIncrementalDecoder(options, C.MODE_RGBA)
+}
+
+// NewIncrementalYUVADecoder creates an IncrementalDecoder which decodes WebP
+// image into YUV image with alpha channel.
+func NewIncrementalYUVADecoder(options *DecoderOptions) (*IncrementalDecoder, error) {
+	return newIncrementalDecoder(options, C.MODE_YUVA)
+}
+
+func newIncrementalDecoder(options *DecoderOptions, mode C.WEBP_CSP_MODE) (*IncrementalDecoder, error) {
+	options = options.orZero()
+	config, err := initDecoderConfig(options)
+	if err != nil {
+		return nil, err
+	}
+
+	// The decoder refers to the config until it is deleted, so it must be in C memory.
+	d := &IncrementalDecoder{
+		config: (*C.WebPDecoderConfig)(C.calloc(1, C.sizeof_WebPDecoderConfig)),
+		limits: options.Limits,
+		flip:   options.Flip,
+	}
+	if d.config == nil {
+		return nil, errIncrementalDecoderInitialize
+	}
+	*d.config = *config
+	d.config.output.colorspace = mode
+
+	d.idec = C.WebPIDecode(nil, 0, d.config)
+	if d.idec == nil {
+		d.Close()
+		return nil, errIncrementalDecoderInitialize
+	}
+	return d, nil
+}
+
+// Append appends data and decodes as many rows as possible. It returns nil if
+// more data is needed to complete decoding, so that it can be called again with
+// the following data. Use Done to check whether the image is completely
+// decoded.
+//
+// The data is buffered until the header of the image is available, and the
+// image is checked against the limits in the options before decoding.
+func (d *IncrementalDecoder) Append(data []byte) error {
+	if d.done || len(data) == 0 {
+		return nil
+	}
+
+	d.size += len(data)
+	if err := d.limits.checkInputBytes(d.size); err != nil {
+		return err
+	}
+	if !d.checked {
+		d.header = append(d.header, data...)
+		if err := d.checkHeader(); err != nil || !d.checked {
+			return err
+		}
+		data, d.header = d.header, nil
+	}
+
+	switch status := C.WebPIAppend(d.idec, (*C.uint8_t)(&data[0]), C.size_t(len(data))); status {
+	case C.VP8_STATUS_OK:
+		d.done = true
+	case C.VP8_STATUS_SUSPENDED:
+	default:
+		return newDecodeError(DecodeStageDecode, status)
+	}
+	return nil
+}
+
+// checkHeader retrieves the features from the buffered header, and checks the
+// image against the limits. It leaves the header unchecked if more data is
+// needed.
+func (d *IncrementalDecoder) checkHeader() error {
+	config := *d.config
+	switch status := C.WebPGetFeatures((*C.uint8_t)(&d.header[0]), C.size_t(len(d.header)), &config.input); status {
+	case C.VP8_STATUS_OK:
+	case C.VP8_STATUS_NOT_ENOUGH_DATA:
+		return nil
+	default:
+		return newDecodeError(DecodeStageFeatures, status)
+	}
+
+	if err := d.limits.checkSize(int(config.input.width), int(config.input.height)); err != nil {
+		return err
+	}
+	width, height, err := calcOutputSize(&config)
+	if err != nil {
+		return err
+	}
+	if err := d.limits.checkSize(width, height); err != nil {
+		return err
+	}
+	d.checked = true
+	return nil
+}
+
+// ReadFrom reads data from r and decodes it until the image is completely
+// decoded or r reaches EOF. It returns io.ErrUnexpectedEOF if r reaches EOF
+// before the image is completely decoded.
+func (d *IncrementalDecoder) ReadFrom(r io.Reader) (n int64, err error) {
+	buf := make([]byte, incrementalChunkSize)
+	for !d.done {
+		m, readErr := r.Read(buf)
+		n += int64(m)
+		if err = d.Append(buf[:m]); err != nil {
+			return
+		}
+		if readErr == io.EOF {
+			if !d.done {
+				err = io.ErrUnexpectedEOF
+			}
+			return
+		}
+		if readErr != nil {
+			return n, readErr
+		}
+	}
+	return
+}
+
+// Done returns true if the image is completely decoded.
+func (d *IncrementalDecoder) Done() bool {
+	return d.done
+}
+
+// DecodedNRGBA returns the image decoded so far and the number of decoded
+// rows. The rows below the decoded rows are left blank, or the rows above them
+// if Flip is specified in the options. It returns nil if the header of the
+// image has not been decoded yet, or the decoder does not decode into RGBA
+// image.
+//
+// The returned image is shared and updated by following calls.
+func (d *IncrementalDecoder) DecodedNRGBA() (img *image.NRGBA, rows int) {
+	var lastY, width, height, stride C.int
+	rgba := C.WebPIDecGetRGB(d.idec, &lastY, &width, &height, &stride)
+	if rgba == nil {
+		return nil, 0
+	}
+
+	if d.nrgba == nil {
+		d.nrgba = image.NewNRGBA(image.Rect(0, 0, int(width), int(height)))
+	}
+
+	d.copyRows(d.nrgba.Pix, d.nrgba.Stride, rgba, stride, int(height), d.rows, int(lastY))
+	d.rows = int(lastY)
+
+	return d.nrgba, d.rows
+}
+
+// DecodedYUVA returns the image decoded so far and the number of decoded rows.
+// The rows below the decoded rows are left blank, or the rows above them if
+// Flip is specified in the options. It returns nil if the header of the image
+// has not been decoded yet, or the decoder does not decode into YUV image.
+//
+// The returned image is shared and updated by following calls.
+func (d *IncrementalDecoder) DecodedYUVA() (img *YUVAImage, rows int) {
+	var lastY, width, height, stride, uvStride, aStride C.int
+	var u, v, a *C.uint8_t
+	y := C.WebPIDecGetYUVA(d.idec, &lastY, &u, &v, &a, &width, &height, &stride, &uvStride, &aStride)
+	if y == nil {
+		return nil, 0
+	}
+
+	if d.yuva == nil {
+		colorSpace := YUV420
+		if a != nil {
+			colorSpace = YUV420A
+		}
+		d.yuva = NewYUVAImage(image.Rect(0, 0, int(width), int(height)), colorSpace)
+	}
+
+	cHeight, cFrom, cTo := (int(height)+1)/2, (d.rows+1)/2, (int(lastY)+1)/2
+	d.copyRows(d.yuva.Y, d.yuva.YStride, y, stride, int(height), d.rows, int(lastY))
+	d.copyRows(d.yuva.Cb, d.yuva.CStride, u, uvStride, cHeight, cFrom, cTo)
+	d.copyRows(d.yuva.Cr, d.yuva.CStride, v, uvStride, cHeight, cFrom, cTo)
+	if d.yuva.ColorSpace == YUV420A {
+		d.copyRows(d.yuva.A, d.yuva.AStride, a, aStride, int(height), d.rows, int(lastY))
+	}
+	d.rows = int(lastY)
+
+	return d.yuva, d.rows
+}
+
+// copyRows copies the rows of the plane from `from` to `to` in decoding order
+// from the output buffer of libwebp into dst. If Flip is specified, the rows
+// are decoded from the bottom of the buffer. libwebp reports a negative stride
+// with src pointing to the last row while decoding, but a positive one with
+// src pointing to the first row once it is done.
+func (d *IncrementalDecoder) copyRows(dst []uint8, dstStride int, src *C.uint8_t, stride C.int, height, from, to int) {
+	srcStride := int(stride)
+	if srcStride < 0 {
+		srcStride = -srcStride
+		src = (*C.uint8_t)(unsafe.Add(unsafe.Pointer(src), (height-1)*int(stride)))
+	}
+	s := unsafe.Slice((*byte)(src), srcStride*height)
+	for i := from; i < to; i++ {
+		y := i
+		if d.flip {
+			y = height - 1 - i
+		}
+		copy(dst[y*dstStride:(y+1)*dstStride], s[y*srcStride:])
+	}
+}
+
+// Close releases the resources of the decoder.
+func (d *IncrementalDecoder) Close() {
+	if d.idec != nil {
+		C.WebPIDelete(d.idec)
+		d.idec = nil
+	}
+	if d.config != nil {
+		C.WebPFreeDecBuffer(&d.config.output)
+		C.free(unsafe.Pointer(d.config))
+		d.config = nil
+	}
+}
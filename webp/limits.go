@@ -0,0 +1,59 @@
+package webp
+
+import (
+	"fmt"
+)
+
+// Limits specifies the limits of images to decode. They are checked with the
+// header of the data stream before any buffer of the image is allocated, so
+// that decoding untrusted data does not exhaust memory. Zero means no limit.
+type Limits struct {
+	MaxWidth      int // Maximum width of the image, or of the canvas of animation
+	MaxHeight     int // Maximum height of the image, or of the canvas of animation
+	MaxPixels     int // Maximum number of pixels, which is width multiplied by height
+	MaxFrames     int // Maximum number of frames of animation
+	MaxInputBytes int // Maximum size of the data stream in bytes
+}
+
+// LimitError is returned when the image to decode exceeds Limits.
+type LimitError struct {
+	Limit string // Name of the exceeded limit
+	Value int    // Value of the image
+	Max   int    // Value of the limit
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("Image exceeds limit %s: %d > %d", e.Limit, e.Value, e.Max)
+}
+
+var _ error = &LimitError{}
+
+// checkInputBytes checks the size of the data stream.
+func (l Limits) checkInputBytes(n int) error {
+	if l.MaxInputBytes > 0 && n > l.MaxInputBytes {
+		return &LimitError{Limit: "MaxInputBytes", Value: n, Max: l.MaxInputBytes}
+	}
+	return nil
+}
+
+// checkSize checks the size of the image.
+func (l Limits) checkSize(width, height int) error {
+	if l.MaxWidth > 0 && width > l.MaxWidth {
+		return &LimitError{Limit: "MaxWidth", Value: width, Max: l.MaxWidth}
+	}
+	if l.MaxHeight > 0 && height > l.MaxHeight {
+		return &LimitError{Limit: "MaxHeight", Value: height, Max: l.MaxHeight}
+	}
+	if l.MaxPixels > 0 && width*height > l.MaxPixels {
+		return &LimitError{Limit: "MaxPixels", Value: width * height, Max: l.MaxPixels}
+	}
+	return nil
+}
+
+// checkFrames checks the number of frames of animation.
+func (l Limits) checkFrames(n int) error {
+	if l.MaxFrames > 0 && n > l.MaxFrames {
+		return &LimitError{Limit: "MaxFrames", Value: n, Max: l.MaxFrames}
+	}
+	return nil
+}
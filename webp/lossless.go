@@ -0,0 +1,144 @@
+//go:build !cgo
+
+package webp
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/pixiv/go-libwebp/container"
+	"github.com/pixiv/go-libwebp/internal/vp8l"
+)
+
+// This file adapts the pure-Go decoder of internal/vp8l to the API, which is
+// used when cgo is not available. It produces the same pixels as libwebp.
+
+// getLosslessFeatures retrieves features from data stream, and returns them
+// with the VP8L bitstream of the image. The bitstream is nil if the image is
+// not a still lossless image. Unlike libwebp, data must contain the whole
+// image.
+func getLosslessFeatures(data []byte) (*BitstreamFeatures, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, &DecodeError{Stage: DecodeStageFeatures, Status: StatusNotEnoughData}
+	}
+
+	// Raw VP8L bitstream without the container, which libwebp also accepts
+	if data[0] == 0x2f {
+		h, err := vp8l.DecodeHeader(data)
+		if err != nil {
+			return nil, nil, newLosslessError(DecodeStageFeatures, err)
+		}
+		f := &BitstreamFeatures{Width: h.Width, Height: h.Height, HasAlpha: h.HasAlpha, Format: int(container.FormatLossless)}
+		return f, data, nil
+	}
+
+	c, err := container.Parse(data)
+	if err != nil {
+		status := StatusBitstreamError
+		if errors.Is(err, container.ErrTruncated) {
+			status = StatusNotEnoughData
+		}
+		return nil, nil, &DecodeError{Stage: DecodeStageFeatures, Status: status}
+	}
+	f := &BitstreamFeatures{
+		Width:        c.Width,
+		Height:       c.Height,
+		HasAlpha:     c.HasAlpha,
+		HasAnimation: c.HasAnimation,
+		Format:       int(c.Format),
+	}
+	if c.HasAnimation || c.Format != container.FormatLossless {
+		return f, nil, nil
+	}
+	return f, c.Chunk(container.FourCCVP8L).Data, nil
+}
+
+// newLosslessError returns DecodeError at the stage for the error of VP8L
+// decoder.
+func newLosslessError(stage DecodeStage, err error) error {
+	if errors.Is(err, vp8l.ErrTruncated) {
+		return &DecodeError{Stage: stage, Status: StatusNotEnoughData}
+	}
+	return &DecodeError{Stage: stage, Status: StatusBitstreamError}
+}
+
+// decodeLosslessNRGBA decodes lossless WebP image into RGBA image in pure Go.
+func decodeLosslessNRGBA(data []byte, options *DecoderOptions) (*image.NRGBA, error) {
+	pix, rect, err := decodeLossless(data, options, false)
+	if err != nil {
+		return nil, err
+	}
+	return &image.NRGBA{Pix: pix, Stride: 4 * rect.Dx(), Rect: rect}, nil
+}
+
+// decodeLosslessRGBA decodes lossless WebP image into rgbA image in pure Go.
+func decodeLosslessRGBA(data []byte, options *DecoderOptions) (*image.RGBA, error) {
+	pix, rect, err := decodeLossless(data, options, true)
+	if err != nil {
+		return nil, err
+	}
+	return &image.RGBA{Pix: pix, Stride: 4 * rect.Dx(), Rect: rect}, nil
+}
+
+// decodeLossless decodes lossless WebP image into RGBA pixels, whose alpha is
+// premultiplied if premultiplied is true. Crop, Scale, Flip, Allocator and
+// Limits in the options are applied in the same way as libwebp, and the other
+// options, which do not affect lossless images, are ignored. It returns
+// DecodeError of StatusUnsupportedFeature if the image is lossy or animated.
+func decodeLossless(data []byte, options *DecoderOptions, premultiplied bool) ([]uint8, image.Rectangle, error) {
+	options = options.orZero()
+	if err := options.validate(); err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	if err := options.Limits.checkInputBytes(len(data)); err != nil {
+		return nil, image.Rectangle{}, err
+	}
+
+	f, bitstream, err := getLosslessFeatures(data)
+	if err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	if bitstream == nil {
+		return nil, image.Rectangle{}, fmt.Errorf("Lossy or animated image requires cgo to decode: %w",
+			&DecodeError{Stage: DecodeStageDecode, Status: StatusUnsupportedFeature})
+	}
+	if err := options.Limits.checkSize(f.Width, f.Height); err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	out, err := options.losslessOutput(f.Width, f.Height, premultiplied)
+	if err != nil {
+		return nil, image.Rectangle{}, err
+	}
+	if err := vp8l.DecodeTo(bitstream, out); err != nil {
+		return nil, image.Rectangle{}, newLosslessError(DecodeStageDecode, err)
+	}
+	return out.Pix, image.Rect(0, 0, out.Width, out.Height), nil
+}
+
+// losslessOutput returns the output of the pure-Go decoder for the lossless
+// image of width x height, whose pixels are allocated by Allocator after
+// checking the output size against Limits.
+func (options *DecoderOptions) losslessOutput(width, height int, premultiplied bool) (*vp8l.Output, error) {
+	outWidth, outHeight, err := options.outputSize(width, height)
+	if err != nil {
+		return nil, err
+	}
+	if err := options.Limits.checkSize(outWidth, outHeight); err != nil {
+		return nil, err
+	}
+
+	crop := image.Rect(0, 0, width, height)
+	if options.useCropping() {
+		crop = options.Crop
+	}
+	return &vp8l.Output{
+		Pix:           options.alloc(4 * outWidth * outHeight),
+		Width:         outWidth,
+		Height:        outHeight,
+		Crop:          crop,
+		Scale:         options.useScaling(),
+		Flip:          options.Flip,
+		Premultiplied: premultiplied,
+	}, nil
+}
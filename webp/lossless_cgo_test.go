@@ -0,0 +1,240 @@
+//go:build cgo
+
+package webp
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/pixiv/go-libwebp/container"
+	"github.com/pixiv/go-libwebp/internal/vp8l"
+	"github.com/pixiv/go-libwebp/test/util"
+)
+
+// The pure-Go codec of internal/vp8l is used without cgo, so it is compared
+// with libwebp here through the helpers shared with the adapters.
+
+// losslessTestImages returns small images to encode losslessly, which have
+// various colors and alpha channels, so that all the transforms are used.
+func losslessTestImages() map[string]image.Image {
+	images := map[string]image.Image{}
+	for _, tt := range []struct {
+		file string
+		rect image.Rectangle
+	}{
+		{"fizyplankton.png", image.Rect(100, 120, 228, 216)},
+		{"yellow-rose-3.png", image.Rect(0, 0, 121, 87)},
+		{"kinkaku.png", image.Rect(400, 300, 553, 397)},
+		{"checkerboard.png", image.Rect(0, 0, 24, 24)},
+	} {
+		// The area is tiled, so that small images can be cropped.
+		src := util.ReadPNG(tt.file)
+		img := image.NewNRGBA(image.Rect(0, 0, max(tt.rect.Dx(), 64), max(tt.rect.Dy(), 40)))
+		for y := 0; y < img.Rect.Dy(); y += tt.rect.Dy() {
+			for x := 0; x < img.Rect.Dx(); x += tt.rect.Dx() {
+				draw.Draw(img, tt.rect.Sub(tt.rect.Min).Add(image.Pt(x, y)), src, tt.rect.Min, draw.Src)
+			}
+		}
+		images[tt.file] = img
+	}
+
+	// Images of a few colors use color indexing with packed indices.
+	palette := []color.NRGBA{{0xff, 0, 0, 0xff}, {0, 0x80, 0xff, 0x40}, {0, 0, 0, 0}, {0x12, 0x34, 0x56, 0xff}, {0xff, 0xff, 0xff, 0xc0}}
+	for _, n := range []int{2, 3, 5, 17} {
+		img := image.NewNRGBA(image.Rect(0, 0, 75, 33))
+		for y := 0; y < 33; y++ {
+			for x := 0; x < 75; x++ {
+				c := palette[(x/7+y/5)%min(n, len(palette))]
+				if n > len(palette) {
+					c.G = uint8((x + y) % n * 15)
+				}
+				img.SetNRGBA(x, y, c)
+			}
+		}
+		images[fmt.Sprintf("%d colors", n)] = img
+	}
+	return images
+}
+
+// decodeVP8L decodes VP8L bitstream of the image of width x height with the
+// options in the same way as losslessOutput and decodeLossless, which are not
+// built with cgo.
+func decodeVP8L(bitstream []byte, width, height int, options *DecoderOptions, premultiplied bool) (*vp8l.Output, error) {
+	outWidth, outHeight, err := options.outputSize(width, height)
+	if err != nil {
+		return nil, err
+	}
+	crop := image.Rect(0, 0, width, height)
+	if options.useCropping() {
+		crop = options.Crop
+	}
+	out := &vp8l.Output{
+		Pix:           make([]uint8, 4*outWidth*outHeight),
+		Width:         outWidth,
+		Height:        outHeight,
+		Crop:          crop,
+		Scale:         options.useScaling(),
+		Flip:          options.Flip,
+		Premultiplied: premultiplied,
+	}
+	return out, vp8l.DecodeTo(bitstream, out)
+}
+
+func TestDecodeLosslessMatchesLibwebp(t *testing.T) {
+	options := []*DecoderOptions{
+		{},
+		{Crop: image.Rect(3, 5, 60, 31)},
+		{Flip: true},
+		{Scale: image.Rect(0, 0, 37, 0)},
+		{Scale: image.Rect(0, 0, 150, 113)},
+		{Scale: image.Rect(0, 0, 50, 90)},
+		{Scale: image.Rect(0, 0, 1, 1)},
+		{Crop: image.Rect(10, 2, 11, 30), Scale: image.Rect(0, 0, 2, 28)},
+		{Crop: image.Rect(10, 2, 11, 3), Scale: image.Rect(0, 0, 5, 4)},
+		{Crop: image.Rect(7, 3, 50, 29), Scale: image.Rect(0, 0, 31, 40), Flip: true},
+	}
+
+	for name, img := range losslessTestImages() {
+		for _, level := range []int{0, 3, 6, 9} {
+			config, err := ConfigLosslessPreset(level)
+			if err != nil {
+				t.Fatalf("Got Error: %v", err)
+			}
+			config.SetExact(true)
+			var buf bytes.Buffer
+			if err := EncodeRGBA(&buf, img, config); err != nil {
+				t.Fatalf("Got Error: %v", err)
+			}
+			data := buf.Bytes()
+
+			expectFeatures, err := GetFeatures(data)
+			if err != nil {
+				t.Fatalf("Got Error: %v", err)
+			}
+			c, err := container.Parse(data)
+			if err != nil {
+				t.Errorf("%v at level %d: Got Error: %v", name, level, err)
+				continue
+			}
+			features := BitstreamFeatures{Width: c.Width, Height: c.Height, HasAlpha: c.HasAlpha, HasAnimation: c.HasAnimation, Format: int(c.Format)}
+			if features != *expectFeatures {
+				t.Errorf("%v at level %d: Expected features %+v, but got %+v", name, level, expectFeatures, features)
+			}
+			bitstream := c.Chunk(container.FourCCVP8L).Data
+			width, height := features.Width, features.Height
+
+			// libwebp also accepts raw VP8L bitstream without the container.
+			expectRaw, err := DecodeNRGBA(bitstream, &DecoderOptions{})
+			if err != nil {
+				t.Fatalf("Got Error: %v", err)
+			}
+			if h, err := vp8l.DecodeHeader(bitstream); err != nil || h.Width != width || h.Height != height || h.HasAlpha != features.HasAlpha {
+				t.Errorf("%v at level %d: Unexpected header %+v of raw bitstream, error: %v", name, level, h, err)
+			}
+			if got, err := decodeVP8L(bitstream, width, height, &DecoderOptions{}, false); err != nil || !bytes.Equal(got.Pix, expectRaw.Pix) {
+				t.Errorf("%v at level %d: Raw bitstream differs from libwebp, error: %v", name, level, err)
+			}
+
+			for _, o := range options {
+				expectNRGBA, err := DecodeNRGBA(data, o)
+				if err != nil {
+					t.Fatalf("Got Error: %v", err)
+				}
+				nrgba, err := decodeVP8L(bitstream, width, height, o, false)
+				if err != nil {
+					t.Errorf("%v at level %d with %+v: Got Error: %v", name, level, o, err)
+					continue
+				}
+				if image.Rect(0, 0, nrgba.Width, nrgba.Height) != expectNRGBA.Rect || !bytes.Equal(nrgba.Pix, expectNRGBA.Pix) {
+					t.Errorf("%v at level %d with %+v: NRGBA differs from libwebp", name, level, o)
+				}
+
+				expectRGBA, err := DecodeRGBA(data, o)
+				if err != nil {
+					t.Fatalf("Got Error: %v", err)
+				}
+				rgba, err := decodeVP8L(bitstream, width, height, o, true)
+				if err != nil {
+					t.Errorf("%v at level %d with %+v: Got Error: %v", name, level, o, err)
+					continue
+				}
+				if image.Rect(0, 0, rgba.Width, rgba.Height) != expectRGBA.Rect || !bytes.Equal(rgba.Pix, expectRGBA.Pix) {
+					t.Errorf("%v at level %d with %+v: RGBA differs from libwebp", name, level, o)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeLosslessMatchesLibwebp(t *testing.T) {
+	images := losslessTestImages()
+	// Transparent pixels have colors, which are discarded unless exact.
+	transparent := image.NewNRGBA(image.Rect(0, 0, 57, 43))
+	for y := 0; y < 43; y++ {
+		for x := 0; x < 57; x++ {
+			transparent.SetNRGBA(x, y, color.NRGBA{uint8(x * 4), uint8(y * 5), uint8(x ^ y), uint8(max(x-20, 0) * 7)})
+		}
+	}
+	images["transparent"] = transparent
+	rgba := image.NewRGBA(transparent.Rect)
+	draw.Draw(rgba, rgba.Rect, transparent, image.Point{}, draw.Src)
+	images["premultiplied"] = rgba
+	gray := image.NewGray(image.Rect(0, 0, 90, 70))
+	draw.Draw(gray, gray.Rect, util.ReadPNG("kinkaku.png"), image.Pt(300, 200), draw.Src)
+	images["gray"] = gray
+
+	for name, img := range images {
+		for _, level := range []int{0, 5, 9} {
+			for _, exact := range []bool{false, true} {
+				config, err := ConfigLosslessPreset(level)
+				if err != nil {
+					t.Fatalf("Got Error: %v", err)
+				}
+				config.SetExact(exact)
+
+				var buf bytes.Buffer
+				if err := EncodeRGBA(&buf, img, config); err != nil {
+					t.Fatalf("Got Error: %v", err)
+				}
+				expect, err := DecodeNRGBA(buf.Bytes(), &DecoderOptions{})
+				if err != nil {
+					t.Fatalf("Got Error: %v", err)
+				}
+
+				// The raw bitstream is decoded by libwebp without the
+				// container, which is added by the encoder without cgo.
+				b := img.Bounds()
+				options := vp8l.Options{Method: config.Method(), Quality: config.Quality()}
+				bitstream, _, err := vp8l.Encode(imageToARGB(img, exact), b.Dx(), b.Dy(), options)
+				if err != nil {
+					t.Errorf("%v at level %d (exact: %v): Got Error: %v", name, level, exact, err)
+					continue
+				}
+				features, err := GetFeatures(bitstream)
+				if err != nil || features.Format != int(container.FormatLossless) {
+					t.Errorf("%v at level %d (exact: %v): Unexpected features %+v, error: %v", name, level, exact, features, err)
+				}
+				got, err := DecodeNRGBA(bitstream, &DecoderOptions{})
+				if err != nil {
+					t.Errorf("%v at level %d (exact: %v): Got Error: %v", name, level, exact, err)
+					continue
+				}
+				if !exact {
+					// libwebp may keep any colors of transparent pixels.
+					for i := 0; i < len(expect.Pix); i += 4 {
+						if expect.Pix[i+3] == 0 {
+							copy(expect.Pix[i:i+3], got.Pix[i:i+3])
+						}
+					}
+				}
+				if !bytes.Equal(got.Pix, expect.Pix) {
+					t.Errorf("%v at level %d (exact: %v): Decoded pixels differ from libwebp", name, level, exact)
+				}
+			}
+		}
+	}
+}
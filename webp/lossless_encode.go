@@ -0,0 +1,128 @@
+//go:build !cgo
+
+package webp
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/pixiv/go-libwebp/container"
+	"github.com/pixiv/go-libwebp/internal/vp8l"
+	"github.com/pixiv/go-libwebp/mux"
+)
+
+// This file adapts the pure-Go encoder of internal/vp8l to the API, which is
+// used when cgo is not available. The encoded images are decoded by libwebp
+// into the same pixels as the ones encoded by libwebp, while they may be
+// larger.
+
+// Sizes of the headers of simple format
+const (
+	riffHeaderSize  = 12
+	chunkHeaderSize = 8
+)
+
+// appendEncodeLossless encodes image.Image into WebP of VP8L bitstream in pure
+// Go, and appends it to dst. dst is returned as it is if an error occurs. Only
+// Lossless, Method, Quality, Exact and Metadata of the configuration are used.
+// It fills dstStats with the statistics if it is not nil, whose CodedSize does
+// not include the metadata like libwebp.
+func appendEncodeLossless(dst []byte, img image.Image, c *Config, progressHook ProgressHook, dstStats *EncodeStats) ([]byte, error) {
+	if err := ValidateConfig(c); err != nil {
+		return dst, err
+	}
+	if !c.Lossless() {
+		return dst, fmt.Errorf("Lossy encoding requires cgo: %w", &EncodeError{encodeErrorCode: EncodeErrorCodeVP8EncErrorInvalidConfiguration})
+	}
+	b := img.Bounds()
+	if b.Empty() {
+		return dst, &EncodeError{encodeErrorCode: EncodeErrorCodeVP8EncErrorBadDimension}
+	}
+
+	argb := imageToARGB(img, c.Exact())
+	options := vp8l.Options{Method: c.Method(), Quality: c.Quality()}
+	if progressHook != nil {
+		options.Progress = func(percent int) (ok bool) {
+			// A panicking hook aborts encoding as well as libwebp.
+			defer func() {
+				if r := recover(); r != nil {
+					ok = false
+				}
+			}()
+			return progressHook(percent)
+		}
+	}
+	bitstream, stats, err := vp8l.Encode(argb, b.Dx(), b.Dy(), options)
+	switch {
+	case errors.Is(err, vp8l.ErrImageSize):
+		return dst, &EncodeError{encodeErrorCode: EncodeErrorCodeVP8EncErrorBadDimension}
+	case errors.Is(err, vp8l.ErrAborted):
+		return dst, &EncodeError{encodeErrorCode: EncodeErrorCodeVP8EncErrorUserAbort}
+	case err != nil:
+		return dst, err
+	}
+
+	chunks, err := losslessChunks(bitstream, b.Dx(), b.Dy(), c.metadata)
+	if err != nil {
+		return dst, err
+	}
+	data, err := container.Append(dst, chunks...)
+	if err != nil {
+		return dst, err
+	}
+
+	if dstStats != nil {
+		*dstStats = EncodeStats{
+			CodedSize:          riffHeaderSize + chunkHeaderSize + len(bitstream) + len(bitstream)&1,
+			LosslessFeatures:   LosslessFeatures(stats.Transforms),
+			TransformBits:      stats.TransformBits,
+			CacheBits:          stats.CacheBits,
+			PaletteSize:        stats.PaletteSize,
+			LosslessSize:       len(bitstream),
+			LosslessHeaderSize: stats.HeaderSize,
+			LosslessDataSize:   stats.DataSize,
+		}
+	}
+	return data, nil
+}
+
+// losslessChunks returns the chunks of the encoded image. Like WebPMuxAssemble
+// of libwebp, the extended format with VP8X chunk is used only if the metadata
+// has any chunk.
+func losslessChunks(bitstream []byte, width, height int, m *mux.Metadata) ([]container.Chunk, error) {
+	newChunk := func(id container.FourCC, data []byte) container.Chunk {
+		return container.Chunk{ChunkHeader: container.ChunkHeader{ID: id, Size: uint32(len(data))}, Data: data}
+	}
+	vp8lChunk := newChunk(container.FourCCVP8L, bitstream)
+	if m == nil || len(m.ICCProfile) == 0 && len(m.EXIF) == 0 && len(m.XMP) == 0 {
+		return []container.Chunk{vp8lChunk}, nil
+	}
+
+	h, err := vp8l.DecodeHeader(bitstream)
+	if err != nil {
+		return nil, err
+	}
+	x := &container.VP8X{CanvasWidth: width, CanvasHeight: height}
+	if h.HasAlpha {
+		x.Flags |= container.FlagAlpha
+	}
+	chunks := []container.Chunk{{}} // VP8X chunk, which is set after the flags
+	if len(m.ICCProfile) > 0 {
+		x.Flags |= container.FlagICC
+		chunks = append(chunks, newChunk(container.FourCCICCP, m.ICCProfile))
+	}
+	chunks = append(chunks, vp8lChunk)
+	if len(m.EXIF) > 0 {
+		x.Flags |= container.FlagEXIF
+		chunks = append(chunks, newChunk(container.FourCCEXIF, m.EXIF))
+	}
+	if len(m.XMP) > 0 {
+		x.Flags |= container.FlagXMP
+		chunks = append(chunks, newChunk(container.FourCCXMP, m.XMP))
+	}
+	if chunks[0], err = x.Chunk(); err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
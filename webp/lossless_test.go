@@ -0,0 +1,132 @@
+//go:build !cgo
+
+package webp
+
+import (
+	"errors"
+	"image"
+	"testing"
+
+	"github.com/pixiv/go-libwebp/container"
+	"github.com/pixiv/go-libwebp/test/util"
+)
+
+// encodeCheckerboard encodes checkerboard.png losslessly in pure Go.
+func encodeCheckerboard(t *testing.T) []byte {
+	config, err := ConfigLosslessPreset(6)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	data, err := appendEncodeLossless(nil, util.ReadPNG("checkerboard.png"), config, nil, nil)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	return data
+}
+
+func TestGetLosslessFeatures(t *testing.T) {
+	data := encodeCheckerboard(t)
+	raw := data[riffHeaderSize+chunkHeaderSize:]
+
+	for _, d := range [][]byte{data, raw} {
+		f, bitstream, err := getLosslessFeatures(d)
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+		expect := BitstreamFeatures{Width: 24, Height: 24, Format: int(container.FormatLossless)}
+		if *f != expect {
+			t.Errorf("Expected features %+v, but got %+v", expect, *f)
+		}
+		if len(bitstream) != len(raw) {
+			t.Errorf("Expected bitstream of %d bytes, but got %d bytes", len(raw), len(bitstream))
+		}
+	}
+
+	f, bitstream, err := getLosslessFeatures(util.ReadFile("cosmos.webp"))
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if f.Format != int(container.FormatLossy) || bitstream != nil {
+		t.Errorf("Expected lossy features without bitstream, but got %+v", *f)
+	}
+}
+
+func TestDecodeLosslessErrors(t *testing.T) {
+	data := encodeCheckerboard(t)
+	raw := data[riffHeaderSize+chunkHeaderSize:]
+
+	var optionErr *OptionError
+	var limitErr *LimitError
+	tests := []struct {
+		name    string
+		data    []byte
+		options *DecoderOptions
+		target  any
+	}{
+		{"empty", nil, &DecoderOptions{}, ErrNotEnoughData},
+		{"truncated", data[:len(data)/2], &DecoderOptions{}, ErrNotEnoughData},
+		{"truncated raw bitstream", raw[:len(raw)/2], &DecoderOptions{}, ErrNotEnoughData},
+		{"invalid signature", append([]byte{0x2e}, raw[1:]...), &DecoderOptions{}, ErrBitstream},
+		{"lossy", util.ReadFile("cosmos.webp"), &DecoderOptions{}, ErrUnsupportedFeature},
+		{"crop exceeds image", data, &DecoderOptions{Crop: image.Rect(0, 0, 1000, 1)}, &optionErr},
+		{"limit", data, &DecoderOptions{Limits: Limits{MaxPixels: 100}}, &limitErr},
+	}
+
+	for _, tt := range tests {
+		_, err := decodeLosslessNRGBA(tt.data, tt.options)
+		if err == nil {
+			t.Errorf("%v: Expected error", tt.name)
+			continue
+		}
+		if target, ok := tt.target.(error); ok {
+			if !errors.Is(err, target) {
+				t.Errorf("%v: Expected %v, but got %v", tt.name, target, err)
+			}
+		} else if !errors.As(err, tt.target) {
+			t.Errorf("%v: Expected %T, but got %v", tt.name, tt.target, err)
+		}
+	}
+}
+
+func TestEncodeLosslessErrors(t *testing.T) {
+	img := util.ReadPNG("checkerboard.png")
+	config, err := ConfigPreset(PresetDefault, 75)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	var encodeErr *EncodeError
+	if _, err := appendEncodeLossless(nil, img, config, nil, nil); !errors.As(err, &encodeErr) || encodeErr.EncodeErrorCode() != EncodeErrorCodeVP8EncErrorInvalidConfiguration {
+		t.Errorf("Expected invalid configuration for lossy encoding, but got %v", err)
+	}
+
+	config.SetLossless(true)
+	dst, err := appendEncodeLossless([]byte("prefix"), image.NewNRGBA(image.Rect(0, 0, 0, 5)), config, nil, nil)
+	if !errors.As(err, &encodeErr) || encodeErr.EncodeErrorCode() != EncodeErrorCodeVP8EncErrorBadDimension {
+		t.Errorf("Expected bad dimension for empty image, but got %v", err)
+	}
+	if string(dst) != "prefix" {
+		t.Errorf("Expected dst as it is on error, but got %q", dst)
+	}
+	abort := func(int) bool { return false }
+	if _, err := appendEncodeLossless(nil, img, config, abort, nil); !errors.As(err, &encodeErr) || encodeErr.EncodeErrorCode() != EncodeErrorCodeVP8EncErrorUserAbort {
+		t.Errorf("Expected user abort, but got %v", err)
+	}
+}
+
+func TestEncodeLosslessStats(t *testing.T) {
+	config, err := ConfigLosslessPreset(6)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	var stats EncodeStats
+	data, err := appendEncodeLossless([]byte("prefix"), util.ReadPNG("yellow-rose-3.png"), config, nil, &stats)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if stats.CodedSize != len(data)-len("prefix") || stats.LosslessSize == 0 || stats.LosslessSize > stats.CodedSize-riffHeaderSize-chunkHeaderSize {
+		t.Errorf("Unexpected sizes: %+v", stats)
+	}
+	if stats.LosslessFeatures != LosslessPredictor|LosslessSubtractGreen {
+		t.Errorf("Unexpected features: %v", stats.LosslessFeatures)
+	}
+}
@@ -0,0 +1,76 @@
+package webp
+
+/*
+#include <stdlib.h>
+#include <webp/encode.h>
+*/
+import "C"
+
+import (
+	"image"
+	"unsafe"
+
+	"github.com/pixiv/go-libwebp/mux"
+)
+
+// EncodeToBytes encodes image.Image into WebP and returns it as a byte slice.
+// It supports any image.Image as well as EncodeRGBA.
+//
+// Unlike EncodeRGBA, the encoded WebP is accumulated in C memory by
+// WebPMemoryWriter, and copied into Go memory at once after encoding.
+func EncodeToBytes(img image.Image, c *Config) ([]byte, error) {
+	return AppendEncode(nil, img, c)
+}
+
+// AppendEncode encodes image.Image into WebP, and appends it to dst. It
+// returns the extended slice, so that the capacity of dst can be reused
+// across encodings. dst is returned as it is if an error occurs.
+func AppendEncode(dst []byte, img image.Image, c *Config) ([]byte, error) {
+	if err := ValidateConfig(c); err != nil {
+		return dst, err
+	}
+
+	p, err := NewPicture(img)
+	if err != nil {
+		return dst, err
+	}
+	defer p.Close()
+
+	return appendEncodePicture(dst, p.pic, c)
+}
+
+// appendEncodePicture encodes the WebPPicture which is already imported with
+// WebPMemoryWriter, and appends the encoded WebP to dst.
+func appendEncodePicture(dst []byte, pic *C.WebPPicture, c *Config) ([]byte, error) {
+	// The writer is referred from the picture during encoding, so it must be
+	// in C memory.
+	mw := (*C.WebPMemoryWriter)(C.calloc(1, C.sizeof_WebPMemoryWriter))
+	if mw == nil {
+		return dst, errWebPPictureAllocate
+	}
+	defer C.free(unsafe.Pointer(mw))
+	C.WebPMemoryWriterInit(mw)
+	defer C.WebPMemoryWriterClear(mw)
+
+	pic.writer = C.WebPWriterFunction(C.WebPMemoryWrite)
+	pic.custom_ptr = unsafe.Pointer(mw)
+	pic.progress_hook = nil
+	defer func() {
+		pic.writer = nil
+		pic.custom_ptr = nil
+	}()
+
+	if C.WebPEncode(c.c.toC(), pic) == 0 {
+		return dst, &EncodeError{encodeErrorCode: EncodeErrorCode(pic.error_code)}
+	}
+
+	data := unsafe.Slice((*byte)(unsafe.Pointer(mw.mem)), int(mw.size))
+	if c.metadata != nil {
+		withMetadata, err := mux.SetMetadata(data, c.metadata)
+		if err != nil {
+			return dst, err
+		}
+		return append(dst, withMetadata...), nil
+	}
+	return append(dst, data...), nil
+}
@@ -0,0 +1,134 @@
+//go:build !cgo
+
+package webp_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"slices"
+	"testing"
+
+	"github.com/pixiv/go-libwebp/container"
+	"github.com/pixiv/go-libwebp/mux"
+	"github.com/pixiv/go-libwebp/test/util"
+	"github.com/pixiv/go-libwebp/webp"
+)
+
+func TestEncodeLosslessWithoutCgo(t *testing.T) {
+	src := util.ReadPNG("yellow-rose-3.png")
+	img := image.NewNRGBA(src.Bounds())
+	draw.Draw(img, img.Rect, src, img.Rect.Min, draw.Src)
+
+	config, err := webp.ConfigLosslessPreset(6)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	config.SetExact(true)
+	var buf bytes.Buffer
+	if err := webp.EncodeRGBA(&buf, img, config); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	decoded, err := webp.DecodeNRGBA(buf.Bytes(), &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if decoded.Rect != img.Rect || !bytes.Equal(decoded.Pix, img.Pix) {
+		t.Errorf("Decoded image differs from the source")
+	}
+}
+
+func TestEncodeLossyWithoutCgo(t *testing.T) {
+	config, err := webp.ConfigPreset(webp.PresetDefault, 75)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	var encodeErr *webp.EncodeError
+	err = webp.EncodeRGBA(&bytes.Buffer{}, util.ReadPNG("checkerboard.png"), config)
+	if !errors.As(err, &encodeErr) || encodeErr.EncodeErrorCode() != webp.EncodeErrorCodeVP8EncErrorInvalidConfiguration {
+		t.Errorf("Expected invalid configuration, but got %v", err)
+	}
+}
+
+func TestEncodeMetadataWithoutCgo(t *testing.T) {
+	config, err := webp.ConfigLosslessPreset(3)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	img := util.ReadPNG("yellow-rose-3.png")
+	plain, err := webp.EncodeToBytes(img, config)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	metadata := &mux.Metadata{ICCProfile: []byte("icc"), EXIF: []byte("exif"), XMP: []byte("<xmp/>")}
+	config.SetMetadata(metadata)
+	var buf bytes.Buffer
+	stats, err := webp.EncodeRGBAWithStats(&buf, img, config)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if stats.CodedSize != len(plain) {
+		t.Errorf("Expected coded size %d without metadata, but got %d", len(plain), stats.CodedSize)
+	}
+
+	c, err := container.Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	var ids []container.FourCC
+	for _, chunk := range c.Chunks {
+		ids = append(ids, chunk.ID)
+	}
+	expectIDs := []container.FourCC{container.FourCCVP8X, container.FourCCICCP, container.FourCCVP8L, container.FourCCEXIF, container.FourCCXMP}
+	if !slices.Equal(ids, expectIDs) {
+		t.Errorf("Expected chunks %q, but got %q", expectIDs, ids)
+	}
+	expectFlags := container.FlagICC | container.FlagAlpha | container.FlagEXIF | container.FlagXMP
+	if c.VP8X.Flags != expectFlags || c.Width != 400 || c.Height != 301 {
+		t.Errorf("Unexpected VP8X: %+v", *c.VP8X)
+	}
+	if got := c.Chunk(container.FourCCXMP).Data; !bytes.Equal(got, metadata.XMP) {
+		t.Errorf("Expected XMP %q, but got %q", metadata.XMP, got)
+	}
+
+	expect, err := webp.DecodeNRGBA(plain, nil)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	decoded, err := webp.DecodeNRGBA(buf.Bytes(), nil)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if !bytes.Equal(decoded.Pix, expect.Pix) {
+		t.Errorf("Decoded image with metadata differs from the one without metadata")
+	}
+}
+
+func TestDecodeWithNilOptionsWithoutCgo(t *testing.T) {
+	config, err := webp.ConfigLosslessPreset(0)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	data, err := webp.EncodeToBytes(util.ReadPNG("yellow-rose-3.png"), config)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	expect, err := webp.DecodeNRGBA(data, &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	img, err := webp.DecodeNRGBA(data, nil)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if img.Rect != expect.Rect || !bytes.Equal(img.Pix, expect.Pix) {
+		t.Errorf("Decoded image with nil options is different from the one with zero options")
+	}
+	if _, err := webp.DecodeRGBA(data, nil); err != nil {
+		t.Errorf("Got Error: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package webp
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// ColorMode represents the color mode of decoded image, which corresponds to
+// C.WEBP_CSP_MODE. The values are the same as libwebp, so that they are
+// available without cgo.
+type ColorMode int
+
+const (
+	ModeRGB                   ColorMode = iota // R, G, B
+	ModeRGBA                                   // R, G, B, A
+	ModeBGR                                    // B, G, R
+	ModeBGRA                                   // B, G, R, A
+	ModeARGB                                   // A, R, G, B
+	ModeRGBA4444                               // RRRRGGGG, BBBBAAAA
+	ModeRGB565                                 // RRRRRGGG, GGGBBBBB
+	ModePremultipliedRGBA                      // R, G, B, A with premultiplied alpha
+	ModePremultipliedBGRA                      // B, G, R, A with premultiplied alpha
+	ModePremultipliedARGB                      // A, R, G, B with premultiplied alpha
+	ModePremultipliedRGBA4444                  // RRRRGGGG, BBBBAAAA with premultiplied alpha
+	ModeYUV                                    // YUV 4:2:0
+	ModeYUVA                                   // YUV 4:2:0 with alpha channel
+)
+
+// IsRGB reports whether the color mode is one of RGB modes, whose pixels are
+// packed into a single plane.
+func (m ColorMode) IsRGB() bool {
+	return m >= ModeRGB && m < ModeYUV
+}
+
+// HasAlpha reports whether the color mode has alpha channel.
+func (m ColorMode) HasAlpha() bool {
+	switch m {
+	case ModeRGB, ModeBGR, ModeRGB565, ModeYUV:
+		return false
+	}
+	return m.IsValid()
+}
+
+// IsPremultiplied reports whether the color mode has premultiplied alpha.
+func (m ColorMode) IsPremultiplied() bool {
+	switch m {
+	case ModePremultipliedRGBA, ModePremultipliedBGRA, ModePremultipliedARGB, ModePremultipliedRGBA4444:
+		return true
+	}
+	return false
+}
+
+// IsValid reports whether the color mode is known.
+func (m ColorMode) IsValid() bool {
+	return m >= ModeRGB && m <= ModeYUVA
+}
+
+// BytesPerPixel returns the number of bytes per pixel of RGB modes, or 0 for
+// YUV modes.
+func (m ColorMode) BytesPerPixel() int {
+	switch m {
+	case ModeRGB, ModeBGR:
+		return 3
+	case ModeRGBA4444, ModeRGB565, ModePremultipliedRGBA4444:
+		return 2
+	case ModeRGBA, ModeBGRA, ModeARGB, ModePremultipliedRGBA, ModePremultipliedBGRA, ModePremultipliedARGB:
+		return 4
+	}
+	return 0
+}
+
+// unpack returns the components of the pixel p. They are premultiplied if the
+// color mode has premultiplied alpha.
+func (m ColorMode) unpack(p []uint8) (r, g, b, a uint8) {
+	switch m {
+	case ModeRGB:
+		return p[0], p[1], p[2], 0xff
+	case ModeBGR:
+		return p[2], p[1], p[0], 0xff
+	case ModeRGBA, ModePremultipliedRGBA:
+		return p[0], p[1], p[2], p[3]
+	case ModeBGRA, ModePremultipliedBGRA:
+		return p[2], p[1], p[0], p[3]
+	case ModeARGB, ModePremultipliedARGB:
+		return p[1], p[2], p[3], p[0]
+	case ModeRGBA4444, ModePremultipliedRGBA4444:
+		return (p[0] >> 4) * 0x11, (p[0] & 0x0f) * 0x11, (p[1] >> 4) * 0x11, (p[1] & 0x0f) * 0x11
+	case ModeRGB565:
+		r, g, b = p[0]&0xf8, (p[0]<<5)|((p[1]>>3)&0x1c), p[1]<<3
+		return r | r>>5, g | g>>6, b | b>>5, 0xff
+	}
+	return
+}
+
+// pack stores the components into the pixel p in the same way as libwebp.
+func (m ColorMode) pack(p []uint8, r, g, b, a uint8) {
+	switch m {
+	case ModeRGB:
+		p[0], p[1], p[2] = r, g, b
+	case ModeBGR:
+		p[0], p[1], p[2] = b, g, r
+	case ModeRGBA, ModePremultipliedRGBA:
+		p[0], p[1], p[2], p[3] = r, g, b, a
+	case ModeBGRA, ModePremultipliedBGRA:
+		p[0], p[1], p[2], p[3] = b, g, r, a
+	case ModeARGB, ModePremultipliedARGB:
+		p[0], p[1], p[2], p[3] = a, r, g, b
+	case ModeRGBA4444, ModePremultipliedRGBA4444:
+		p[0], p[1] = (r&0xf0)|(g>>4), (b&0xf0)|(a>>4)
+	case ModeRGB565:
+		p[0], p[1] = (r&0xf8)|(g>>5), ((g<<3)&0xe0)|(b>>3)
+	}
+}
+
+// color returns the color of the pixel p.
+func (m ColorMode) color(p []uint8) color.Color {
+	r, g, b, a := m.unpack(p)
+	if m.IsPremultiplied() {
+		return color.RGBA{r, g, b, a}
+	}
+	return color.NRGBA{r, g, b, a}
+}
+
+// setColor stores the color c into the pixel p. The color is composited over
+// black if the color mode does not have alpha channel.
+func (m ColorMode) setColor(p []uint8, c color.Color) {
+	if m.IsPremultiplied() || !m.HasAlpha() {
+		c := color.RGBAModel.Convert(c).(color.RGBA)
+		m.pack(p, c.R, c.G, c.B, c.A)
+		return
+	}
+	c1 := color.NRGBAModel.Convert(c).(color.NRGBA)
+	m.pack(p, c1.R, c1.G, c1.B, c1.A)
+}
+
+// convert converts the color c to the color which can be represented in the
+// color mode.
+func (m ColorMode) convert(c color.Color) color.Color {
+	var p [4]uint8
+	m.setColor(p[:], c)
+	return m.color(p[:])
+}
+
+// PackedImage represents image data whose pixels are packed in the byte order of
+// the color mode, such as BGRA or RGB565. The color mode must be one of RGB
+// modes.
+type PackedImage struct {
+	// Pix holds the image's pixels in the byte order of Mode.
+	Pix []uint8
+	// Stride is the Pix stride (in bytes) between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+	// Mode is the color mode of pixels.
+	Mode ColorMode
+}
+
+// NewPackedImage allocates and returns image of the color mode, which must be
+// one of RGB modes.
+func NewPackedImage(r image.Rectangle, mode ColorMode) *PackedImage {
+	return newPackedImage(r, mode, func(n int) []byte { return make([]byte, n) })
+}
+
+// newPackedImage creates image whose buffer is allocated by alloc.
+func newPackedImage(r image.Rectangle, mode ColorMode, alloc func(n int) []byte) *PackedImage {
+	w, h := r.Dx(), r.Dy()
+	bpp := mode.BytesPerPixel()
+	return &PackedImage{Pix: alloc(bpp * w * h), Stride: bpp * w, Rect: r, Mode: mode}
+}
+
+// ColorModel returns the color model of the color mode. Colors are converted
+// to color.NRGBA, or color.RGBA for premultiplied modes, with the precision of
+// the color mode.
+func (p *PackedImage) ColorModel() color.Model {
+	return color.ModelFunc(p.Mode.convert)
+}
+
+// Bounds implements image.Image.Bounds
+func (p *PackedImage) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+// At implements image.Image.At
+func (p *PackedImage) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		if p.Mode.IsPremultiplied() {
+			return color.RGBA{}
+		}
+		return color.NRGBA{}
+	}
+	return p.Mode.color(p.Pix[p.PixOffset(x, y):])
+}
+
+// Set implements draw.Image.Set
+func (p *PackedImage) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	p.Mode.setColor(p.Pix[p.PixOffset(x, y):], c)
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the pixel at (x, y).
+func (p *PackedImage) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*p.Mode.BytesPerPixel()
+}
+
+// SubImage returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels with the original image.
+func (p *PackedImage) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		return &PackedImage{Mode: p.Mode}
+	}
+	i := p.PixOffset(r.Min.X, r.Min.Y)
+	return &PackedImage{
+		Pix:    p.Pix[i:],
+		Stride: p.Stride,
+		Rect:   r,
+		Mode:   p.Mode,
+	}
+}
+
+// Make sure PackedImage implements draw.Image.
+var _ draw.Image = new(PackedImage)
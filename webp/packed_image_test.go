@@ -0,0 +1,74 @@
+package webp
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestColorModePackUnpack(t *testing.T) {
+	tests := []struct {
+		mode   ColorMode
+		pixel  []uint8
+		expect color.Color
+	}{
+		{ModeRGB, []uint8{0x11, 0x22, 0x33}, color.NRGBA{0x11, 0x22, 0x33, 0xff}},
+		{ModeBGR, []uint8{0x33, 0x22, 0x11}, color.NRGBA{0x11, 0x22, 0x33, 0xff}},
+		{ModeRGBA, []uint8{0x11, 0x22, 0x33, 0x44}, color.NRGBA{0x11, 0x22, 0x33, 0x44}},
+		{ModeBGRA, []uint8{0x33, 0x22, 0x11, 0x44}, color.NRGBA{0x11, 0x22, 0x33, 0x44}},
+		{ModeARGB, []uint8{0x44, 0x11, 0x22, 0x33}, color.NRGBA{0x11, 0x22, 0x33, 0x44}},
+		{ModeRGBA4444, []uint8{0x12, 0x34}, color.NRGBA{0x11, 0x22, 0x33, 0x44}},
+		{ModeRGB565, []uint8{0xf8, 0x1f}, color.NRGBA{0xff, 0x00, 0xff, 0xff}},
+		{ModeRGB565, []uint8{0x07, 0xe0}, color.NRGBA{0x00, 0xff, 0x00, 0xff}},
+		{ModePremultipliedRGBA, []uint8{0x11, 0x22, 0x33, 0x44}, color.RGBA{0x11, 0x22, 0x33, 0x44}},
+		{ModePremultipliedBGRA, []uint8{0x33, 0x22, 0x11, 0x44}, color.RGBA{0x11, 0x22, 0x33, 0x44}},
+		{ModePremultipliedARGB, []uint8{0x44, 0x11, 0x22, 0x33}, color.RGBA{0x11, 0x22, 0x33, 0x44}},
+		{ModePremultipliedRGBA4444, []uint8{0x12, 0x34}, color.RGBA{0x11, 0x22, 0x33, 0x44}},
+	}
+
+	for _, tt := range tests {
+		if got := tt.mode.color(tt.pixel); got != tt.expect {
+			t.Errorf("mode %d: got: %v, expect: %v", tt.mode, got, tt.expect)
+		}
+		p := make([]uint8, tt.mode.BytesPerPixel())
+		tt.mode.setColor(p, tt.expect)
+		for i := range p {
+			if p[i] != tt.pixel[i] {
+				t.Errorf("mode %d: got: %v, expect: %v", tt.mode, p, tt.pixel)
+				break
+			}
+		}
+	}
+}
+
+func TestPackedImage(t *testing.T) {
+	rect := image.Rect(1, 2, 5, 6)
+	img := NewPackedImage(rect, ModeBGRA)
+	if got := img.Bounds(); got != rect {
+		t.Errorf("Bounds() should return %v, got: %v", rect, got)
+	}
+
+	c := color.NRGBA{0x11, 0x22, 0x33, 0x44}
+	img.Set(2, 3, c)
+	if got := img.At(2, 3); got != c {
+		t.Errorf("At(2, 3) should return %v, got: %v", c, got)
+	}
+	if got := img.SubImage(image.Rect(2, 3, 4, 4)).At(2, 3); got != c {
+		t.Errorf("At(2, 3) of sub-image should return %v, got: %v", c, got)
+	}
+	if got := img.At(0, 0); got != (color.NRGBA{}) {
+		t.Errorf("At(0, 0) should return %v, got: %v", color.NRGBA{}, got)
+	}
+
+	// Colors are quantized by the color model.
+	img = NewPackedImage(rect, ModeRGB565)
+	draw.Draw(img, rect, image.NewUniform(color.NRGBA{0x12, 0x34, 0x56, 0xff}), image.Point{}, draw.Src)
+	expect := img.ColorModel().Convert(color.NRGBA{0x12, 0x34, 0x56, 0xff})
+	if got := img.At(4, 5); got != expect {
+		t.Errorf("At(4, 5) should return %v, got: %v", expect, got)
+	}
+	if expect != (color.NRGBA{0x10, 0x34, 0x52, 0xff}) {
+		t.Errorf("Converted color should be quantized, got: %v", expect)
+	}
+}
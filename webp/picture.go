@@ -0,0 +1,292 @@
+package webp
+
+/*
+#include <stdlib.h>
+#include <webp/encode.h>
+
+int golibwebpWriteWebP(uint8_t*, size_t, struct WebPPicture*);
+int golibwebpProgressHook(int, struct WebPPicture*);
+*/
+import "C"
+
+import (
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"unsafe"
+)
+
+var errPictureRescale = errors.New("Could not rescale picture")
+var errPictureCrop = errors.New("Could not crop picture")
+var errPictureView = errors.New("Could not extract view of picture")
+var errPictureConvert = errors.New("Could not convert picture")
+var errPictureClosed = errors.New("Picture is already closed")
+
+// Picture represents an image to be encoded, which corresponds to
+// C.WebPPicture. Its pixels are held in C memory, so that they can be
+// transformed by libwebp before encoding without round trips through Go
+// images. It must be released by Close after use.
+type Picture struct {
+	pic *C.WebPPicture
+	src *Picture // Source picture of the view, which must out-live the view
+}
+
+// NewPicture creates a Picture and imports the pixels of image.Image into it.
+// It supports any image.Image as well as EncodeRGBA, and YUVAImage.
+func NewPicture(img image.Image) (*Picture, error) {
+	p, err := newPicture()
+	if err != nil {
+		return nil, err
+	}
+	if err := importRGBA(p.pic, img); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func newPicture() (*Picture, error) {
+	pic := (*C.WebPPicture)(C.calloc(1, C.sizeof_WebPPicture))
+	if pic == nil {
+		return nil, errWebPPictureAllocate
+	}
+	if C.WebPPictureInit(pic) == 0 {
+		C.free(unsafe.Pointer(pic))
+		return nil, errWebPPictureInitialize
+	}
+	return &Picture{pic: pic}, nil
+}
+
+// Close releases the picture. The methods which can fail return an error after
+// Close, and the others return zero values or do nothing. The same applies to
+// the views of the picture.
+func (p *Picture) Close() {
+	if p.pic == nil {
+		return
+	}
+	C.WebPPictureFree(p.pic)
+	C.free(unsafe.Pointer(p.pic))
+	p.pic = nil
+	p.src = nil
+}
+
+// closed reports whether the picture, or the source picture of the view is
+// already released.
+func (p *Picture) closed() bool {
+	return p.pic == nil || p.src != nil && p.src.closed()
+}
+
+// Width returns the width of the picture in pixels.
+func (p *Picture) Width() int {
+	if p.closed() {
+		return 0
+	}
+	return int(p.pic.width)
+}
+
+// Height returns the height of the picture in pixels.
+func (p *Picture) Height() int {
+	if p.closed() {
+		return 0
+	}
+	return int(p.pic.height)
+}
+
+// UseARGB reports whether the picture holds pixels as ARGB, or YUV otherwise.
+func (p *Picture) UseARGB() bool {
+	return !p.closed() && p.pic.use_argb != 0
+}
+
+// IsView reports whether the picture is a view of another picture.
+func (p *Picture) IsView() bool {
+	return !p.closed() && C.WebPPictureIsView(p.pic) != 0
+}
+
+// HasTransparency reports whether the picture has non-opaque pixels.
+func (p *Picture) HasTransparency() bool {
+	return !p.closed() && C.WebPPictureHasTransparency(p.pic) != 0
+}
+
+// Rescale rescales the picture to the size. If either width or height is 0,
+// it is calculated to preserve the aspect ratio. A view is turned into a
+// normal picture which owns its pixels.
+func (p *Picture) Rescale(width, height int) error {
+	if p.closed() {
+		return errPictureClosed
+	}
+	if C.WebPPictureRescale(p.pic, C.int(width), C.int(height)) == 0 {
+		return errPictureRescale
+	}
+	p.src = nil
+	return nil
+}
+
+// Crop crops the picture to the rectangle, which must be inside the picture.
+// If the picture holds pixels as YUV, the left and top are snapped to even
+// values. A view is turned into a normal picture which owns its pixels.
+func (p *Picture) Crop(r image.Rectangle) error {
+	if p.closed() {
+		return errPictureClosed
+	}
+	if C.WebPPictureCrop(p.pic, C.int(r.Min.X), C.int(r.Min.Y), C.int(r.Dx()), C.int(r.Dy())) == 0 {
+		return errPictureCrop
+	}
+	p.src = nil
+	return nil
+}
+
+// View returns the picture which refers to the rectangle of the picture
+// without copying pixels. The rectangle must be inside the picture, and its
+// left and top are snapped to even values if the picture holds pixels as YUV.
+// The view must be released by Close. Modifying the pixels of the view, for
+// example by Flip, modifies the pixels of the source picture.
+func (p *Picture) View(r image.Rectangle) (*Picture, error) {
+	if p.closed() {
+		return nil, errPictureClosed
+	}
+	v, err := newPicture()
+	if err != nil {
+		return nil, err
+	}
+	if C.WebPPictureView(p.pic, C.int(r.Min.X), C.int(r.Min.Y), C.int(r.Dx()), C.int(r.Dy()), v.pic) == 0 {
+		v.Close()
+		return nil, errPictureView
+	}
+	v.src = p
+	return v, nil
+}
+
+// Flip flips the picture vertically. For YUV pictures, the rows of chroma
+// samples are flipped as well, so that they are shifted by a row of pixels if
+// the height is odd. Flipping a view flips the rows of the source picture
+// inside the view.
+func (p *Picture) Flip() {
+	if p.closed() {
+		return
+	}
+	width, height := p.Width(), p.Height()
+	if p.UseARGB() {
+		flipRows(unsafe.Pointer(p.pic.argb), 4*width, 4*int(p.pic.argb_stride), height)
+		return
+	}
+	cw, ch := (width+1)/2, (height+1)/2
+	flipRows(unsafe.Pointer(p.pic.y), width, int(p.pic.y_stride), height)
+	flipRows(unsafe.Pointer(p.pic.u), cw, int(p.pic.uv_stride), ch)
+	flipRows(unsafe.Pointer(p.pic.v), cw, int(p.pic.uv_stride), ch)
+	if p.pic.a != nil {
+		flipRows(unsafe.Pointer(p.pic.a), width, int(p.pic.a_stride), height)
+	}
+}
+
+// flipRows swaps the rows of the plane in C memory upside down.
+func flipRows(plane unsafe.Pointer, rowSize, stride, height int) {
+	if plane == nil || height < 2 {
+		return
+	}
+	pix := unsafe.Slice((*uint8)(plane), stride*(height-1)+rowSize)
+	tmp := make([]uint8, rowSize)
+	for top, bottom := 0, height-1; top < bottom; top, bottom = top+1, bottom-1 {
+		t, b := pix[top*stride:top*stride+rowSize], pix[bottom*stride:bottom*stride+rowSize]
+		copy(tmp, t)
+		copy(t, b)
+		copy(b, tmp)
+	}
+}
+
+// CleanupTransparentArea replaces the colors of fully transparent areas with
+// flat colors, which improves compression of lossy encoding.
+func (p *Picture) CleanupTransparentArea() {
+	if p.closed() {
+		return
+	}
+	C.WebPCleanupTransparentArea(p.pic)
+}
+
+// BlendAlpha blends the colors of the picture over the background color, and
+// makes the picture opaque. The alpha of the background color is ignored.
+func (p *Picture) BlendAlpha(background color.Color) {
+	if p.closed() {
+		return
+	}
+	c := color.NRGBAModel.Convert(background).(color.NRGBA)
+	C.WebPBlendAlpha(p.pic, C.uint32_t(uint32(c.R)<<16|uint32(c.G)<<8|uint32(c.B)))
+}
+
+// SmartARGBToYUVA converts ARGB pixels of the picture into YUV, using the
+// sharper and slower RGB to YUV conversion.
+func (p *Picture) SmartARGBToYUVA() error {
+	if p.closed() {
+		return errPictureClosed
+	}
+	if C.WebPPictureSmartARGBToYUVA(p.pic) == 0 {
+		return errPictureConvert
+	}
+	return nil
+}
+
+// EncodePicture encodes and writes the picture into the writer as WebP.
+// Encoding may convert the pixels of the picture between ARGB and YUV.
+func EncodePicture(w io.Writer, p *Picture, c *Config) error {
+	return EncodePictureWithProgress(w, p, c, nil)
+}
+
+// EncodePictureWithProgress encodes and writes the picture into the writer as
+// WebP. This function accepts progress hook function and supports
+// cancellation.
+func EncodePictureWithProgress(w io.Writer, p *Picture, c *Config, progressHook ProgressHook) error {
+	if p.closed() {
+		return errPictureClosed
+	}
+	if err := ValidateConfig(c); err != nil {
+		return err
+	}
+	return encodePicture(w, p.pic, c, progressHook, nil)
+}
+
+// EncodePictureWithStats encodes and writes the picture into the writer as
+// WebP, and returns the statistics of the encoding.
+func EncodePictureWithStats(w io.Writer, p *Picture, c *Config) (*EncodeStats, error) {
+	if p.closed() {
+		return nil, errPictureClosed
+	}
+	if err := ValidateConfig(c); err != nil {
+		return nil, err
+	}
+	var stats EncodeStats
+	if err := encodePicture(w, p.pic, c, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// EncodePictureContext encodes and writes the picture into the writer as
+// WebP. Encoding is aborted when ctx is done, and the returned EncodeError
+// wraps ctx.Err().
+func EncodePictureContext(ctx context.Context, w io.Writer, p *Picture, c *Config) error {
+	return encodeWithContext(ctx, func(progressHook ProgressHook) error {
+		return EncodePictureWithProgress(w, p, c, progressHook)
+	})
+}
+
+// encodePicture encodes the WebPPicture which is already imported, and writes
+// it into the writer. It fills stats with the statistics if it is not nil.
+func encodePicture(w io.Writer, pic *C.WebPPicture, c *Config, progressHook ProgressHook, stats *EncodeStats) error {
+	out, flush := metadataWriter(w, c)
+	mgr := makeDestinationManager(out, progressHook, pic)
+	defer releaseDestinationManager(pic)
+
+	collectStats, releaseStats := attachStats(pic, stats)
+	defer releaseStats()
+
+	pic.progress_hook = C.WebPProgressHook(C.golibwebpProgressHook)
+	pic.writer = C.WebPWriterFunction(C.golibwebpWriteWebP)
+
+	if C.WebPEncode(c.c.toC(), pic) == 0 {
+		return mgr.encodeError(pic)
+	}
+
+	collectStats()
+	return flush()
+}
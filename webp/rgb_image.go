@@ -3,6 +3,7 @@ package webp
 import (
 	"image"
 	"image/color"
+	"image/draw"
 )
 
 // RGBImage represent image data which has RGB colors.
@@ -42,10 +43,48 @@ func (p *RGBImage) RGBAAt(x, y int) color.RGBA {
 	if !(image.Point{x, y}.In(p.Rect)) {
 		return color.RGBA{}
 	}
-	i := (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*3
+	i := p.PixOffset(x, y)
 	return color.RGBA{p.Pix[i+0], p.Pix[i+1], p.Pix[i+2], 0xFF}
 }
 
+// Set implements draw.Image.Set
+func (p *RGBImage) Set(x, y int, c color.Color) {
+	p.SetRGB(x, y, rgbModel(c).(RGB))
+}
+
+// SetRGB sets the color of the pixel at (x, y).
+func (p *RGBImage) SetRGB(x, y int, c RGB) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	p.Pix[i+0], p.Pix[i+1], p.Pix[i+2] = c.R, c.G, c.B
+}
+
+// PixOffset returns the index of the first element of Pix that corresponds to
+// the pixel at (x, y).
+func (p *RGBImage) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*3
+}
+
+// SubImage returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels with the original image.
+func (p *RGBImage) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	// If r1 and r2 are Rectangles, r1.Intersect(r2) is not guaranteed to be inside
+	// either r1 or r2 if the intersection is empty. Without explicitly checking for
+	// this, the Pix[i:] expression below can panic.
+	if r.Empty() {
+		return &RGBImage{}
+	}
+	i := p.PixOffset(r.Min.X, r.Min.Y)
+	return &RGBImage{
+		Pix:    p.Pix[i:],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
+
 // RGBModel is RGB color model instance
 var RGBModel = color.ModelFunc(rgbModel)
 
@@ -74,6 +113,7 @@ func (c RGB) RGBA() (r, g, b, a uint32) {
 	return
 }
 
-// Make sure RGBImage implements image.Image.
+// Make sure RGBImage implements image.Image and draw.Image.
 // See https://golang.org/doc/effective_go.html#blank_implements.
 var _ image.Image = new(RGBImage)
+var _ draw.Image = new(RGBImage)
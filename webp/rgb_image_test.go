@@ -62,3 +62,31 @@ func TestImageInterface(t *testing.T) {
 		t.Errorf("At(0, 0) should return %v, got: %v", blank, got)
 	}
 }
+
+func TestRGBImageSubImage(t *testing.T) {
+	img := NewRGBImage(image.Rect(0, 0, 4, 3))
+	copy(img.Pix[img.PixOffset(2, 1):], []uint8{0x11, 0x22, 0x33})
+
+	sub := img.SubImage(image.Rect(1, 1, 3, 3)).(*RGBImage)
+	if expect := image.Rect(1, 1, 3, 3); sub.Rect != expect {
+		t.Errorf("got: %v, expect: %v", sub.Rect, expect)
+	}
+	if got, expect := sub.RGBAAt(2, 1), (color.RGBA{0x11, 0x22, 0x33, 0xFF}); got != expect {
+		t.Errorf("got: %v, expect: %v", got, expect)
+	}
+	if got := img.SubImage(image.Rect(5, 5, 6, 6)).Bounds(); !got.Empty() {
+		t.Errorf("got: %v, expect empty", got)
+	}
+}
+
+func TestRGBImageSet(t *testing.T) {
+	img := NewRGBImage(image.Rect(0, 0, 2, 2))
+	img.Set(1, 1, color.NRGBA{0x22, 0x44, 0x66, 0x80})
+	if got, expect := img.RGBAAt(1, 1), (color.RGBA{0x11, 0x22, 0x33, 0xFF}); got != expect {
+		t.Errorf("got: %v, expect: %v", got, expect)
+	}
+	img.Set(2, 2, RGB{0x11, 0x22, 0x33})
+	if got, expect := img.RGBAAt(0, 0), (color.RGBA{0x00, 0x00, 0x00, 0xFF}); got != expect {
+		t.Errorf("got: %v, expect: %v", got, expect)
+	}
+}
@@ -0,0 +1,169 @@
+//go:build cgo
+
+package webp
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+)
+
+var errNilConfig = errors.New("Config is nil")
+var errTargetSizeUnreachable = errors.New("could not encode within target size")
+var errTargetQualityUnreachable = errors.New("could not encode with target quality")
+var errLosslessQualitySearch = errors.New("quality search requires lossy configuration")
+
+// EncodeRGBAToSize encodes image.Image into lossy WebP with the highest
+// quality factor whose size is at most size bytes, and writes it into the
+// writer. The quality factor is searched by bisection, and the other
+// parameters are taken from c. It returns the chosen quality factor and the
+// statistics of the written WebP.
+//
+// The multi-pass size search of libwebp (SetTargetSize and SetPass) is not
+// used, because it does not report the quality factor it reaches, and its
+// size excludes the alpha channel and the headers, so that the output may
+// exceed the budget. Instead, the target size and the target PSNR of c are
+// cleared, and Pass has no effect. The bisection over the integer quality
+// factors from 0 to 100 costs up to 7 full encodings, and the result is
+// buffered in memory before it is written.
+func EncodeRGBAToSize(w io.Writer, img image.Image, c *Config, size int) (float32, *EncodeStats, error) {
+	if c == nil {
+		return 0, nil, errNilConfig
+	}
+	if c.Lossless() {
+		return 0, nil, errLosslessQualitySearch
+	}
+
+	config := *c
+	config.SetTargetSize(0)
+	config.SetTargetPSNR(0)
+
+	var buf, best bytes.Buffer
+	var stats, bestStats EncodeStats
+	quality := -1
+	for lo, hi := 0, 100; lo <= hi; {
+		mid := (lo + hi) / 2
+		buf.Reset()
+		config.SetQuality(float32(mid))
+		if err := encodeRGBA(&buf, img, &config, nil, &stats); err != nil {
+			return 0, nil, err
+		}
+
+		if buf.Len() <= size {
+			quality, lo = mid, mid+1
+			best.Reset()
+			best.Write(buf.Bytes())
+			bestStats = stats
+		} else {
+			hi = mid - 1
+		}
+	}
+	if quality < 0 {
+		return 0, nil, errTargetSizeUnreachable
+	}
+
+	if _, err := w.Write(best.Bytes()); err != nil {
+		return 0, nil, err
+	}
+	return float32(quality), &bestStats, nil
+}
+
+// QualityTarget specifies the quality which EncodeToQuality must achieve.
+type QualityTarget struct {
+	Metric Metric  // Metric to measure the distortion of encoded image
+	Min    float32 // Minimum score of all channels in dB
+}
+
+// EncodeToQuality encodes image.Image into lossy WebP with the lowest quality
+// factor whose distortion against the original image meets the target, and
+// writes it into the writer. The quality factor is searched by bisection, and
+// the other parameters are taken from base except the target size and PSNR,
+// which would override the quality factor. It returns the chosen quality
+// factor and the statistics of the written WebP.
+//
+// The distortion is measured on colors with premultiplied alpha, so that the
+// colors of fully transparent pixels are ignored.
+func EncodeToQuality(w io.Writer, img image.Image, base *Config, target QualityTarget) (float32, *EncodeStats, error) {
+	if base == nil {
+		return 0, nil, errNilConfig
+	}
+	if base.Lossless() {
+		return 0, nil, errLosslessQualitySearch
+	}
+
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Rect, img, b.Min, draw.Src)
+	ref, err := newPremultipliedPicture(rgba)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer ref.Close()
+
+	config := *base
+	config.SetTargetSize(0)
+	config.SetTargetPSNR(0)
+	var stats EncodeStats
+
+	var buf, best bytes.Buffer
+	var bestStats EncodeStats
+	quality := -1
+	for lo, hi := 0, 100; lo <= hi; {
+		mid := (lo + hi) / 2
+		buf.Reset()
+		config.SetQuality(float32(mid))
+		if err := encodeRGBA(&buf, img, &config, nil, &stats); err != nil {
+			return 0, nil, err
+		}
+
+		score, err := encodedDistortion(ref, buf.Bytes(), target.Metric)
+		if err != nil {
+			return 0, nil, err
+		}
+		if score >= target.Min {
+			quality, hi = mid, mid-1
+			best.Reset()
+			best.Write(buf.Bytes())
+			bestStats = stats
+		} else {
+			lo = mid + 1
+		}
+	}
+	if quality < 0 {
+		return 0, nil, errTargetQualityUnreachable
+	}
+
+	if _, err := w.Write(best.Bytes()); err != nil {
+		return 0, nil, err
+	}
+	return float32(quality), &bestStats, nil
+}
+
+// encodedDistortion decodes the WebP data and returns its distortion of all
+// channels against the reference picture of premultiplied colors.
+func encodedDistortion(ref *Picture, data []byte, metric Metric) (float32, error) {
+	decoded, err := DecodeRGBA(data, &DecoderOptions{})
+	if err != nil {
+		return 0, err
+	}
+	candidate, err := newPremultipliedPicture(decoded)
+	if err != nil {
+		return 0, err
+	}
+	defer candidate.Close()
+
+	result, err := PictureDistortion(ref, candidate, metric)
+	if err != nil {
+		return 0, err
+	}
+	return result[4], nil
+}
+
+// newPremultipliedPicture creates a Picture whose ARGB pixels are the
+// premultiplied colors of image.RGBA as they are, so that the colors of
+// transparent pixels do not affect distortion.
+func newPremultipliedPicture(img *image.RGBA) (*Picture, error) {
+	return NewPicture(&image.NRGBA{Pix: img.Pix, Stride: img.Stride, Rect: img.Rect})
+}
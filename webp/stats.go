@@ -0,0 +1,38 @@
+package webp
+
+// LosslessFeatures represents the transforms used in lossless encoding.
+type LosslessFeatures uint32
+
+const (
+	LosslessPredictor     LosslessFeatures = 1 << 0 // Predictor transform
+	LosslessCrossColor    LosslessFeatures = 1 << 1 // Cross-color transform
+	LosslessSubtractGreen LosslessFeatures = 1 << 2 // Subtract-green transform
+	LosslessColorIndexing LosslessFeatures = 1 << 3 // Color indexing transform
+)
+
+// EncodeStats represents statistics of encoding, which corresponds to
+// C.WebPAuxStats. It is returned by each call of the encoding functions
+// with statistics, such as EncodeRGBAWithStats.
+type EncodeStats struct {
+	CodedSize int // Final size
+
+	PSNR          [5]float32 // Peak-signal-to-noise ratio for Y, U, V, all and alpha
+	BlockCount    [3]int     // Number of intra4, intra16 and skipped macroblocks
+	HeaderBytes   [2]int     // Approximate number of bytes spent for header and mode-partition #0
+	ResidualBytes [3][4]int  // Approximate number of bytes spent for DC, AC and UV coefficients for each segment
+	SegmentSize   [4]int     // Number of macroblocks in each segment
+	SegmentQuant  [4]int     // Quantizer values for each segment
+	SegmentLevel  [4]int     // Filtering strength for each segment [0..63]
+
+	AlphaDataSize int // Size of the transparency data
+	LayerDataSize int // Size of the enhancement layer data
+
+	LosslessFeatures   LosslessFeatures // Transforms used in lossless encoding
+	HistogramBits      int              // Number of precision bits of histogram
+	TransformBits      int              // Precision bits for transform
+	CacheBits          int              // Number of bits for color cache lookup
+	PaletteSize        int              // Number of colors in palette, if used
+	LosslessSize       int              // Final lossless size
+	LosslessHeaderSize int              // Lossless header (transform, Huffman etc) size
+	LosslessDataSize   int              // Lossless image data size
+}
@@ -1,15 +1,25 @@
+//go:build cgo
+
 package webp_test
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"image"
 	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"io"
 	"os"
 	"reflect"
+	"slices"
 	"testing"
+	"time"
 
+	"github.com/pixiv/go-libwebp/mux"
 	"github.com/pixiv/go-libwebp/test/util"
 	"github.com/pixiv/go-libwebp/webp"
 )
@@ -45,6 +55,14 @@ func TestGetInfo(t *testing.T) {
 	if height != 768 {
 		t.Errorf("Expected height: %d, but got %d", 768, height)
 	}
+
+	width, height, err := webp.GetInfoWithError(data)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if width != 1024 || height != 768 {
+		t.Errorf("Expected size: %dx%d, but got %dx%d", 1024, 768, width, height)
+	}
 }
 
 func TestGetFeatures(t *testing.T) {
@@ -71,182 +89,2171 @@ func TestGetFeatures(t *testing.T) {
 	}
 }
 
-func TestDecodeYUV(t *testing.T) {
-	files := []string{
-		"cosmos.webp",
-		"butterfly.webp",
-		"kinkaku.webp",
-		"yellow-rose-3.webp",
+func TestDecodeWithEmptyData(t *testing.T) {
+	for _, data := range [][]byte{nil, {}} {
+		if _, _, err := webp.GetInfoWithError(data); !errors.Is(err, webp.ErrNotEnoughData) {
+			t.Errorf("GetInfoWithError: Expected %v, but got %v", webp.ErrNotEnoughData, err)
+		}
+		if _, err := webp.GetFeatures(data); !errors.Is(err, webp.ErrNotEnoughData) {
+			t.Errorf("GetFeatures: Expected %v, but got %v", webp.ErrNotEnoughData, err)
+		}
+		if _, err := webp.DecodeRGBA(data, &webp.DecoderOptions{}); !errors.Is(err, webp.ErrNotEnoughData) {
+			t.Errorf("DecodeRGBA: Expected %v, but got %v", webp.ErrNotEnoughData, err)
+		}
+		if _, err := webp.DecodeNRGBA(data, &webp.DecoderOptions{}); !errors.Is(err, webp.ErrNotEnoughData) {
+			t.Errorf("DecodeNRGBA: Expected %v, but got %v", webp.ErrNotEnoughData, err)
+		}
+		if _, err := webp.DecodeYUVA(data, &webp.DecoderOptions{}); !errors.Is(err, webp.ErrNotEnoughData) {
+			t.Errorf("DecodeYUVA: Expected %v, but got %v", webp.ErrNotEnoughData, err)
+		}
+		if err := webp.DecodeInto(data, image.NewNRGBA(image.Rect(0, 0, 1, 1)), &webp.DecoderOptions{}); !errors.Is(err, webp.ErrNotEnoughData) {
+			t.Errorf("DecodeInto: Expected %v, but got %v", webp.ErrNotEnoughData, err)
+		}
+	}
+}
+
+func TestGetInfoWithInvalidData(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	if _, _, err := webp.GetInfoWithError(data[:20]); !errors.Is(err, webp.ErrNotEnoughData) {
+		t.Errorf("Expected %v, but got %v", webp.ErrNotEnoughData, err)
+	}
+	if _, _, err := webp.GetInfoWithError([]byte("RIFF\x00\x00\x00\x00WEBPVP8 \x00\x00\x00\x00")); !errors.Is(err, webp.ErrBitstream) {
+		t.Errorf("Expected %v, but got %v", webp.ErrBitstream, err)
+	}
+	for _, invalid := range [][]byte{nil, data[:20]} {
+		if width, height := webp.GetInfo(invalid); width != 0 || height != 0 {
+			t.Errorf("Expected zero size, but got %dx%d", width, height)
+		}
+	}
+}
+
+func TestDecodeWithLimits(t *testing.T) {
+	data := util.ReadFile("cosmos.webp") // 1024x768
+
+	tests := []struct {
+		limits  webp.Limits
+		options webp.DecoderOptions
+		limit   string
+	}{
+		{webp.Limits{MaxWidth: 1024, MaxHeight: 768, MaxPixels: 1024 * 768, MaxInputBytes: len(data)}, webp.DecoderOptions{}, ""},
+		{webp.Limits{MaxWidth: 1023}, webp.DecoderOptions{}, "MaxWidth"},
+		{webp.Limits{MaxHeight: 767}, webp.DecoderOptions{}, "MaxHeight"},
+		{webp.Limits{MaxPixels: 1024*768 - 1}, webp.DecoderOptions{}, "MaxPixels"},
+		{webp.Limits{MaxInputBytes: len(data) - 1}, webp.DecoderOptions{}, "MaxInputBytes"},
+		// Both of the bitstream and the output image are limited.
+		{webp.Limits{MaxPixels: 100 * 100}, webp.DecoderOptions{Crop: image.Rect(0, 0, 100, 100)}, "MaxPixels"},
+		{webp.Limits{MaxWidth: 1024}, webp.DecoderOptions{Scale: image.Rect(0, 0, 2048, 0)}, "MaxWidth"},
+	}
+
+	for _, tt := range tests {
+		options := tt.options
+		options.Limits = tt.limits
+		_, err := webp.DecodeNRGBA(data, &options)
+
+		var limitErr *webp.LimitError
+		if tt.limit == "" {
+			if err != nil {
+				t.Errorf("%+v: Got Error: %v", tt.limits, err)
+			}
+		} else if !errors.As(err, &limitErr) || limitErr.Limit != tt.limit {
+			t.Errorf("%+v: Expected LimitError of %v, but got %v", tt.limits, tt.limit, err)
+		}
+	}
+}
+
+func TestDecodeYUV(t *testing.T) {
+	files := []string{
+		"cosmos.webp",
+		"butterfly.webp",
+		"kinkaku.webp",
+		"yellow-rose-3.webp",
+	}
+
+	for _, file := range files {
+		data := util.ReadFile(file)
+		options := &webp.DecoderOptions{}
+
+		_, err := webp.DecodeYUVA(data, options)
+		if err != nil {
+			t.Errorf("Got Error: %v", err)
+			return
+		}
+	}
+}
+
+func TestDecodeRGBA(t *testing.T) {
+	files := []string{
+		"cosmos.webp",
+		"butterfly.webp",
+		"kinkaku.webp",
+		"yellow-rose-3.webp",
+	}
+
+	for _, file := range files {
+		data := util.ReadFile(file)
+		options := &webp.DecoderOptions{}
+
+		_, err := webp.DecodeRGBA(data, options)
+		if err != nil {
+			t.Errorf("Got Error: %v", err)
+			return
+		}
+	}
+}
+
+func TestDecodeNRGBA(t *testing.T) {
+	files := []string{
+		"cosmos.webp",
+		"butterfly.webp",
+		"kinkaku.webp",
+		"yellow-rose-3.webp",
+	}
+
+	for _, file := range files {
+		data := util.ReadFile(file)
+		options := &webp.DecoderOptions{}
+
+		_, err := webp.DecodeNRGBA(data, options)
+		if err != nil {
+			t.Errorf("Got Error: %v", err)
+			return
+		}
+	}
+}
+
+func TestDecodeRGBAWithCropping(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	crop := image.Rect(100, 100, 300, 200)
+
+	options := &webp.DecoderOptions{
+		Crop: crop,
+	}
+
+	img, err := webp.DecodeRGBA(data, options)
+	if err != nil {
+		t.Errorf("Got Error: %v", err)
+		return
+	}
+	if img.Rect.Dx() != crop.Dx() || img.Rect.Dy() != crop.Dy() {
+		t.Errorf("Decoded image should cropped to %v, but got %v", crop, img.Rect)
+	}
+}
+
+func TestDecodeRGBAWithScaling(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	scale := image.Rect(0, 0, 640, 480)
+
+	options := &webp.DecoderOptions{
+		Scale: scale,
+	}
+
+	img, err := webp.DecodeRGBA(data, options)
+	if err != nil {
+		t.Errorf("Got Error: %v", err)
+		return
+	}
+	if img.Rect.Dx() != scale.Dx() || img.Rect.Dy() != scale.Dy() {
+		t.Errorf("Decoded image should scaled to %v, but got %v", scale, img.Rect)
+	}
+}
+
+func TestDecodeRGBAWithCroppingAndScaling(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	tests := []struct {
+		crop   image.Rectangle
+		scale  image.Rectangle
+		expect image.Rectangle
+	}{
+		{image.Rect(100, 100, 300, 200), image.Rect(0, 0, 100, 50), image.Rect(0, 0, 100, 50)},
+		{image.Rect(100, 100, 300, 200), image.Rect(0, 0, 50, 0), image.Rect(0, 0, 50, 25)},
+		{image.Rect(100, 100, 300, 200), image.Rect(0, 0, 0, 100), image.Rect(0, 0, 200, 100)},
+		{image.Rectangle{}, image.Rect(0, 0, 512, 0), image.Rect(0, 0, 512, 384)},
+	}
+
+	for _, tt := range tests {
+		options := &webp.DecoderOptions{
+			Crop:  tt.crop,
+			Scale: tt.scale,
+		}
+
+		img, err := webp.DecodeRGBA(data, options)
+		if err != nil {
+			t.Errorf("Got Error: %v", err)
+			continue
+		}
+		if img.Rect != tt.expect {
+			t.Errorf("Decoded image with crop %v and scale %v should be %v, but got %v", tt.crop, tt.scale, tt.expect, img.Rect)
+		}
+	}
+}
+
+func TestDecodeNRGBAWithFlip(t *testing.T) {
+	data := util.ReadFile("yellow-rose-3.webp")
+
+	expect, err := webp.DecodeNRGBA(data, &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	img, err := webp.DecodeNRGBA(data, &webp.DecoderOptions{Flip: true})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	height := expect.Rect.Dy()
+	for y := 0; y < height; y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+4*img.Rect.Dx()]
+		flipped := expect.Pix[(height-1-y)*expect.Stride : (height-1-y)*expect.Stride+4*expect.Rect.Dx()]
+		if !bytes.Equal(row, flipped) {
+			t.Fatalf("Row %d of flipped image should be equal to row %d of the original image", y, height-1-y)
+		}
+	}
+}
+
+func TestDecodeWithAlphaDithering(t *testing.T) {
+	data := util.ReadFile("yellow-rose-3.webp")
+
+	options := &webp.DecoderOptions{
+		DitheringStrength:      50,
+		AlphaDitheringStrength: 100,
+	}
+	if _, err := webp.DecodeNRGBA(data, options); err != nil {
+		t.Errorf("Got Error: %v", err)
+	}
+}
+
+func TestDecodeWithNilOptions(t *testing.T) {
+	data := util.ReadFile("yellow-rose-3.webp")
+	expect, err := webp.DecodeNRGBA(data, &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	img, err := webp.DecodeNRGBA(data, nil)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if img.Rect != expect.Rect || !bytes.Equal(img.Pix, expect.Pix) {
+		t.Errorf("Decoded image with nil options is different from the one with zero options")
+	}
+
+	if _, err := webp.DecodeRGBA(data, nil); err != nil {
+		t.Errorf("DecodeRGBA: Got Error: %v", err)
+	}
+	if _, err := webp.DecodeRGB(data, nil); err != nil {
+		t.Errorf("DecodeRGB: Got Error: %v", err)
+	}
+	if _, err := webp.DecodeYUVA(data, nil); err != nil {
+		t.Errorf("DecodeYUVA: Got Error: %v", err)
+	}
+	if _, err := webp.DecodePacked(data, webp.ModeBGRA, nil); err != nil {
+		t.Errorf("DecodePacked: Got Error: %v", err)
+	}
+	if _, err := webp.DecodeTo(data, webp.ModeYUV, nil); err != nil {
+		t.Errorf("DecodeTo: Got Error: %v", err)
+	}
+	if err := webp.DecodeInto(data, image.NewNRGBA(expect.Rect), nil); err != nil {
+		t.Errorf("DecodeInto: Got Error: %v", err)
+	}
+
+	dec, err := webp.NewIncrementalDecoder(nil)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	defer dec.Close()
+	if err := dec.Append(data); err != nil {
+		t.Errorf("IncrementalDecoder: Got Error: %v", err)
+	}
+}
+
+func TestDecodeWithInvalidOptions(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	tests := []struct {
+		option  string
+		options webp.DecoderOptions
+	}{
+		{"Crop", webp.DecoderOptions{Crop: image.Rect(-10, 0, 100, 100)}},
+		{"Crop", webp.DecoderOptions{Crop: image.Rect(10, 10, 10, 100)}},
+		{"Crop", webp.DecoderOptions{Crop: image.Rect(1000, 0, 1100, 100)}},
+		{"Scale", webp.DecoderOptions{Scale: image.Rect(10, 10, 10, 10)}},
+		{"DitheringStrength", webp.DecoderOptions{DitheringStrength: 101}},
+		{"AlphaDitheringStrength", webp.DecoderOptions{AlphaDitheringStrength: -1}},
+	}
+
+	for _, tt := range tests {
+		_, err := webp.DecodeRGBA(data, &tt.options)
+		var optionErr *webp.OptionError
+		if !errors.As(err, &optionErr) {
+			t.Errorf("Expected *webp.OptionError for %+v, but got %v", tt.options, err)
+			continue
+		}
+		if optionErr.Option != tt.option {
+			t.Errorf("Expected invalid option %s, but got %s", tt.option, optionErr.Option)
+		}
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	data := util.ReadFile("yellow-rose-3.webp")
+	expect, err := webp.DecodeNRGBA(data, &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	rect := expect.Rect.Add(image.Pt(3, 5))
+
+	// Decode into a sub-image of the larger image.
+	canvas := image.NewNRGBA(image.Rect(0, 0, rect.Max.X+7, rect.Max.Y+2))
+	nrgba := canvas.SubImage(rect).(*image.NRGBA)
+	if err := webp.DecodeInto(data, nrgba, &webp.DecoderOptions{}); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	for y := 0; y < expect.Rect.Dy(); y++ {
+		for x := 0; x < expect.Rect.Dx(); x++ {
+			if c, e := nrgba.NRGBAAt(rect.Min.X+x, rect.Min.Y+y), expect.NRGBAAt(x, y); c != e {
+				t.Fatalf("Expected %v at (%d, %d), but got %v", e, x, y, c)
+			}
+		}
+	}
+	if c := canvas.NRGBAAt(0, 0); c != (color.NRGBA{}) {
+		t.Errorf("Pixels outside of the sub-image should not be modified, but got %v", c)
+	}
+
+	// Decode into RGBImage with padded stride.
+	rgb := &webp.RGBImage{
+		Pix:    make([]uint8, (3*rect.Dx()+5)*rect.Dy()),
+		Stride: 3*rect.Dx() + 5,
+		Rect:   rect,
+	}
+	if err := webp.DecodeInto(data, rgb, &webp.DecoderOptions{}); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	for y := 0; y < expect.Rect.Dy(); y++ {
+		for x := 0; x < expect.Rect.Dx(); x++ {
+			c, e := rgb.RGBAAt(rect.Min.X+x, rect.Min.Y+y), expect.NRGBAAt(x, y)
+			if c.R != e.R || c.G != e.G || c.B != e.B {
+				t.Fatalf("Expected %v at (%d, %d), but got %v", e, x, y, c)
+			}
+		}
+	}
+
+	// Decode into RGBA.
+	rgba := image.NewRGBA(expect.Rect)
+	if err := webp.DecodeInto(data, rgba, &webp.DecoderOptions{}); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	expectRGBA, err := webp.DecodeRGBA(data, &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if !bytes.Equal(rgba.Pix, expectRGBA.Pix) {
+		t.Errorf("Decoded RGBA image should be equal to the result of DecodeRGBA")
+	}
+}
+
+func TestDecodeIntoYUVA(t *testing.T) {
+	data := util.ReadFile("yellow-rose-3.webp")
+	expect, err := webp.DecodeYUVA(data, &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	// Decode into planes with padded strides.
+	w, h := expect.Rect.Dx(), expect.Rect.Dy()
+	cw, ch := (w+1)/2, (h+1)/2
+	img := &webp.YUVAImage{
+		Y:          make([]uint8, (w+8)*h),
+		Cb:         make([]uint8, (cw+4)*ch),
+		Cr:         make([]uint8, (cw+4)*ch),
+		A:          make([]uint8, (w+8)*h),
+		YStride:    w + 8,
+		CStride:    cw + 4,
+		AStride:    w + 8,
+		ColorSpace: webp.YUV420A,
+		Rect:       expect.Rect,
+	}
+	if err := webp.DecodeInto(data, img, &webp.DecoderOptions{}); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	for y := 0; y < h; y++ {
+		if !bytes.Equal(img.Y[y*img.YStride:y*img.YStride+w], expect.Y[y*expect.YStride:y*expect.YStride+w]) {
+			t.Fatalf("Y plane is different at row %d", y)
+		}
+		if !bytes.Equal(img.A[y*img.AStride:y*img.AStride+w], expect.A[y*expect.AStride:y*expect.AStride+w]) {
+			t.Fatalf("A plane is different at row %d", y)
+		}
+	}
+	for y := 0; y < ch; y++ {
+		if !bytes.Equal(img.Cb[y*img.CStride:y*img.CStride+cw], expect.Cb[y*expect.CStride:y*expect.CStride+cw]) {
+			t.Fatalf("Cb plane is different at row %d", y)
+		}
+		if !bytes.Equal(img.Cr[y*img.CStride:y*img.CStride+cw], expect.Cr[y*expect.CStride:y*expect.CStride+cw]) {
+			t.Fatalf("Cr plane is different at row %d", y)
+		}
+	}
+}
+
+func TestDecodeIntoWithInvalidDestination(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+
+	if err := webp.DecodeInto(data, image.NewNRGBA(image.Rect(0, 0, 100, 100)), &webp.DecoderOptions{}); err == nil {
+		t.Errorf("Expected error for size mismatch")
+	}
+	if err := webp.DecodeInto(data, image.NewGray(image.Rect(0, 0, 1024, 768)), &webp.DecoderOptions{}); err == nil {
+		t.Errorf("Expected error for unsupported image type")
+	}
+
+	// Decode into the image with the size of the cropped area.
+	options := &webp.DecoderOptions{Crop: image.Rect(10, 10, 110, 60)}
+	if err := webp.DecodeInto(data, image.NewNRGBA(image.Rect(0, 0, 100, 50)), options); err != nil {
+		t.Errorf("Got Error: %v", err)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	short := image.NewNRGBA(image.Rect(0, 0, 1024, 768))
+	short.Pix = short.Pix[:len(short.Pix)-1]
+	canvas := webp.NewYUVAImage(image.Rect(0, 0, 1025, 769), webp.YUV420)
+
+	tests := []struct {
+		name   string
+		decode func() error
+		stage  webp.DecodeStage
+		status webp.Status
+		err    error
+	}{
+		{"invalid header", func() error {
+			_, err := webp.DecodeNRGBA([]byte("RIFF\x00\x00\x00\x00WEBPVP8 \x00\x00\x00\x00"), &webp.DecoderOptions{})
+			return err
+		}, webp.DecodeStageFeatures, webp.StatusBitstreamError, webp.ErrBitstream},
+		{"truncated", func() error {
+			_, err := webp.DecodeNRGBA(data[:len(data)/2], &webp.DecoderOptions{})
+			return err
+		}, webp.DecodeStageDecode, webp.StatusNotEnoughData, webp.ErrNotEnoughData},
+		{"size mismatch", func() error {
+			return webp.DecodeInto(data, image.NewNRGBA(image.Rect(0, 0, 100, 100)), &webp.DecoderOptions{})
+		}, webp.DecodeStageBufferCheck, webp.StatusInvalidParam, webp.ErrInvalidParam},
+		{"short buffer", func() error {
+			return webp.DecodeInto(data, short, &webp.DecoderOptions{})
+		}, webp.DecodeStageBufferCheck, webp.StatusInvalidParam, webp.ErrInvalidParam},
+		{"odd YUVA origin x", func() error {
+			return webp.DecodeInto(data, canvas.SubImage(image.Rect(1, 0, 1025, 768)), &webp.DecoderOptions{})
+		}, webp.DecodeStageBufferCheck, webp.StatusInvalidParam, webp.ErrInvalidParam},
+		{"odd YUVA origin y", func() error {
+			return webp.DecodeInto(data, canvas.SubImage(image.Rect(0, 1, 1024, 769)), &webp.DecoderOptions{})
+		}, webp.DecodeStageBufferCheck, webp.StatusInvalidParam, webp.ErrInvalidParam},
+	}
+
+	for _, tt := range tests {
+		err := tt.decode()
+		var decodeErr *webp.DecodeError
+		if !errors.As(err, &decodeErr) {
+			t.Errorf("%v: Expected DecodeError, but got %v", tt.name, err)
+			continue
+		}
+		if decodeErr.Stage != tt.stage || decodeErr.Status != tt.status {
+			t.Errorf("%v: Expected stage %v and status %v, but got %v and %v", tt.name, tt.stage, tt.status, decodeErr.Stage, decodeErr.Status)
+		}
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%v: Expected %v to be matched, but got %v", tt.name, tt.err, err)
+		}
+	}
+}
+
+func TestDecodeWithPoolAllocator(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	allocator := &webp.PoolAllocator{}
+	options := &webp.DecoderOptions{Allocator: allocator}
+
+	expect, err := webp.DecodeRGBA(data, &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		img, err := webp.DecodeRGBA(data, options)
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+		if !bytes.Equal(img.Pix, expect.Pix) {
+			t.Errorf("Image decoded with pooled buffer should be equal to the expected image")
+		}
+		allocator.Release(img)
+	}
+
+	yuva, err := webp.DecodeYUVA(data, options)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if yuva.Rect != expect.Rect {
+		t.Errorf("Expected bounds %v, but got %v", expect.Rect, yuva.Rect)
+	}
+	allocator.Release(yuva)
+}
+
+func TestDecodeTo(t *testing.T) {
+	data := util.ReadFile("yellow-rose-3.webp")
+	nrgba, err := webp.DecodeNRGBA(data, &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	rgba, err := webp.DecodeRGBA(data, &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	tests := []struct {
+		mode      webp.ColorMode
+		tolerance uint32
+	}{
+		{webp.ModeRGB, 0},
+		{webp.ModeRGBA, 0},
+		{webp.ModeBGR, 0},
+		{webp.ModeBGRA, 0},
+		{webp.ModeARGB, 0},
+		{webp.ModeRGBA4444, 0},
+		{webp.ModeRGB565, 0},
+		{webp.ModePremultipliedRGBA, 0},
+		{webp.ModePremultipliedBGRA, 0},
+		{webp.ModePremultipliedARGB, 0},
+		{webp.ModePremultipliedRGBA4444, 0x11},
+	}
+
+	for _, tt := range tests {
+		img, err := webp.DecodeTo(data, tt.mode, &webp.DecoderOptions{})
+		if err != nil {
+			t.Errorf("Got Error: %v", err)
+			continue
+		}
+		if img.Bounds() != nrgba.Rect {
+			t.Errorf("Expected bounds of mode %d: %v, but got %v", tt.mode, nrgba.Rect, img.Bounds())
+			continue
+		}
+
+	loop:
+		for y := nrgba.Rect.Min.Y; y < nrgba.Rect.Max.Y; y++ {
+			for x := nrgba.Rect.Min.X; x < nrgba.Rect.Max.X; x++ {
+				var ref color.Color
+				switch {
+				case tt.mode.IsPremultiplied():
+					ref = rgba.At(x, y)
+				case tt.mode.HasAlpha():
+					ref = nrgba.At(x, y)
+				default:
+					c := nrgba.NRGBAAt(x, y)
+					c.A = 0xff
+					ref = c
+				}
+				expect := img.ColorModel().Convert(ref)
+				if got := img.At(x, y); !colorsClose(got, expect, tt.tolerance) {
+					t.Errorf("Expected color of mode %d at (%d, %d): %v, but got %v", tt.mode, x, y, expect, got)
+					break loop
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeToYUV(t *testing.T) {
+	data := util.ReadFile("yellow-rose-3.webp")
+	tests := []struct {
+		mode       webp.ColorMode
+		colorSpace webp.ColorSpace
+	}{
+		{webp.ModeYUV, webp.YUV420},
+		{webp.ModeYUVA, webp.YUV420A},
+	}
+
+	for _, tt := range tests {
+		img, err := webp.DecodeTo(data, tt.mode, &webp.DecoderOptions{})
+		if err != nil {
+			t.Errorf("Got Error: %v", err)
+			continue
+		}
+		yuva, ok := img.(*webp.YUVAImage)
+		if !ok {
+			t.Errorf("Expected *webp.YUVAImage for mode %d, but got %T", tt.mode, img)
+			continue
+		}
+		if yuva.ColorSpace != tt.colorSpace {
+			t.Errorf("Expected color space of mode %d: %v, but got %v", tt.mode, tt.colorSpace, yuva.ColorSpace)
+		}
+	}
+
+	// YUV colors are converted into RGB colors in the same way as libwebp.
+	data = util.ReadFile("cosmos.webp")
+	options := &webp.DecoderOptions{NoFancyUpsampling: true}
+	yuva, err := webp.DecodeYUVA(data, options)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	nrgba, err := webp.DecodeNRGBA(data, options)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	for _, p := range []image.Point{{0, 0}, {101, 57}, {1023, 767}} {
+		if got, expect := yuva.At(p.X, p.Y), nrgba.At(p.X, p.Y); got != expect {
+			t.Errorf("Expected color at %v: %v, but got %v", p, expect, got)
+		}
+	}
+}
+
+func TestDecodeRGB(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	img, err := webp.DecodeRGB(data, &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	expect, err := webp.DecodeRGBA(data, &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if img.Rect != expect.Rect {
+		t.Fatalf("Expected bounds: %v, but got %v", expect.Rect, img.Rect)
+	}
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			if got, e := img.RGBAAt(x, y), expect.RGBAAt(x, y); got != e {
+				t.Fatalf("Expected color at (%d, %d): %v, but got %v", x, y, e, got)
+			}
+		}
+	}
+}
+
+func TestDecodePackedWithInvalidMode(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	for _, mode := range []webp.ColorMode{webp.ModeYUV, webp.ModeYUVA, -1, 13} {
+		if _, err := webp.DecodePacked(data, mode, &webp.DecoderOptions{}); err == nil {
+			t.Errorf("Expected error for mode %d", mode)
+		}
+	}
+	if img, err := webp.DecodeTo(data, 13, &webp.DecoderOptions{}); err == nil || img != nil {
+		t.Errorf("Expected error and nil image for unknown mode, but got %v, %v", img, err)
+	}
+}
+
+func colorsClose(c1, c2 color.Color, tolerance uint32) bool {
+	r1, g1, b1, a1 := c1.RGBA()
+	r2, g2, b2, a2 := c2.RGBA()
+	diff := func(x, y uint32) uint32 {
+		if x > y {
+			return x - y
+		}
+		return y - x
+	}
+	tolerance *= 0x101
+	return diff(r1, r2) <= tolerance && diff(g1, g2) <= tolerance && diff(b1, b2) <= tolerance && diff(a1, a2) <= tolerance
+}
+
+func TestImageDecode(t *testing.T) {
+	files := []string{
+		"cosmos.webp",
+		"butterfly.webp",
+		"kinkaku.webp",
+		"yellow-rose-3.webp",
+	}
+
+	for _, file := range files {
+		img, format, err := image.Decode(util.OpenFile(file))
+		if err != nil {
+			t.Errorf("Got Error: %v", err)
+			continue
+		}
+		if format != "webp" {
+			t.Errorf("Expected format: %v, but got %v", "webp", format)
+		}
+
+		f, err := webp.GetFeatures(util.ReadFile(file))
+		if err != nil {
+			t.Errorf("Got Error: %v", err)
+			continue
+		}
+		if got := img.Bounds(); got != image.Rect(0, 0, f.Width, f.Height) {
+			t.Errorf("Expected bounds: %v, but got %v", image.Rect(0, 0, f.Width, f.Height), got)
+		}
+		var expected reflect.Type
+		switch {
+		case f.HasAlpha:
+			expected = reflect.TypeOf(&image.NRGBA{})
+		case f.Format == 1:
+			expected = reflect.TypeOf(&webp.YUVAImage{})
+		default:
+			expected = reflect.TypeOf(&image.RGBA{})
+		}
+		if got := reflect.TypeOf(img); got != expected {
+			t.Errorf("Expected %v for %v, but got %v", expected, file, got)
+		}
+	}
+}
+
+func TestImageDecodeConfig(t *testing.T) {
+	config, format, err := image.DecodeConfig(util.OpenFile("cosmos.webp"))
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if format != "webp" {
+		t.Errorf("Expected format: %v, but got %v", "webp", format)
+	}
+	if config.Width != 1024 || config.Height != 768 {
+		t.Errorf("Expected size: %dx%d, but got %dx%d", 1024, 768, config.Width, config.Height)
+	}
+	// cosmos.webp is lossy, which is decoded into YUVAImage.
+	if config.ColorModel != color.NRGBAModel {
+		t.Errorf("Expected color model: %v, but got %v", color.NRGBAModel, config.ColorModel)
+	}
+}
+
+func TestImageDecodeConfigWithTruncatedData(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	if _, err := webp.DecodeConfig(bytes.NewReader(data[:16])); err == nil {
+		t.Errorf("Expected error for truncated data")
+	}
+}
+
+func TestIncrementalDecoder(t *testing.T) {
+	files := []string{
+		"cosmos.webp",
+		"butterfly.webp",
+		"kinkaku.webp",
+		"yellow-rose-3.webp",
+	}
+
+	for _, file := range files {
+		data := util.ReadFile(file)
+		expect, err := webp.DecodeNRGBA(data, &webp.DecoderOptions{})
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+
+		dec, err := webp.NewIncrementalDecoder(&webp.DecoderOptions{})
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+		defer dec.Close()
+
+		lastRows := 0
+		for i := 0; i < len(data); i += 4096 {
+			if err := dec.Append(data[i:min(i+4096, len(data))]); err != nil {
+				t.Fatalf("Got Error: %v", err)
+			}
+			if _, rows := dec.DecodedNRGBA(); rows < lastRows {
+				t.Errorf("Decoded rows should not decrease, got %d after %d", rows, lastRows)
+			} else {
+				lastRows = rows
+			}
+		}
+		if !dec.Done() {
+			t.Errorf("Expected %v to be completely decoded", file)
+		}
+
+		img, rows := dec.DecodedNRGBA()
+		if rows != expect.Rect.Dy() {
+			t.Errorf("Expected decoded rows: %d, but got %d", expect.Rect.Dy(), rows)
+		}
+		if !bytes.Equal(img.Pix, expect.Pix) {
+			t.Errorf("Incrementally decoded image differs from DecodeNRGBA for %v", file)
+		}
+	}
+}
+
+func TestIncrementalYUVADecoder(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+	expect, err := webp.DecodeYUVA(data, &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	dec, err := webp.NewIncrementalYUVADecoder(&webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	defer dec.Close()
+
+	if _, err := dec.ReadFrom(bytes.NewReader(data)); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	img, _ := dec.DecodedYUVA()
+	if !bytes.Equal(img.Y, expect.Y) || !bytes.Equal(img.Cb, expect.Cb) || !bytes.Equal(img.Cr, expect.Cr) {
+		t.Errorf("Incrementally decoded image differs from DecodeYUVA")
+	}
+}
+
+func TestIncrementalDecoderWithFlip(t *testing.T) {
+	data := util.ReadFile("yellow-rose-3.webp")
+	options := &webp.DecoderOptions{Flip: true}
+	expectNRGBA, err := webp.DecodeNRGBA(data, options)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	expectYUVA, err := webp.DecodeYUVA(data, options)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	dec, err := webp.NewIncrementalDecoder(options)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	defer dec.Close()
+	yuvaDec, err := webp.NewIncrementalYUVADecoder(options)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	defer yuvaDec.Close()
+
+	// The decoded rows of the partial data are the bottom rows.
+	for _, d := range []*webp.IncrementalDecoder{dec, yuvaDec} {
+		if err := d.Append(data[:len(data)/2]); err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+	}
+	img, rows := dec.DecodedNRGBA()
+	height := expectNRGBA.Rect.Dy()
+	if rows == 0 || rows >= height {
+		t.Fatalf("Expected partially decoded rows, but got %d", rows)
+	}
+	offset := (height - rows) * img.Stride
+	if !bytes.Equal(img.Pix[offset:], expectNRGBA.Pix[offset:]) {
+		t.Errorf("Partially decoded rows differ from DecodeNRGBA with Flip")
+	}
+	if slices.ContainsFunc(img.Pix[:offset], func(v uint8) bool { return v != 0 }) {
+		t.Errorf("Expected the rows above the decoded rows to be blank")
+	}
+	yuva, yuvaRows := yuvaDec.DecodedYUVA()
+	if yuvaRows == 0 || yuvaRows >= height {
+		t.Fatalf("Expected partially decoded rows, but got %d", yuvaRows)
+	}
+	if offset := (height - yuvaRows) * yuva.YStride; !bytes.Equal(yuva.Y[offset:], expectYUVA.Y[offset:]) {
+		t.Errorf("Partially decoded Y rows differ from DecodeYUVA with Flip")
+	}
+
+	for _, d := range []*webp.IncrementalDecoder{dec, yuvaDec} {
+		if err := d.Append(data[len(data)/2:]); err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+	}
+	if img, _ = dec.DecodedNRGBA(); !bytes.Equal(img.Pix, expectNRGBA.Pix) {
+		t.Errorf("Incrementally decoded image differs from DecodeNRGBA with Flip")
+	}
+	yuva, _ = yuvaDec.DecodedYUVA()
+	if !bytes.Equal(yuva.Y, expectYUVA.Y) || !bytes.Equal(yuva.Cb, expectYUVA.Cb) || !bytes.Equal(yuva.Cr, expectYUVA.Cr) || !bytes.Equal(yuva.A, expectYUVA.A) {
+		t.Errorf("Incrementally decoded image differs from DecodeYUVA with Flip")
+	}
+}
+
+func TestIncrementalDecoderWithLimits(t *testing.T) {
+	data := util.ReadFile("cosmos.webp") // 1024x768
+
+	tests := []struct {
+		limits webp.Limits
+		limit  string
+	}{
+		{webp.Limits{MaxWidth: 1024, MaxHeight: 768, MaxInputBytes: len(data)}, ""},
+		{webp.Limits{MaxPixels: 1024*768 - 1}, "MaxPixels"},
+		{webp.Limits{MaxInputBytes: len(data) - 1}, "MaxInputBytes"},
+	}
+
+	for _, tt := range tests {
+		dec, err := webp.NewIncrementalDecoder(&webp.DecoderOptions{Limits: tt.limits})
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+
+		// The header arrives byte by byte.
+		for i := 0; i < 64 && err == nil; i++ {
+			err = dec.Append(data[i : i+1])
+		}
+		if err == nil {
+			err = dec.Append(data[64:])
+		}
+		dec.Close()
+
+		var limitErr *webp.LimitError
+		if tt.limit == "" {
+			if err != nil {
+				t.Errorf("%+v: Got Error: %v", tt.limits, err)
+			}
+		} else if !errors.As(err, &limitErr) || limitErr.Limit != tt.limit {
+			t.Errorf("%+v: Expected LimitError of %v, but got %v", tt.limits, tt.limit, err)
+		}
+	}
+}
+
+func TestIncrementalDecoderWithTruncatedData(t *testing.T) {
+	data := util.ReadFile("cosmos.webp")
+
+	dec, err := webp.NewIncrementalDecoder(&webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	defer dec.Close()
+
+	if _, err := dec.ReadFrom(bytes.NewReader(data[:len(data)/2])); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected io.ErrUnexpectedEOF, but got %v", err)
+	}
+	if _, rows := dec.DecodedNRGBA(); rows == 0 {
+		t.Errorf("Expected some rows to be decoded from truncated data")
+	}
+}
+
+// cancelAfterContext is context.Context which is canceled after Err is called
+// n times, so that cancellation in the middle of processing is reproducible.
+type cancelAfterContext struct {
+	context.Context
+	done chan struct{}
+	n    int
+}
+
+func newCancelAfterContext(n int) *cancelAfterContext {
+	return &cancelAfterContext{Context: context.Background(), done: make(chan struct{}), n: n}
+}
+
+func (c *cancelAfterContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *cancelAfterContext) Err() error {
+	if c.n <= 0 {
+		return context.Canceled
+	}
+	c.n--
+	return nil
+}
+
+func TestDecodeToContext(t *testing.T) {
+	tests := []struct {
+		file    string
+		options *webp.DecoderOptions
+	}{
+		{"butterfly.webp", &webp.DecoderOptions{}},
+		{"yellow-rose-3.webp", &webp.DecoderOptions{}},
+		{"kinkaku.webp", &webp.DecoderOptions{Crop: image.Rect(100, 100, 500, 400), Scale: image.Rect(0, 0, 200, 0)}},
+	}
+
+	for _, tt := range tests {
+		data := util.ReadFile(tt.file)
+		expect, err := webp.DecodeNRGBA(data, tt.options)
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		img, err := webp.DecodeToContext(ctx, data, webp.ModeRGBA, tt.options)
+		cancel()
+		if err != nil {
+			t.Errorf("Got Error: %v", err)
+			continue
+		}
+		if got := img.(*image.NRGBA); got.Rect != expect.Rect || !bytes.Equal(got.Pix, expect.Pix) {
+			t.Errorf("Decoded image of %v is different from DecodeNRGBA", tt.file)
+		}
+	}
+}
+
+func TestDecodeIntoContextYUVA(t *testing.T) {
+	data := util.ReadFile("yellow-rose-3.webp")
+	expect, err := webp.DecodeYUVA(data, &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	img := webp.NewYUVAImage(expect.Rect, webp.YUV420A)
+	if err := webp.DecodeIntoContext(ctx, data, img, &webp.DecoderOptions{}); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if !bytes.Equal(img.Y, expect.Y) || !bytes.Equal(img.Cb, expect.Cb) || !bytes.Equal(img.Cr, expect.Cr) || !bytes.Equal(img.A, expect.A) {
+		t.Errorf("Decoded image is different from DecodeYUVA")
+	}
+}
+
+func TestDecodeToContextCanceled(t *testing.T) {
+	data := util.ReadFile("kinkaku.webp")
+
+	for _, n := range []int{0, 1, 3} {
+		if _, err := webp.DecodeToContext(newCancelAfterContext(n), data, webp.ModeRGBA, &webp.DecoderOptions{}); err != context.Canceled {
+			t.Errorf("Expected %v after %d checks, but got %v", context.Canceled, n, err)
+		}
+	}
+}
+
+func TestDecodeToContextWithTruncatedData(t *testing.T) {
+	data := util.ReadFile("butterfly.webp")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := webp.DecodeToContext(ctx, data[:len(data)/2], webp.ModeRGBA, &webp.DecoderOptions{}); err == nil {
+		t.Errorf("Expected error for truncated data")
+	}
+}
+
+//
+// Encoding
+//
+
+func TestEncodeRGBA(t *testing.T) {
+	img := util.ReadPNG("yellow-rose-3.png")
+	if _, ok := img.(*image.NRGBA); !ok {
+		t.Fatalf("image is not NRGBA: %v", reflect.TypeOf(img))
+	}
+
+	config, err := webp.ConfigPreset(webp.PresetDefault, 100)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	f := util.CreateFile("TestEncodeRGBA.webp")
+	w := bufio.NewWriter(f)
+	defer func() {
+		w.Flush()
+		f.Close()
+	}()
+
+	if err := webp.EncodeRGBA(w, img, config); err != nil {
+		t.Errorf("Got Error: %v", err)
+		return
+	}
+}
+
+func TestEncodeRGBAWithProgress(t *testing.T) {
+	img := util.ReadPNG("yellow-rose-3.png")
+	if _, ok := img.(*image.NRGBA); !ok {
+		t.Fatalf("image is not NRGBA: %v", reflect.TypeOf(img))
+	}
+
+	config, err := webp.ConfigPreset(webp.PresetDefault, 100)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	f := util.CreateFile("TestEncodeRGBAWithProgress.webp")
+	w := bufio.NewWriter(f)
+	defer func() {
+		w.Flush()
+		f.Close()
+	}()
+
+	if err := webp.EncodeRGBAWithProgress(w, img, config, func(i int) bool {
+		t.Logf("Progress: %v", i)
+		return true
+	}); err != nil {
+		t.Errorf("Got Error: %v", err)
+		return
+	}
+}
+
+func TestEncodeRGBAWithProgressCanceled(t *testing.T) {
+	img := util.ReadPNG("yellow-rose-3.png")
+	if _, ok := img.(*image.NRGBA); !ok {
+		t.Fatalf("image is not NRGBA: %v", reflect.TypeOf(img))
+	}
+
+	config, err := webp.ConfigPreset(webp.PresetDefault, 100)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	f := util.CreateFile("TestEncodeRGBAWithProgress.webp")
+	w := bufio.NewWriter(f)
+	defer func() {
+		w.Flush()
+		f.Close()
+	}()
+
+	var encodeErr *webp.EncodeError
+	if err := webp.EncodeRGBAWithProgress(w, img, config, func(i int) bool {
+		t.Logf("Progress: %v", i)
+		return false
+	}); !errors.As(err, &encodeErr) || encodeErr.EncodeErrorCode() != webp.EncodeErrorCodeVP8EncErrorUserAbort {
+		t.Errorf("Expected UserAbort (%v) but received: %v", webp.EncodeErrorCodeVP8EncErrorUserAbort, err)
+		return
+	}
+}
+
+type errorWriter struct {
+	err error
+}
+
+func (w errorWriter) Write(p []byte) (int, error) {
+	return 0, w.err
+}
+
+func TestEncodeWithWriterError(t *testing.T) {
+	config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	writeErr := errors.New("write failed")
+	w := errorWriter{writeErr}
+	tests := []struct {
+		name   string
+		encode func() error
+	}{
+		{"RGBA", func() error { return webp.EncodeRGBA(w, util.ReadPNG("yellow-rose-3.png"), config) }},
+		{"Gray", func() error { return webp.EncodeGray(w, image.NewGray(image.Rect(0, 0, 16, 16)), config) }},
+		{"YUVA", func() error {
+			return webp.EncodeYUVA(w, webp.NewYUVAImage(image.Rect(0, 0, 16, 16), webp.YUV420), config)
+		}},
+		{"YUVA sub-image", func() error {
+			img := webp.NewYUVAImage(image.Rect(0, 0, 16, 16), webp.YUV420)
+			return webp.EncodeYUVA(w, img.SubImage(image.Rect(1, 1, 16, 16)).(*webp.YUVAImage), config)
+		}},
+	}
+
+	for _, tt := range tests {
+		err := tt.encode()
+		var encodeErr *webp.EncodeError
+		if !errors.As(err, &encodeErr) || encodeErr.EncodeErrorCode() != webp.EncodeErrorCodeVP8EncErrorBadWrite {
+			t.Errorf("%v: Expected BadWrite (%v) but received: %v", tt.name, webp.EncodeErrorCodeVP8EncErrorBadWrite, err)
+		}
+		if !errors.Is(err, writeErr) {
+			t.Errorf("%v: Expected %v to be wrapped, but got %v", tt.name, writeErr, err)
+		}
+	}
+}
+
+func TestEncodeErrorString(t *testing.T) {
+	config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	err = webp.EncodeRGBA(errorWriter{io.ErrShortWrite}, util.ReadPNG("yellow-rose-3.png"), config)
+	if expect := "Encoding error: write error: short write"; err == nil || err.Error() != expect {
+		t.Errorf("Expected error message: %q, but got %v", expect, err)
+	}
+	if s := webp.EncodeErrorCodeVP8EncErrorUserAbort.String(); s != "aborted by user" {
+		t.Errorf("Expected name of UserAbort: %q, but got %q", "aborted by user", s)
+	}
+}
+
+func TestEncodeContext(t *testing.T) {
+	config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	img := util.ReadPNG("yellow-rose-3.png")
+	tests := []struct {
+		name   string
+		encode func(ctx context.Context) error
+	}{
+		{"RGBA", func(ctx context.Context) error { return webp.EncodeRGBAContext(ctx, io.Discard, img, config) }},
+		{"Gray", func(ctx context.Context) error {
+			return webp.EncodeGrayContext(ctx, io.Discard, image.NewGray(image.Rect(0, 0, 64, 64)), config)
+		}},
+		{"YUVA", func(ctx context.Context) error {
+			return webp.EncodeYUVAContext(ctx, io.Discard, webp.NewYUVAImage(image.Rect(0, 0, 64, 64), webp.YUV420), config)
+		}},
+		{"Picture", func(ctx context.Context) error {
+			p, err := webp.NewPicture(img)
+			if err != nil {
+				return err
+			}
+			defer p.Close()
+			return webp.EncodePictureContext(ctx, io.Discard, p, config)
+		}},
+	}
+
+	for _, tt := range tests {
+		ctx, cancel := context.WithCancel(context.Background())
+		if err := tt.encode(ctx); err != nil {
+			t.Errorf("%v: Got Error: %v", tt.name, err)
+		}
+		cancel()
+
+		for _, ctx := range []context.Context{ctx, newCancelAfterContext(2)} {
+			err := tt.encode(ctx)
+			var encodeErr *webp.EncodeError
+			if !errors.As(err, &encodeErr) || encodeErr.EncodeErrorCode() != webp.EncodeErrorCodeVP8EncErrorUserAbort {
+				t.Errorf("%v: Expected UserAbort (%v) but received: %v", tt.name, webp.EncodeErrorCodeVP8EncErrorUserAbort, err)
+			}
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("%v: Expected %v to be wrapped, but got %v", tt.name, context.Canceled, err)
+			}
+		}
+	}
+}
+
+func TestEncodeRGBAWithMetadata(t *testing.T) {
+	img := util.ReadPNG("yellow-rose-3.png")
+
+	config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	expect := &mux.Metadata{
+		ICCProfile: []byte("icc profile"),
+		EXIF:       []byte("exif"),
+	}
+	config.SetMetadata(expect)
+
+	var buf bytes.Buffer
+	if err := webp.EncodeRGBA(&buf, img, config); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	m, err := mux.GetMetadata(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if !bytes.Equal(m.ICCProfile, expect.ICCProfile) || !bytes.Equal(m.EXIF, expect.EXIF) || m.XMP != nil {
+		t.Errorf("Expected metadata: %+v, but got %+v", expect, m)
+	}
+}
+
+func TestEncodeRGBAWithStats(t *testing.T) {
+	img := util.ReadPNG("yellow-rose-3.png")
+
+	for _, lossless := range []bool{false, true} {
+		config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+		if err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+		config.SetLossless(lossless)
+
+		var buf bytes.Buffer
+		stats, err := webp.EncodeRGBAWithStats(&buf, img, config)
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+
+		if stats.CodedSize != buf.Len() {
+			t.Errorf("Expected CodedSize: %d, but got %d", buf.Len(), stats.CodedSize)
+		}
+		if lossless {
+			if stats.LosslessSize == 0 {
+				t.Errorf("Expected non-zero LosslessSize for lossless encoding")
+			}
+		} else {
+			if stats.PSNR[4] < 30 {
+				t.Errorf("Expected PSNR more than 30, but got %v", stats.PSNR[4])
+			}
+			if stats.AlphaDataSize == 0 {
+				t.Errorf("Expected non-zero AlphaDataSize for image with alpha")
+			}
+		}
+	}
+}
+
+func TestEncodeGrayAndYUVAWithStats(t *testing.T) {
+	config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	src := util.ReadPNG("kinkaku.png")
+	gray := image.NewGray(src.Bounds())
+	draw.Draw(gray, gray.Rect, src, gray.Rect.Min, draw.Src)
+	var buf bytes.Buffer
+	stats, err := webp.EncodeGrayWithStats(&buf, gray, config)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if stats.CodedSize != buf.Len() || stats.PSNR[3] == 0 {
+		t.Errorf("Unexpected statistics of gray image: %+v", stats)
+	}
+
+	yuva, err := webp.DecodeYUVA(util.ReadFile("cosmos.webp"), &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	buf.Reset()
+	if stats, err = webp.EncodeYUVAWithStats(&buf, yuva, config); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if stats.CodedSize != buf.Len() || stats.PSNR[3] == 0 {
+		t.Errorf("Unexpected statistics of YUVA image: %+v", stats)
+	}
+
+	// The statistics are also collected when the planes are copied.
+	buf.Reset()
+	if stats, err = webp.EncodeYUVAWithStats(&buf, yuva.SubImage(image.Rect(1, 1, 101, 81)).(*webp.YUVAImage), config); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if stats.CodedSize != buf.Len() {
+		t.Errorf("Expected CodedSize: %d, but got %d", buf.Len(), stats.CodedSize)
+	}
+}
+
+func TestConfigSizeParameters(t *testing.T) {
+	config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	config.SetTargetSize(1000)
+	config.SetQMin(10)
+	config.SetQMax(80)
+	config.SetUseSharpYUV(true)
+	if got := config.TargetSize(); got != 1000 {
+		t.Errorf("Expected TargetSize: %v, but got %v", 1000, got)
+	}
+	if got := config.QMin(); got != 10 {
+		t.Errorf("Expected QMin: %v, but got %v", 10, got)
+	}
+	if got := config.QMax(); got != 80 {
+		t.Errorf("Expected QMax: %v, but got %v", 80, got)
+	}
+	if got := config.UseSharpYUV(); got != true {
+		t.Errorf("Expected UseSharpYUV: %v, but got %v", true, got)
+	}
+	if err := webp.ValidateConfig(config); err != nil {
+		t.Errorf("Got Error: %v", err)
+	}
+
+	config.SetQMin(90)
+	if err := webp.ValidateConfig(config); err == nil {
+		t.Errorf("Expected error for QMin greater than QMax")
+	}
+}
+
+func TestEncodeRGBAToSize(t *testing.T) {
+	img := util.ReadPNG("yellow-rose-3.png")
+
+	config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	var full bytes.Buffer
+	if err := webp.EncodeRGBA(&full, img, config); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	size := full.Len() / 2
+	var buf bytes.Buffer
+	quality, stats, err := webp.EncodeRGBAToSize(&buf, img, config, size)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if buf.Len() > size {
+		t.Errorf("Expected size at most %d, but got %d", size, buf.Len())
+	}
+	if stats.CodedSize != buf.Len() {
+		t.Errorf("Expected CodedSize: %d, but got %d", buf.Len(), stats.CodedSize)
+	}
+	if config.Quality() != 90 {
+		t.Errorf("Given config should not be modified")
+	}
+
+	// The returned quality factor reproduces the written WebP.
+	config.SetQuality(quality)
+	var expect bytes.Buffer
+	if err := webp.EncodeRGBA(&expect, img, config); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expect.Bytes()) {
+		t.Errorf("Expected the WebP encoded with quality %v", quality)
+	}
+
+	// A higher quality factor exceeds the size.
+	if quality < 100 {
+		config.SetQuality(quality + 1)
+		expect.Reset()
+		if err := webp.EncodeRGBA(&expect, img, config); err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+		if expect.Len() <= size {
+			t.Errorf("Expected size more than %d with quality %v, but got %d", size, quality+1, expect.Len())
+		}
+	}
+}
+
+func TestEncodeRGBAToSizeErrors(t *testing.T) {
+	img := util.ReadPNG("yellow-rose-3.png")
+	if _, _, err := webp.EncodeRGBAToSize(io.Discard, img, nil, 10000); err == nil {
+		t.Errorf("Expected error for nil config")
+	}
+
+	config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if _, _, err := webp.EncodeRGBAToSize(io.Discard, img, config, 100); err == nil {
+		t.Errorf("Expected error for unreachable size")
+	}
+	config.SetLossless(true)
+	if _, _, err := webp.EncodeRGBAToSize(io.Discard, img, config, 10000); err == nil {
+		t.Errorf("Expected error for lossless config")
+	}
+}
+
+// opaqueImage wraps image.Image to test encoding of the image types which do
+// not have fast paths.
+type opaqueImage struct {
+	image.Image
+}
+
+func TestEncodeImageTypes(t *testing.T) {
+	src := util.ReadPNG("yellow-rose-3.png")
+	b := src.Bounds()
+
+	tests := []struct {
+		name string
+		img  draw.Image
+	}{
+		{"Gray", image.NewGray(b)},
+		{"Gray16", image.NewGray16(b)},
+		{"RGBA64", image.NewRGBA64(b)},
+		{"NRGBA64", image.NewNRGBA64(b)},
+		{"CMYK", image.NewCMYK(b)},
+		{"Paletted", image.NewPaletted(b, palette.WebSafe)},
+		{"Alpha16", image.NewAlpha16(b)},
+	}
+
+	for _, tt := range tests {
+		draw.Draw(tt.img, b, src, b.Min, draw.Src)
+		for _, img := range []image.Image{tt.img, opaqueImage{tt.img}} {
+			config, err := webp.ConfigLosslessPreset(6)
+			if err != nil {
+				t.Fatalf("Got Error: %v", err)
+			}
+			config.SetExact(true)
+			var buf bytes.Buffer
+			stats, err := webp.EncodeRGBAWithStats(&buf, img, config)
+			if err != nil {
+				t.Errorf("%v: Got Error: %v", tt.name, err)
+				continue
+			}
+			if _, ok := img.(*image.Paletted); ok && stats.LosslessFeatures&webp.LosslessColorIndexing == 0 {
+				t.Errorf("%v: Expected color indexing transform, but got features %v", tt.name, stats.LosslessFeatures)
+			}
+
+			decoded, err := webp.DecodeNRGBA(buf.Bytes(), &webp.DecoderOptions{})
+			if err != nil {
+				t.Errorf("%v: Got Error: %v", tt.name, err)
+				continue
+			}
+			if x, y, ok := equalNRGBA(decoded, img); !ok {
+				t.Errorf("%v (%T): Expected %v at (%d, %d), but got %v", tt.name, img, nrgbaAt(img, b.Min.X+x, b.Min.Y+y), x, y, decoded.At(x, y))
+			}
+		}
+	}
+}
+
+func TestEncodeYCbCr(t *testing.T) {
+	src := util.ReadPNG("yellow-rose-3.png")
+	b := src.Bounds()
+
+	ratios := []image.YCbCrSubsampleRatio{
+		image.YCbCrSubsampleRatio444,
+		image.YCbCrSubsampleRatio422,
+		image.YCbCrSubsampleRatio420,
+		image.YCbCrSubsampleRatio440,
+		image.YCbCrSubsampleRatio411,
+		image.YCbCrSubsampleRatio410,
+	}
+
+	for _, ratio := range ratios {
+		img := image.NewNYCbCrA(b, ratio)
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				c := color.NRGBAModel.Convert(src.At(x, y)).(color.NRGBA)
+				yy, cb, cr := color.RGBToYCbCr(c.R, c.G, c.B)
+				img.Y[img.YOffset(x, y)] = yy
+				img.Cb[img.COffset(x, y)] = cb
+				img.Cr[img.COffset(x, y)] = cr
+				img.A[img.AOffset(x, y)] = c.A
+			}
+		}
+
+		for _, target := range []image.Image{&img.YCbCr, img} {
+			config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+			if err != nil {
+				t.Fatalf("Got Error: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err := webp.EncodeRGBA(&buf, target, config); err != nil {
+				t.Errorf("%v: Got Error: %v", ratio, err)
+				continue
+			}
+			decoded, err := webp.DecodeNRGBA(buf.Bytes(), &webp.DecoderOptions{})
+			if err != nil {
+				t.Errorf("%v: Got Error: %v", ratio, err)
+				continue
+			}
+
+			// Compare colors in average, because encoding is lossy.
+			var diff, n int
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					expect := color.NRGBAModel.Convert(target.At(x, y)).(color.NRGBA)
+					got := decoded.NRGBAAt(x-b.Min.X, y-b.Min.Y)
+					if _, ok := target.(*image.YCbCr); ok {
+						got.A = 0xff
+					} else if expect.A == 0 {
+						continue
+					}
+					diff += absDiff(got.R, expect.R) + absDiff(got.G, expect.G) + absDiff(got.B, expect.B) + absDiff(got.A, expect.A)
+					n++
+				}
+			}
+			if avg := float64(diff) / float64(n); avg > 8 {
+				t.Errorf("%v (%T): Expected average difference of color less than 8, but got %v", ratio, target, avg)
+			}
+		}
+	}
+}
+
+// equalNRGBA compares decoded image with the original image in NRGBA colors,
+// and returns the position of the first different pixel.
+func equalNRGBA(decoded *image.NRGBA, img image.Image) (x, y int, ok bool) {
+	b := img.Bounds()
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			if decoded.NRGBAAt(x, y) != nrgbaAt(img, b.Min.X+x, b.Min.Y+y) {
+				return x, y, false
+			}
+		}
+	}
+	return 0, 0, true
+}
+
+// nrgbaAt returns the color at (x, y) as NRGBA. The color of image.NRGBA64 is
+// converted without premultiplication to keep precision.
+func nrgbaAt(img image.Image, x, y int) color.NRGBA {
+	if p, ok := img.(*image.NRGBA64); ok {
+		c := p.NRGBA64At(x, y)
+		return color.NRGBA{uint8(c.R >> 8), uint8(c.G >> 8), uint8(c.B >> 8), uint8(c.A >> 8)}
+	}
+	return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+}
+
+func absDiff(a, b uint8) int {
+	if a > b {
+		return int(a - b)
+	}
+	return int(b - a)
+}
+
+func TestEncodePremultipliedRGBA(t *testing.T) {
+	alphas := []uint8{1, 16, 64, 128, 192, 254, 255}
+	src := image.NewRGBA(image.Rect(0, 0, 256, len(alphas)))
+	straight := image.NewNRGBA(src.Rect)
+	for y, a := range alphas {
+		for x := 0; x < 256; x++ {
+			c := color.NRGBA{uint8(x), uint8(255 - x), uint8(x / 2), a}
+			straight.SetNRGBA(x, y, c)
+			src.Set(x, y, c)
+		}
+	}
+
+	config, err := webp.ConfigLosslessPreset(6)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	config.SetExact(true)
+
+	var buf bytes.Buffer
+	if err := webp.EncodeRGBA(&buf, src, config); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	nrgba, err := webp.DecodeNRGBA(buf.Bytes(), &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	rgba, err := webp.DecodeRGBA(buf.Bytes(), &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	for y, a := range alphas {
+		// Premultiplication loses precision of colors by the factor of alpha.
+		tolerance := uint32(255/int(a) + 1)
+		for x := 0; x < 256; x++ {
+			if expect, got := straight.NRGBAAt(x, y), nrgba.NRGBAAt(x, y); got.A != expect.A || !colorsClose(color.RGBA(got), color.RGBA(expect), tolerance) {
+				t.Errorf("Expected straight color at (%d, %d): %v, but got %v", x, y, expect, got)
+				break
+			}
+			if expect, got := src.RGBAAt(x, y), rgba.RGBAAt(x, y); !colorsClose(got, expect, 1) {
+				t.Errorf("Expected premultiplied color at (%d, %d): %v, but got %v", x, y, expect, got)
+				break
+			}
+		}
+	}
+}
+
+func TestEncodeSubImage(t *testing.T) {
+	src := util.ReadPNG("yellow-rose-3.png")
+	b := src.Bounds()
+	rects := []image.Rectangle{
+		image.Rect(37, 51, 160, 128),
+		image.Rect(0, 0, 1, 1),
+		image.Rect(b.Max.X-3, b.Max.Y-5, b.Max.X, b.Max.Y),
+	}
+
+	canvases := []draw.Image{
+		image.NewNRGBA(b),
+		image.NewRGBA(b),
+		webp.NewRGBImage(b),
+		image.NewNRGBA64(b),
+	}
+
+	for _, canvas := range canvases {
+		draw.Draw(canvas, b, src, b.Min, draw.Src)
+		for _, r := range rects {
+			sub := canvas.(interface {
+				SubImage(image.Rectangle) image.Image
+			}).SubImage(r).(draw.Image)
+
+			// The compact copy of the sub-image, which begins at the beginning of Pix.
+			var compact draw.Image
+			switch rect := image.Rect(0, 0, r.Dx(), r.Dy()); sub.(type) {
+			case *image.NRGBA:
+				compact = image.NewNRGBA(rect)
+			case *image.RGBA:
+				compact = image.NewRGBA(rect)
+			case *webp.RGBImage:
+				compact = webp.NewRGBImage(rect)
+			case *image.NRGBA64:
+				compact = image.NewNRGBA64(rect)
+			}
+			draw.Draw(compact, compact.Bounds(), sub, r.Min, draw.Src)
+
+			config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+			if err != nil {
+				t.Fatalf("Got Error: %v", err)
+			}
+			var got, expect bytes.Buffer
+			if err := webp.EncodeRGBA(&got, sub, config); err != nil {
+				t.Errorf("Got Error: %v", err)
+				continue
+			}
+			if err := webp.EncodeRGBA(&expect, compact, config); err != nil {
+				t.Errorf("Got Error: %v", err)
+				continue
+			}
+			if !bytes.Equal(got.Bytes(), expect.Bytes()) {
+				t.Errorf("Encoded sub-image %v of %T should be equal to encoded copy of it", r, sub)
+			}
+		}
+	}
+}
+
+func TestEncodeGraySubImage(t *testing.T) {
+	src := util.ReadPNG("yellow-rose-3.png")
+	canvas := image.NewGray(src.Bounds())
+	draw.Draw(canvas, canvas.Rect, src, src.Bounds().Min, draw.Src)
+
+	r := image.Rect(37, 51, 160, 128)
+	sub := canvas.SubImage(r).(*image.Gray)
+	compact := image.NewGray(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(compact, compact.Rect, sub, r.Min, draw.Src)
+
+	config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	var got, expect bytes.Buffer
+	if err := webp.EncodeGray(&got, sub, config); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if err := webp.EncodeGray(&expect, compact, config); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), expect.Bytes()) {
+		t.Errorf("Encoded sub-image %v should be equal to encoded copy of it", r)
+	}
+}
+
+func TestEncodeYUVASubImage(t *testing.T) {
+	canvas, err := webp.DecodeYUVA(util.ReadFile("yellow-rose-3.webp"), &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	rects := []image.Rectangle{
+		image.Rect(36, 50, 159, 127),
+		image.Rect(37, 51, 160, 128),
+		image.Rect(36, 51, 37, 52),
+	}
+	for _, r := range rects {
+		sub := canvas.SubImage(r).(*webp.YUVAImage)
+
+		config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+		var buf bytes.Buffer
+		if err := webp.EncodeYUVA(&buf, sub, config); err != nil {
+			t.Errorf("Got Error: %v", err)
+			continue
+		}
+		decoded, err := webp.DecodeNRGBA(buf.Bytes(), &webp.DecoderOptions{})
+		if err != nil {
+			t.Errorf("Got Error: %v", err)
+			continue
+		}
+		if decoded.Rect.Size() != r.Size() {
+			t.Errorf("Expected size %v, but got %v", r.Size(), decoded.Rect.Size())
+			continue
+		}
+
+		// Compare colors in average, because encoding is lossy.
+		var diff, n int
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				expect := sub.NRGBAAt(x, y)
+				if expect.A == 0 {
+					continue
+				}
+				got := decoded.NRGBAAt(x-r.Min.X, y-r.Min.Y)
+				diff += absDiff(got.R, expect.R) + absDiff(got.G, expect.G) + absDiff(got.B, expect.B) + absDiff(got.A, expect.A)
+				n++
+			}
+		}
+		if n > 0 {
+			if avg := float64(diff) / float64(n); avg > 12 {
+				t.Errorf("Sub-image %v: Expected average difference of color less than 12, but got %v", r, avg)
+			}
+		}
+	}
+}
+
+func TestEncodeEmptyImage(t *testing.T) {
+	config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+
+	var encodeErr *webp.EncodeError
+	err = webp.EncodeRGBA(io.Discard, image.NewNRGBA(image.Rect(10, 10, 10, 20)), config)
+	if !errors.As(err, &encodeErr) || encodeErr.EncodeErrorCode() != webp.EncodeErrorCodeVP8EncErrorBadDimension {
+		t.Errorf("Expected BadDimension error, but got %v", err)
+	}
+	err = webp.EncodeGray(io.Discard, image.NewGray(image.Rectangle{}), config)
+	if !errors.As(err, &encodeErr) || encodeErr.EncodeErrorCode() != webp.EncodeErrorCodeVP8EncErrorBadDimension {
+		t.Errorf("Expected BadDimension error, but got %v", err)
+	}
+}
+
+func TestPicture(t *testing.T) {
+	img := util.ReadPNG("yellow-rose-3.png")
+	b := img.Bounds()
+
+	tests := []struct {
+		name   string
+		expect image.Rectangle
+		op     func(p *webp.Picture) error
+	}{
+		{"Rescale", image.Rect(0, 0, 200, 100), func(p *webp.Picture) error { return p.Rescale(200, 100) }},
+		{"RescaleAspect", image.Rect(0, 0, 200, 151), func(p *webp.Picture) error { return p.Rescale(200, 0) }},
+		{"Crop", image.Rect(0, 0, 123, 77), func(p *webp.Picture) error { return p.Crop(image.Rect(37, 51, 160, 128)) }},
+		{"CropAndRescale", image.Rect(0, 0, 60, 38), func(p *webp.Picture) error {
+			if err := p.Crop(image.Rect(37, 51, 160, 128)); err != nil {
+				return err
+			}
+			return p.Rescale(60, 0)
+		}},
+		{"Cleanup", b, func(p *webp.Picture) error { p.CleanupTransparentArea(); return nil }},
+		{"SmartARGBToYUVA", b, func(p *webp.Picture) error { return p.SmartARGBToYUVA() }},
+	}
+
+	for _, tt := range tests {
+		p, err := webp.NewPicture(img)
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+		if err := tt.op(p); err != nil {
+			t.Errorf("%v: Got Error: %v", tt.name, err)
+			p.Close()
+			continue
+		}
+
+		config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+		var buf bytes.Buffer
+		stats, err := webp.EncodePictureWithStats(&buf, p, config)
+		p.Close()
+		if err != nil {
+			t.Errorf("%v: Got Error: %v", tt.name, err)
+			continue
+		}
+		if stats.CodedSize != buf.Len() {
+			t.Errorf("%v: Expected CodedSize: %d, but got %d", tt.name, buf.Len(), stats.CodedSize)
+		}
+
+		decoded, err := webp.DecodeNRGBA(buf.Bytes(), &webp.DecoderOptions{})
+		if err != nil {
+			t.Errorf("%v: Got Error: %v", tt.name, err)
+			continue
+		}
+		if decoded.Rect != tt.expect {
+			t.Errorf("%v: Expected bounds %v, but got %v", tt.name, tt.expect, decoded.Rect)
+		}
+	}
+}
+
+func TestPictureWithInvalidRectangle(t *testing.T) {
+	p, err := webp.NewPicture(util.ReadPNG("yellow-rose-3.png"))
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	defer p.Close()
+
+	if err := p.Crop(image.Rect(300, 200, 500, 400)); err == nil {
+		t.Errorf("Expected error for cropping outside of the picture")
+	}
+	if _, err := p.View(image.Rect(-1, 0, 10, 10)); err == nil {
+		t.Errorf("Expected error for view outside of the picture")
+	}
+	if err := p.Rescale(-1, 10); err == nil {
+		t.Errorf("Expected error for rescaling to negative size")
+	}
+}
+
+func TestPictureAfterClose(t *testing.T) {
+	p, err := webp.NewPicture(util.ReadPNG("yellow-rose-3.png"))
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	v, err := p.View(image.Rect(0, 0, 10, 10))
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	defer v.Close()
+	p.Close()
+	p.Close()
+
+	config, err := webp.ConfigLosslessPreset(6)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	for _, pic := range []*webp.Picture{p, v} {
+		if pic.Width() != 0 || pic.Height() != 0 || pic.IsView() {
+			t.Errorf("Expected empty picture after Close, but got %dx%d, IsView: %v", pic.Width(), pic.Height(), pic.IsView())
+		}
+		pic.Flip()
+		pic.CleanupTransparentArea()
+		if err := pic.Rescale(10, 10); err == nil {
+			t.Errorf("Expected error for Rescale after Close")
+		}
+		if _, err := pic.View(image.Rect(0, 0, 5, 5)); err == nil {
+			t.Errorf("Expected error for View after Close")
+		}
+		if err := webp.EncodePicture(io.Discard, pic, config); err == nil {
+			t.Errorf("Expected error for EncodePicture after Close")
+		}
+		if _, err := webp.EncodePictureWithStats(io.Discard, pic, config); err == nil {
+			t.Errorf("Expected error for EncodePictureWithStats after Close")
+		}
+	}
+}
+
+func TestPictureView(t *testing.T) {
+	img := util.ReadPNG("yellow-rose-3.png").(*image.NRGBA)
+	r := image.Rect(37, 51, 160, 128)
+
+	p, err := webp.NewPicture(img)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	defer p.Close()
+
+	v, err := p.View(r)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	defer v.Close()
+	if !v.IsView() || v.Width() != r.Dx() || v.Height() != r.Dy() {
+		t.Errorf("Expected view of %dx%d, but got IsView: %v, %dx%d", r.Dx(), r.Dy(), v.IsView(), v.Width(), v.Height())
+	}
+
+	config, err := webp.ConfigLosslessPreset(6)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	config.SetExact(true)
+
+	var got, expect bytes.Buffer
+	if err := webp.EncodePicture(&got, v, config); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if err := webp.EncodeRGBA(&expect, img.SubImage(r), config); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if !bytes.Equal(got.Bytes(), expect.Bytes()) {
+		t.Errorf("Encoded view should be equal to encoded sub-image")
+	}
+}
+
+func TestPictureFlip(t *testing.T) {
+	img := util.ReadPNG("yellow-rose-3.png").(*image.NRGBA)
+	b := img.Bounds()
+
+	p, err := webp.NewPicture(img)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	defer p.Close()
+	p.Flip()
+
+	config, err := webp.ConfigLosslessPreset(6)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	config.SetExact(true)
+
+	var buf bytes.Buffer
+	if err := webp.EncodePicture(&buf, p, config); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	decoded, err := webp.DecodeNRGBA(buf.Bytes(), &webp.DecoderOptions{Flip: true})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	if x, y, ok := equalNRGBA(decoded, img); !ok {
+		t.Errorf("Expected %v at (%d, %d), but got %v", img.At(b.Min.X+x, b.Min.Y+y), x, y, decoded.At(x, y))
+	}
+}
+
+func TestPictureBlendAlpha(t *testing.T) {
+	p, err := webp.NewPicture(util.ReadPNG("yellow-rose-3.png"))
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	defer p.Close()
+
+	if !p.HasTransparency() {
+		t.Fatalf("Expected picture with transparency")
+	}
+	p.BlendAlpha(color.White)
+	if p.HasTransparency() {
+		t.Errorf("Expected opaque picture after blending alpha")
+	}
+}
+
+func TestDistortion(t *testing.T) {
+	img := util.ReadPNG("yellow-rose-3.png")
+
+	config, err := webp.ConfigPreset(webp.PresetDefault, 75)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	// Preserve colors under transparent area, which are compared as well.
+	config.SetExact(true)
+	var buf bytes.Buffer
+	if err := webp.EncodeRGBA(&buf, img, config); err != nil {
+		t.Fatalf("Got Error: %v", err)
+	}
+	decoded, err := webp.DecodeNRGBA(buf.Bytes(), &webp.DecoderOptions{})
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
 	}
 
-	for _, file := range files {
-		data := util.ReadFile(file)
-		options := &webp.DecoderOptions{}
+	tests := []struct {
+		metric   webp.Metric
+		min, max float32
+	}{
+		{webp.MetricPSNR, 25, 60},
+		{webp.MetricSSIM, 10, 60},
+		{webp.MetricLSIM, 25, 60},
+	}
+	for _, tt := range tests {
+		result, err := webp.Distortion(img, decoded, tt.metric)
+		if err != nil {
+			t.Errorf("Got Error: %v", err)
+			continue
+		}
+		if result[4] < tt.min || result[4] > tt.max {
+			t.Errorf("Expected distortion of metric %d in [%v, %v], but got %v", tt.metric, tt.min, tt.max, result)
+		}
 
-		_, err := webp.DecodeYUVA(data, options)
+		// Identical images have the maximum score.
+		same, err := webp.Distortion(img, img, tt.metric)
 		if err != nil {
 			t.Errorf("Got Error: %v", err)
-			return
+			continue
+		}
+		if same[4] <= result[4] {
+			t.Errorf("Expected distortion of identical images more than %v, but got %v", result[4], same[4])
 		}
 	}
 }
 
-func TestDecodeRGBA(t *testing.T) {
-	files := []string{
-		"cosmos.webp",
-		"butterfly.webp",
-		"kinkaku.webp",
-		"yellow-rose-3.webp",
+func TestDistortionWithDifferentSize(t *testing.T) {
+	a := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+	b := image.NewNRGBA(image.Rect(0, 0, 10, 11))
+	if _, err := webp.Distortion(a, b, webp.MetricPSNR); err == nil {
+		t.Errorf("Expected error for images of different size")
 	}
+	if _, err := webp.GrayDistortion(image.NewGray(a.Rect), image.NewGray(b.Rect), webp.MetricPSNR); err == nil {
+		t.Errorf("Expected error for images of different size")
+	}
+}
 
-	for _, file := range files {
-		data := util.ReadFile(file)
-		options := &webp.DecoderOptions{}
+func TestGrayDistortion(t *testing.T) {
+	src := util.ReadPNG("yellow-rose-3.png")
+	ref := image.NewGray(src.Bounds())
+	draw.Draw(ref, ref.Rect, src, src.Bounds().Min, draw.Src)
+
+	// Add noise to the sub-image of the larger canvas.
+	canvas := image.NewGray(ref.Rect.Inset(-3))
+	candidate := canvas.SubImage(ref.Rect).(*image.Gray)
+	draw.Draw(candidate, candidate.Rect, ref, ref.Rect.Min, draw.Src)
+	for i := range candidate.Pix {
+		if i%7 == 0 && candidate.Pix[i] < 0xf0 {
+			candidate.Pix[i] += 0x10
+		}
+	}
 
-		_, err := webp.DecodeRGBA(data, options)
+	for _, metric := range []webp.Metric{webp.MetricPSNR, webp.MetricSSIM} {
+		same, err := webp.GrayDistortion(ref, ref, metric)
 		if err != nil {
-			t.Errorf("Got Error: %v", err)
-			return
+			t.Fatalf("Got Error: %v", err)
+		}
+		result, err := webp.GrayDistortion(ref, candidate, metric)
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+		if result <= 0 || result >= same {
+			t.Errorf("Expected distortion of metric %d in (0, %v), but got %v", metric, same, result)
 		}
 	}
 }
 
-func TestDecodeNRGBA(t *testing.T) {
-	files := []string{
-		"cosmos.webp",
-		"butterfly.webp",
-		"kinkaku.webp",
-		"yellow-rose-3.webp",
-	}
+func TestEncodeToQuality(t *testing.T) {
+	img := util.ReadPNG("yellow-rose-3.png")
 
-	for _, file := range files {
-		data := util.ReadFile(file)
-		options := &webp.DecoderOptions{}
+	tests := []webp.QualityTarget{
+		{Metric: webp.MetricPSNR, Min: 38},
+		{Metric: webp.MetricSSIM, Min: 18},
+	}
+	for _, target := range tests {
+		config, err := webp.ConfigPreset(webp.PresetDefault, 75)
+		if err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
 
-		_, err := webp.DecodeNRGBA(data, options)
+		var buf bytes.Buffer
+		quality, stats, err := webp.EncodeToQuality(&buf, img, config, target)
 		if err != nil {
 			t.Errorf("Got Error: %v", err)
-			return
+			continue
+		}
+		if stats.CodedSize != buf.Len() {
+			t.Errorf("Expected CodedSize: %d, but got %d", buf.Len(), stats.CodedSize)
+		}
+		if quality <= 0 || quality >= 100 {
+			t.Errorf("Expected quality in (0, 100), but got %v", quality)
 		}
-	}
-}
 
-func TestDecodeRGBAWithCropping(t *testing.T) {
-	data := util.ReadFile("cosmos.webp")
-	crop := image.Rect(100, 100, 300, 200)
+		// The chosen quality is the lowest one which meets the target.
+		premultiplied := func(data []byte) *image.RGBA {
+			decoded, err := webp.DecodeRGBA(data, &webp.DecoderOptions{})
+			if err != nil {
+				t.Fatalf("Got Error: %v", err)
+			}
+			return decoded
+		}
+		ref := image.NewRGBA(img.Bounds())
+		draw.Draw(ref, ref.Rect, img, ref.Rect.Min, draw.Src)
+		score := func(data []byte) float32 {
+			result, err := webp.Distortion(rawNRGBA(ref), rawNRGBA(premultiplied(data)), target.Metric)
+			if err != nil {
+				t.Fatalf("Got Error: %v", err)
+			}
+			return result[4]
+		}
+		if s := score(buf.Bytes()); s < target.Min {
+			t.Errorf("Expected score at least %v, but got %v", target.Min, s)
+		}
 
-	options := &webp.DecoderOptions{
-		Crop: crop,
+		var lower bytes.Buffer
+		config.SetQuality(quality - 1)
+		if err := webp.EncodeRGBA(&lower, img, config); err != nil {
+			t.Fatalf("Got Error: %v", err)
+		}
+		if s := score(lower.Bytes()); s >= target.Min {
+			t.Errorf("Expected score of lower quality less than %v, but got %v", target.Min, s)
+		}
 	}
+}
 
-	img, err := webp.DecodeRGBA(data, options)
+func TestEncodeToQualityWithTargetSize(t *testing.T) {
+	img := util.ReadPNG("yellow-rose-3.png")
+	target := webp.QualityTarget{Metric: webp.MetricPSNR, Min: 38}
+	config, err := webp.ConfigPreset(webp.PresetDefault, 75)
 	if err != nil {
-		t.Errorf("Got Error: %v", err)
-		return
-	}
-	if img.Rect.Dx() != crop.Dx() || img.Rect.Dy() != crop.Dy() {
-		t.Errorf("Decoded image should cropped to %v, but got %v", crop, img.Rect)
+		t.Fatalf("Got Error: %v", err)
 	}
-}
-
-func TestDecodeRGBAWithScaling(t *testing.T) {
-	data := util.ReadFile("cosmos.webp")
-	scale := image.Rect(0, 0, 640, 480)
 
-	options := &webp.DecoderOptions{
-		Scale: scale,
+	expectQuality, _, err := webp.EncodeToQuality(io.Discard, img, config, target)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
 	}
 
-	img, err := webp.DecodeRGBA(data, options)
+	// The target size of base config is ignored, which would override the
+	// quality factor.
+	config.SetTargetSize(1500)
+	config.SetPass(10)
+	quality, _, err := webp.EncodeToQuality(io.Discard, img, config, target)
 	if err != nil {
-		t.Errorf("Got Error: %v", err)
-		return
+		t.Fatalf("Got Error: %v", err)
 	}
-	if img.Rect.Dx() != scale.Dx() || img.Rect.Dy() != scale.Dy() {
-		t.Errorf("Decoded image should scaled to %v, but got %v", scale, img.Rect)
+	if quality != expectQuality {
+		t.Errorf("Expected quality %v without target size, but got %v", expectQuality, quality)
 	}
 }
 
-//
-// Encoding
-//
-
-func TestEncodeRGBA(t *testing.T) {
+func TestEncodeToQualityUnreachable(t *testing.T) {
 	img := util.ReadPNG("yellow-rose-3.png")
-	if _, ok := img.(*image.NRGBA); !ok {
-		t.Fatalf("image is not NRGBA: %v", reflect.TypeOf(img))
-	}
-
-	config, err := webp.ConfigPreset(webp.PresetDefault, 100)
+	config, err := webp.ConfigPreset(webp.PresetDefault, 75)
 	if err != nil {
-		t.Fatalf("got error: %v", err)
+		t.Fatalf("Got Error: %v", err)
 	}
 
-	f := util.CreateFile("TestEncodeRGBA.webp")
-	w := bufio.NewWriter(f)
-	defer func() {
-		w.Flush()
-		f.Close()
-	}()
-
-	if err := webp.EncodeRGBA(w, img, config); err != nil {
-		t.Errorf("Got Error: %v", err)
-		return
+	if _, _, err := webp.EncodeToQuality(io.Discard, img, config, webp.QualityTarget{Metric: webp.MetricPSNR, Min: 100}); err == nil {
+		t.Errorf("Expected error for unreachable quality")
+	}
+	config.SetLossless(true)
+	if _, _, err := webp.EncodeToQuality(io.Discard, img, config, webp.QualityTarget{Metric: webp.MetricPSNR, Min: 30}); err == nil {
+		t.Errorf("Expected error for lossless configuration")
 	}
 }
 
-func TestEncodeRGBAWithProgress(t *testing.T) {
-	img := util.ReadPNG("yellow-rose-3.png")
-	if _, ok := img.(*image.NRGBA); !ok {
-		t.Fatalf("image is not NRGBA: %v", reflect.TypeOf(img))
-	}
+// rawNRGBA reinterprets the premultiplied colors of image.RGBA as they are.
+func rawNRGBA(img *image.RGBA) *image.NRGBA {
+	return &image.NRGBA{Pix: img.Pix, Stride: img.Stride, Rect: img.Rect}
+}
 
-	config, err := webp.ConfigPreset(webp.PresetDefault, 100)
+func TestEncodeToBytes(t *testing.T) {
+	img := util.ReadPNG("yellow-rose-3.png")
+	config, err := webp.ConfigPreset(webp.PresetDefault, 90)
 	if err != nil {
-		t.Fatalf("got error: %v", err)
+		t.Fatalf("Got Error: %v", err)
 	}
-
-	f := util.CreateFile("TestEncodeRGBAWithProgress.webp")
-	w := bufio.NewWriter(f)
-	defer func() {
-		w.Flush()
-		f.Close()
-	}()
-
-	if err := webp.EncodeRGBAWithProgress(w, img, config, func(i int) bool {
-		t.Logf("Progress: %v", i)
-		return true
-	}); err != nil {
-		t.Errorf("Got Error: %v", err)
-		return
+	var expect bytes.Buffer
+	if err := webp.EncodeRGBA(&expect, img, config); err != nil {
+		t.Fatalf("Got Error: %v", err)
 	}
-}
 
-func TestEncodeRGBAWithProgressCanceled(t *testing.T) {
-	img := util.ReadPNG("yellow-rose-3.png")
-	if _, ok := img.(*image.NRGBA); !ok {
-		t.Fatalf("image is not NRGBA: %v", reflect.TypeOf(img))
+	data, err := webp.EncodeToBytes(img, config)
+	if err != nil {
+		t.Fatalf("Got Error: %v", err)
 	}
-
-	config, err := webp.ConfigPreset(webp.PresetDefault, 100)
+	if !bytes.Equal(data, expect.Bytes()) {
+		t.Errorf("Encoded bytes should be equal to the result of EncodeRGBA")
+	}
+	// Reuse the capacity of the buffer.
+	buf := make([]byte, 3, 2*len(data))
+	appended, err := webp.AppendEncode(buf, img, config)
 	if err != nil {
-		t.Fatalf("got error: %v", err)
+		t.Fatalf("Got Error: %v", err)
+	}
+	if &appended[0] != &buf[0] || !bytes.Equal(appended[3:], data) {
+		t.Errorf("Encoded bytes should be appended to the buffer")
 	}
 
-	f := util.CreateFile("TestEncodeRGBAWithProgress.webp")
-	w := bufio.NewWriter(f)
-	defer func() {
-		w.Flush()
-		f.Close()
-	}()
-
-	var encodeErr *webp.EncodeError
-	if err := webp.EncodeRGBAWithProgress(w, img, config, func(i int) bool {
-		t.Logf("Progress: %v", i)
-		return false
-	}); !errors.As(err, &encodeErr) || encodeErr.EncodeErrorCode() != webp.EncodeErrorCodeVP8EncErrorUserAbort {
-		t.Errorf("Expected UserAbort (%v) but received: %v", webp.EncodeErrorCodeVP8EncErrorUserAbort, err)
-		return
+	// The buffer is returned as it is on error.
+	appended, err = webp.AppendEncode(buf, image.NewNRGBA(image.Rect(0, 0, 0, 5)), config)
+	if err == nil || len(appended) != len(buf) || &appended[0] != &buf[0] {
+		t.Errorf("Expected the buffer as it is on error, but got %d bytes and %v", len(appended), err)
 	}
 }
 
@@ -508,3 +2515,220 @@ func TestEncodeGrayWithProgressCanceled(t *testing.T) {
 		return
 	}
 }
+
+//
+// Animation
+//
+
+func newAnimationFrames(n int, rect image.Rectangle) []*image.NRGBA {
+	frames := make([]*image.NRGBA, n)
+	for i := range frames {
+		frames[i] = image.NewNRGBA(rect)
+		c := color.NRGBA{uint8(255 * i / n), 0x80, uint8(255 - 255*i/n), 0xFF}
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				frames[i].SetNRGBA(x, y, c)
+			}
+		}
+	}
+	return frames
+}
+
+func encodeAnimation(t *testing.T, frames []*image.NRGBA, interval time.Duration, options *webp.AnimationEncoderOptions) []byte {
+	config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	rect := frames[0].Bounds()
+	enc, err := webp.NewAnimationEncoder(rect.Dx(), rect.Dy(), options)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	defer enc.Close()
+
+	for i, frame := range frames {
+		if err := enc.AddFrame(frame, time.Duration(i)*interval, config); err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, time.Duration(len(frames))*interval); err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestEncodeAnimation(t *testing.T) {
+	frames := newAnimationFrames(3, image.Rect(0, 0, 64, 48))
+	data := encodeAnimation(t, frames, 100*time.Millisecond, &webp.AnimationEncoderOptions{
+		LoopCount:       2,
+		BackgroundColor: color.NRGBA{0xFF, 0xFF, 0xFF, 0xFF},
+	})
+
+	f, err := webp.GetFeatures(data)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	if !f.HasAnimation {
+		t.Errorf("Expected HasAnimation: %v, but got %v", true, f.HasAnimation)
+	}
+	if f.Width != 64 || f.Height != 48 {
+		t.Errorf("Expected size: %dx%d, but got %dx%d", 64, 48, f.Width, f.Height)
+	}
+}
+
+func TestEncodeAnimationWithInvalidFrameSize(t *testing.T) {
+	config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+
+	enc, err := webp.NewAnimationEncoder(64, 48, nil)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	defer enc.Close()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 32))
+	if err := enc.AddFrame(img, 0, config); err == nil {
+		t.Errorf("Expected error for frame of invalid size")
+	}
+}
+
+func TestEncodeAnimationWithDefaultOptions(t *testing.T) {
+	frames := newAnimationFrames(3, image.Rect(0, 0, 64, 48))
+	defaults := encodeAnimation(t, frames, 100*time.Millisecond, nil)
+	// Options which set only LoopCount keep the other defaults.
+	data := encodeAnimation(t, frames, 100*time.Millisecond, &webp.AnimationEncoderOptions{LoopCount: 1})
+	if len(data) != len(defaults) {
+		t.Errorf("Expected the same size as default options: %d, but got %d", len(defaults), len(data))
+	}
+
+	dec, err := webp.NewAnimationDecoder(data, nil)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	defer dec.Close()
+	info := dec.Info()
+	if expect := (color.NRGBA{0xFF, 0xFF, 0xFF, 0xFF}); info.BackgroundColor != expect || info.LoopCount != 1 {
+		t.Errorf("Expected background color %v and loop count 1, but got %+v", expect, info)
+	}
+}
+
+func TestAnimationEncoderAfterClose(t *testing.T) {
+	config, err := webp.ConfigPreset(webp.PresetDefault, 90)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	enc, err := webp.NewAnimationEncoder(64, 48, nil)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	enc.Close()
+	enc.Close()
+
+	if err := enc.AddFrame(image.NewNRGBA(image.Rect(0, 0, 64, 48)), 0, config); err == nil {
+		t.Errorf("Expected error for AddFrame after Close")
+	}
+	if err := enc.Encode(io.Discard, time.Second); err == nil {
+		t.Errorf("Expected error for Encode after Close")
+	}
+}
+
+func TestDecodeAnimation(t *testing.T) {
+	rect := image.Rect(0, 0, 64, 48)
+	frames := newAnimationFrames(3, rect)
+	interval := 100 * time.Millisecond
+	data := encodeAnimation(t, frames, interval, &webp.AnimationEncoderOptions{
+		LoopCount:       2,
+		BackgroundColor: color.NRGBA{0x11, 0x22, 0x33, 0xFF},
+	})
+
+	dec, err := webp.NewAnimationDecoder(data, nil)
+	if err != nil {
+		t.Fatalf("got error: %v", err)
+	}
+	defer dec.Close()
+
+	info := dec.Info()
+	expectInfo := webp.AnimationInfo{
+		CanvasWidth:     64,
+		CanvasHeight:    48,
+		LoopCount:       2,
+		BackgroundColor: color.NRGBA{0x11, 0x22, 0x33, 0xFF},
+		FrameCount:      3,
+	}
+	if info != expectInfo {
+		t.Errorf("Expected info: %+v, but got %+v", expectInfo, info)
+	}
+
+	for i := 0; dec.HasMoreFrames(); i++ {
+		frame, err := dec.NextFrame()
+		if err != nil {
+			t.Fatalf("got error: %v", err)
+		}
+		if got := frame.Image.Bounds(); got != rect {
+			t.Errorf("Expected bounds of frame %d: %v, but got %v", i, rect, got)
+		}
+		if got, expect := frame.Timestamp, time.Duration(i)*interval; got != expect {
+			t.Errorf("Expected timestamp of frame %d: %v, but got %v", i, expect, got)
+		}
+		if got := frame.Duration; got != interval {
+			t.Errorf("Expected duration of frame %d: %v, but got %v", i, interval, got)
+		}
+		expect := frames[i].NRGBAAt(0, 0)
+		if got := frame.Image.NRGBAAt(32, 24); !closeNRGBA(got, expect, 4) {
+			t.Errorf("Expected color of frame %d: %v, but got %v", i, expect, got)
+		}
+	}
+
+	if _, err := dec.NextFrame(); err != io.EOF {
+		t.Errorf("Expected io.EOF after last frame, but got %v", err)
+	}
+
+	dec.Reset()
+	if !dec.HasMoreFrames() {
+		t.Errorf("Expected more frames after Reset")
+	}
+}
+
+func TestDecodeAnimationWithLimits(t *testing.T) {
+	frames := newAnimationFrames(3, image.Rect(0, 0, 64, 48))
+	data := encodeAnimation(t, frames, 100*time.Millisecond, nil)
+
+	tests := []struct {
+		limits webp.Limits
+		limit  string
+	}{
+		{webp.Limits{MaxWidth: 64, MaxHeight: 48, MaxFrames: 3}, ""},
+		{webp.Limits{MaxWidth: 63}, "MaxWidth"},
+		{webp.Limits{MaxPixels: 64*48 - 1}, "MaxPixels"},
+		{webp.Limits{MaxFrames: 2}, "MaxFrames"},
+	}
+
+	for _, tt := range tests {
+		dec, err := webp.NewAnimationDecoder(data, &webp.AnimationDecoderOptions{Limits: tt.limits})
+		if err == nil {
+			dec.Close()
+		}
+
+		var limitErr *webp.LimitError
+		if tt.limit == "" {
+			if err != nil {
+				t.Errorf("%+v: Got Error: %v", tt.limits, err)
+			}
+		} else if !errors.As(err, &limitErr) || limitErr.Limit != tt.limit {
+			t.Errorf("%+v: Expected LimitError of %v, but got %v", tt.limits, tt.limit, err)
+		}
+	}
+}
+
+func closeNRGBA(a, b color.NRGBA, tolerance int) bool {
+	diff := func(x, y uint8) bool {
+		d := int(x) - int(y)
+		return -tolerance <= d && d <= tolerance
+	}
+	return diff(a.R, b.R) && diff(a.G, b.G) && diff(a.B, b.B) && diff(a.A, b.A)
+}
@@ -1,6 +1,20 @@
 package webp
 
-import "image"
+import (
+	"image"
+	"image/color"
+)
+
+// ColorSpace represents encoding color space in WebP, which corresponds to
+// C.WebPEncCSP.
+type ColorSpace int
+
+const (
+	// YUV420 specifies YUV4:2:0
+	YUV420 ColorSpace = 0 // WEBP_YUV420
+	// YUV420A specifies YUV4:2:0 with alpha channel
+	YUV420A ColorSpace = 4 // WEBP_YUV420A
+)
 
 // YUVAImage represents a image of YUV colors with alpha channel image.
 //
@@ -24,12 +38,18 @@ type YUVAImage struct {
 
 // NewYUVAImage creates and allocates image buffer.
 func NewYUVAImage(r image.Rectangle, c ColorSpace) (image *YUVAImage) {
+	return newYUVAImage(r, c, func(n int) []byte { return make([]byte, n) })
+}
+
+// newYUVAImage creates image whose planes are allocated as a single buffer by
+// alloc.
+func newYUVAImage(r image.Rectangle, c ColorSpace, alloc func(n int) []byte) (image *YUVAImage) {
 	yw, yh := r.Dx(), r.Dy()
 	cw, ch := ((r.Max.X+1)/2 - r.Min.X/2), ((r.Max.Y+1)/2 - r.Min.Y/2)
 
 	switch c {
 	case YUV420:
-		b := make([]byte, yw*yh+2*cw*ch)
+		b := alloc(yw*yh + 2*cw*ch)
 		image = &YUVAImage{
 			Y:          b[:yw*yh],
 			Cb:         b[yw*yh+0*cw*ch : yw*yh+1*cw*ch],
@@ -43,7 +63,7 @@ func NewYUVAImage(r image.Rectangle, c ColorSpace) (image *YUVAImage) {
 		}
 
 	case YUV420A:
-		b := make([]byte, 2*yw*yh+2*cw*ch)
+		b := alloc(2*yw*yh + 2*cw*ch)
 		image = &YUVAImage{
 			Y:          b[:yw*yh],
 			Cb:         b[yw*yh+0*cw*ch : yw*yh+1*cw*ch],
@@ -59,3 +79,104 @@ func NewYUVAImage(r image.Rectangle, c ColorSpace) (image *YUVAImage) {
 
 	return
 }
+
+// YOffset returns the index of the first element of Y that corresponds to the
+// pixel at (x, y).
+func (p *YUVAImage) YOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.YStride + (x - p.Rect.Min.X)
+}
+
+// COffset returns the index of the first element of Cb or Cr that corresponds
+// to the pixel at (x, y).
+func (p *YUVAImage) COffset(x, y int) int {
+	return (y/2-p.Rect.Min.Y/2)*p.CStride + (x/2 - p.Rect.Min.X/2)
+}
+
+// AOffset returns the index of the first element of A that corresponds to the
+// pixel at (x, y).
+func (p *YUVAImage) AOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.AStride + (x - p.Rect.Min.X)
+}
+
+// SubImage returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels with the original image.
+func (p *YUVAImage) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	// If r1 and r2 are Rectangles, r1.Intersect(r2) is not guaranteed to be inside
+	// either r1 or r2 if the intersection is empty. Without explicitly checking for
+	// this, the Pix[i:] expression below can panic.
+	if r.Empty() {
+		return &YUVAImage{ColorSpace: p.ColorSpace}
+	}
+	sub := &YUVAImage{
+		Y:          p.Y[p.YOffset(r.Min.X, r.Min.Y):],
+		Cb:         p.Cb[p.COffset(r.Min.X, r.Min.Y):],
+		Cr:         p.Cr[p.COffset(r.Min.X, r.Min.Y):],
+		YStride:    p.YStride,
+		CStride:    p.CStride,
+		AStride:    p.AStride,
+		ColorSpace: p.ColorSpace,
+		Rect:       r,
+	}
+	if p.ColorSpace == YUV420A {
+		sub.A = p.A[p.AOffset(r.Min.X, r.Min.Y):]
+	}
+	return sub
+}
+
+// ColorModel returns color.NRGBAModel, because At converts YUV colors into
+// RGB colors.
+func (p *YUVAImage) ColorModel() color.Model {
+	return color.NRGBAModel
+}
+
+// Bounds implements image.Image.Bounds
+func (p *YUVAImage) Bounds() image.Rectangle {
+	return p.Rect
+}
+
+// At implements image.Image.At. It converts the YUV color at (x, y) into RGB
+// color in the same way as libwebp, with nearest chroma sample.
+func (p *YUVAImage) At(x, y int) color.Color {
+	return p.NRGBAAt(x, y)
+}
+
+// NRGBAAt returns the color of the pixel at (x, y) as NRGBA.
+func (p *YUVAImage) NRGBAAt(x, y int) color.NRGBA {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return color.NRGBA{}
+	}
+	ci := p.COffset(x, y)
+	yy, u, v := int(p.Y[p.YOffset(x, y)]), int(p.Cb[ci]), int(p.Cr[ci])
+
+	a := uint8(0xff)
+	if p.ColorSpace == YUV420A {
+		a = p.A[p.AOffset(x, y)]
+	}
+	return color.NRGBA{
+		R: yuvClip8(yuvMultHi(yy, 19077) + yuvMultHi(v, 26149) - 14234),
+		G: yuvClip8(yuvMultHi(yy, 19077) - yuvMultHi(u, 6419) - yuvMultHi(v, 13320) + 8708),
+		B: yuvClip8(yuvMultHi(yy, 19077) + yuvMultHi(u, 33050) - 17685),
+		A: a,
+	}
+}
+
+// yuvMultHi and yuvClip8 are the same as MultHi and VP8Clip8 of libwebp, which
+// convert YUV into RGB with 14-bit fixed-point precision.
+func yuvMultHi(v, coeff int) int {
+	return (v * coeff) >> 8
+}
+
+func yuvClip8(v int) uint8 {
+	const fix, mask = 6, (256 << 6) - 1
+	if v&^mask == 0 {
+		return uint8(v >> fix)
+	}
+	if v < 0 {
+		return 0
+	}
+	return 255
+}
+
+// Make sure YUVAImage implements image.Image.
+var _ image.Image = new(YUVAImage)